@@ -80,6 +80,10 @@ namespace OPC_DA_Agent
         [JsonProperty("max_connections")]
         public int MaxConnections { get; set; } = 100;
 
+        // 写入：开启后 /api/write 允许写入已配置的标签（采集器侧另有按点的可写白名单），默认关闭
+        [JsonProperty("enable_write")]
+        public bool EnableWrite { get; set; } = false;
+
         // 标签配置
         [JsonProperty("tags_file")]
         public string TagsFile { get; set; } = "tags.json";
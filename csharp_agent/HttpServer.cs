@@ -6,6 +6,7 @@ using System.Text;
 using System.Threading;
 
 using Newtonsoft.Json;
+using Newtonsoft.Json.Linq;
 
 namespace OPC_DA_Agent
 {
@@ -182,6 +183,11 @@ namespace OPC_DA_Agent
                     response.ContentType = "application/json; charset=utf-8";
                     buffer = HandleSaveTags(request);
                 }
+                else if (path == "/api/write" && method == "POST")
+                {
+                    response.ContentType = "application/json; charset=utf-8";
+                    buffer = HandleWrite(request);
+                }
                 else if (path == "/api/browse" && method == "GET")
                 {
                     response.ContentType = "application/json; charset=utf-8";
@@ -288,6 +294,29 @@ namespace OPC_DA_Agent
             }
         }
 
+        private byte[] HandleWrite(HttpListenerRequest request)
+        {
+            try
+            {
+                using (var reader = new StreamReader(request.InputStream, request.ContentEncoding))
+                {
+                    var writeReq = JsonConvert.DeserializeObject<WriteRequest>(reader.ReadToEnd());
+                    // 只接受标量值（数值 / 布尔 / 字符串），对象与数组会被反序列化为 JToken
+                    if (writeReq == null || string.IsNullOrEmpty(writeReq.NodeId) || writeReq.Value == null || writeReq.Value is JToken)
+                    {
+                        return Json(ApiResponse.ErrorResponse("请求数据无效"));
+                    }
+                    _opcService.WriteValue(writeReq.NodeId, writeReq.Value);
+                    return Json(ApiResponse.SuccessResponse(null, "写入成功"));
+                }
+            }
+            catch (Exception ex)
+            {
+                _logger.Warn("[HTTP] 写入失败: " + ex.Message);
+                return Json(ApiResponse.ErrorResponse("写入失败: " + ex.Message));
+            }
+        }
+
         private string ExtractQuery(string query, string key)
         {
             if (string.IsNullOrEmpty(query)) return null;
@@ -387,4 +416,13 @@ namespace OPC_DA_Agent
         [JsonProperty("tags")]
         public List<TagConfig> Tags { get; set; }
     }
+
+    public class WriteRequest
+    {
+        [JsonProperty("node_id")]
+        public string NodeId { get; set; }
+
+        [JsonProperty("value")]
+        public object Value { get; set; }
+    }
 }
@@ -725,6 +725,35 @@ namespace OPC_DA_Agent
             return _tags;
         }
 
+        /// <summary>
+        /// 写入单个标签：仅允许写入当前采集列表中的标签，且需在配置中开启 enable_write
+        /// </summary>
+        public void WriteValue(string nodeId, object value)
+        {
+            if (!_config.EnableWrite)
+                throw new InvalidOperationException("代理未开启写入（enable_write=false）");
+            if (string.IsNullOrEmpty(nodeId))
+                throw new ArgumentException("node_id 不能为空");
+
+            int index;
+            OPCItems items;
+            lock (_lock)
+            {
+                // 句柄即 1-based 项索引，0 为占位
+                index = _clientHandleNodes.IndexOf(nodeId);
+                items = _opcItems;
+            }
+            if (items == null)
+                throw new InvalidOperationException("OPC服务器未连接");
+            if (index <= 0)
+                throw new ArgumentException("标签不在采集列表中: " + nodeId);
+
+            // Write 是 COM 调用，必须在锁外执行（原因同 ApplyTags）
+            OPCItem item = items.Item(index);
+            item.Write(value);
+            _logger.Info(string.Format("[Write] {0} = {1}", nodeId, value));
+        }
+
         public void Dispose()
         {
             Stop();
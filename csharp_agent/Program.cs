@@ -160,6 +160,7 @@ namespace OPC_DA_Agent
             Console.WriteLine($"  GET  http://localhost:{_config.HttpPort}/api/browse/node?nodeId=xxx  浏览子节点");
             Console.WriteLine($"  GET  http://localhost:{_config.HttpPort}/api/tags     当前标签列表");
             Console.WriteLine($"  POST http://localhost:{_config.HttpPort}/api/tags     保存标签配置");
+            Console.WriteLine($"  POST http://localhost:{_config.HttpPort}/api/write    写入标签（需 enable_write=true）");
             Console.WriteLine();
             Console.WriteLine("按 Ctrl+C 停止程序");
             Console.WriteLine();
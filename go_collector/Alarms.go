@@ -0,0 +1,479 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 点级报警：在 processAndPublish 中按换算后的工程值判断高高 / 高 / 低 / 低低限、变化率、坏质量与僵值，
+// 维护每条报警的激活与确认状态。触发与解除经事件总线送往告警通道（事件名 alarm / alarm_recovered），
+// 触发、解除、确认三种变化还可发布到 MQTT 报警主题。
+
+const EventAlarm = "alarm"
+
+const (
+	AlarmHiHi       = "hihi"
+	AlarmHi         = "hi"
+	AlarmLo         = "lo"
+	AlarmLoLo       = "lolo"
+	AlarmRoc        = "roc"
+	AlarmBadQuality = "bad_quality"
+	AlarmStale      = "stale"
+)
+
+// 报警状态变化
+const (
+	AlarmRaised       = "raised"
+	AlarmCleared      = "cleared"
+	AlarmAcknowledged = "acknowledged"
+)
+
+var alarmConditionNames = map[string]string{
+	AlarmHiHi:       "高高限",
+	AlarmHi:         "高限",
+	AlarmLo:         "低限",
+	AlarmLoLo:       "低低限",
+	AlarmRoc:        "变化率",
+	AlarmBadQuality: "坏质量",
+	AlarmStale:      "僵值",
+}
+
+// Alarm 是一条报警。激活中的报警、以及已解除但尚未确认的报警会保留在列表中
+type Alarm struct {
+	Id           string      `json:"id"`
+	Task         string      `json:"task"`
+	Source       string      `json:"source"`
+	Key          string      `json:"key"`
+	OrigKey      string      `json:"orig_key"`
+	Condition    string      `json:"condition"`
+	Message      string      `json:"message"`
+	Value        interface{} `json:"value"`
+	Limit        *float64    `json:"limit,omitempty"`
+	Active       bool        `json:"active"`
+	Acknowledged bool        `json:"acknowledged"`
+	ActiveTime   string      `json:"active_time"`
+	ClearTime    string      `json:"clear_time,omitempty"`
+	AckTime      string      `json:"ack_time,omitempty"`
+}
+
+// AlarmList 是 /api/alarms 的返回结构
+type AlarmList struct {
+	Active         int     `json:"active"`
+	Unacknowledged int     `json:"unacknowledged"`
+	Items          []Alarm `json:"items"`
+}
+
+// alarmBinding 是一个配置了报警规则的点（发布键按任务区分）
+type alarmBinding struct {
+	Task    string
+	Source  string
+	Key     string
+	OrigKey string
+	Rule    *TagAlarm
+}
+
+// alarmState 是单个条件的状态：pendingSince 非零表示条件已成立、正在等待 on_delay
+type alarmState struct {
+	pendingSince time.Time
+	value        interface{}
+	measured     float64
+	limit        *float64
+	alarm        *Alarm
+}
+
+func (s *alarmState) active() bool {
+	return s.alarm != nil && s.alarm.Active
+}
+
+type alarmPoint struct {
+	alarmBinding
+	seen       bool
+	lastValue  interface{}
+	lastTs     int64
+	lastChange time.Time
+	hasNum     bool
+	lastNum    float64
+	lastNumAt  time.Time
+	states     map[string]*alarmState
+}
+
+func (p *alarmPoint) state(condition string) *alarmState {
+	s := p.states[condition]
+	if s == nil {
+		s = &alarmState{}
+		p.states[condition] = s
+	}
+	return s
+}
+
+type alarmNotice struct {
+	alarm      Alarm
+	transition string
+}
+
+// AlarmEngine 保存各点的报警状态，采集器热加载后仍保留仍在配置中的点
+type AlarmEngine struct {
+	mu     sync.Mutex
+	points map[string]*alarmPoint
+	notify func(alarm Alarm, transition string)
+}
+
+func NewAlarmEngine(notify func(alarm Alarm, transition string)) *AlarmEngine {
+	return &AlarmEngine{points: make(map[string]*alarmPoint), notify: notify}
+}
+
+// alarmBindings 收集配置中启用任务里带报警规则的点；同一原始点重复配置时以第一条为准，与发布逻辑一致
+func alarmBindings(config *AppConfig) []alarmBinding {
+	var bindings []alarmBinding
+	for i, task := range config.Tasks {
+		if !task.Enabled {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, tag := range task.Tags {
+			if seen[tag.OpcTag] {
+				continue
+			}
+			seen[tag.OpcTag] = true
+			if tag.Alarm != nil {
+				bindings = append(bindings, alarmBinding{
+					Task:    fmt.Sprintf("task%d", i+1),
+					Source:  task.HttpSource,
+					Key:     tag.DbName,
+					OrigKey: tag.OpcTag,
+					Rule:    tag.Alarm,
+				})
+			}
+		}
+	}
+	return bindings
+}
+
+// alarmConditionEnabled 判断规则中是否配置了该条件
+func alarmConditionEnabled(rule *TagAlarm, condition string) bool {
+	switch condition {
+	case AlarmHiHi:
+		return rule.HiHi != nil
+	case AlarmHi:
+		return rule.Hi != nil
+	case AlarmLo:
+		return rule.Lo != nil
+	case AlarmLoLo:
+		return rule.LoLo != nil
+	case AlarmRoc:
+		return rule.RateOfChange != nil
+	case AlarmBadQuality:
+		return rule.BadQuality
+	case AlarmStale:
+		return rule.StaleSecond > 0
+	}
+	return false
+}
+
+// Configure 设置需要判断报警的点。仍在配置中的点保留状态，
+// 被移除的点或条件连同其报警一并丢弃（不发送解除通知）。
+func (e *AlarmEngine) Configure(bindings []alarmBinding) {
+	now := time.Now()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	points := make(map[string]*alarmPoint, len(bindings))
+	for _, binding := range bindings {
+		id := binding.Task + "\x00" + binding.Key
+		p := e.points[id]
+		if p == nil {
+			// 从未收到过数据的点从现在开始计算僵值时间
+			p = &alarmPoint{lastChange: now, states: make(map[string]*alarmState)}
+		}
+		p.alarmBinding = binding
+		for condition := range p.states {
+			if !alarmConditionEnabled(binding.Rule, condition) {
+				delete(p.states, condition)
+			}
+		}
+		points[id] = p
+	}
+	e.points = points
+}
+
+// Evaluate 用一个新样本更新点的报警状态；timestamp 为数据源时间戳（毫秒），没有时为 0。
+// 坏质量或非数值样本不改变限值与变化率报警的状态。
+func (e *AlarmEngine) Evaluate(task, key string, value interface{}, quality int, timestamp int64, now time.Time) {
+	e.mu.Lock()
+	p := e.points[task+"\x00"+key]
+	if p == nil {
+		e.mu.Unlock()
+		return
+	}
+
+	var notices []alarmNotice
+	rule := p.Rule
+	delay := time.Duration(rule.OnDelaySecond) * time.Second
+	apply := func(condition string, on bool, measured float64, limit *float64) {
+		if n := e.advance(p, condition, on, now, delay, value, measured, limit); n != nil {
+			notices = append(notices, *n)
+		}
+	}
+
+	// 值或时间戳变化才算更新，数据源反复返回同一个缓存值不能避免僵值报警
+	if !p.seen || p.lastTs != timestamp || !reflect.DeepEqual(p.lastValue, value) {
+		p.seen, p.lastValue, p.lastTs, p.lastChange = true, value, timestamp, now
+		if rule.StaleSecond > 0 {
+			apply(AlarmStale, false, 0, nil)
+		}
+	}
+
+	if rule.BadQuality {
+		apply(AlarmBadQuality, quality < 192, float64(quality), nil)
+	}
+
+	if v, ok := numericValue(value); ok && quality >= 192 {
+		limitCheck := func(condition string, limit *float64, high bool) {
+			if limit == nil {
+				return
+			}
+			// 回差：已激活的报警需回到 限值∓deadband 以内才解除
+			threshold := *limit
+			if p.state(condition).active() {
+				if high {
+					threshold -= rule.Deadband
+				} else {
+					threshold += rule.Deadband
+				}
+			}
+			if high {
+				apply(condition, v >= threshold, v, limit)
+			} else {
+				apply(condition, v <= threshold, v, limit)
+			}
+		}
+		limitCheck(AlarmHiHi, rule.HiHi, true)
+		limitCheck(AlarmHi, rule.Hi, true)
+		limitCheck(AlarmLo, rule.Lo, false)
+		limitCheck(AlarmLoLo, rule.LoLo, false)
+
+		at := now
+		if timestamp > 0 {
+			at = time.UnixMilli(timestamp)
+		}
+		if !p.hasNum {
+			p.hasNum, p.lastNum, p.lastNumAt = true, v, at
+		} else if dt := at.Sub(p.lastNumAt).Seconds(); dt > 0 {
+			if rule.RateOfChange != nil {
+				rate := math.Abs(v-p.lastNum) / dt
+				apply(AlarmRoc, rate > *rule.RateOfChange, rate, rule.RateOfChange)
+			}
+			p.lastNum, p.lastNumAt = v, at
+		}
+	}
+	e.mu.Unlock()
+
+	e.dispatch(notices)
+}
+
+// advance 推进单个条件的状态机：条件成立并持续 delay 后触发，不成立时解除（已确认的报警随之移出列表）
+func (e *AlarmEngine) advance(p *alarmPoint, condition string, on bool, now time.Time, delay time.Duration, value interface{}, measured float64, limit *float64) *alarmNotice {
+	s := p.state(condition)
+	if !on {
+		s.pendingSince = time.Time{}
+		if !s.active() {
+			return nil
+		}
+		s.alarm.Active = false
+		s.alarm.ClearTime = now.Format(time.RFC3339)
+		notice := &alarmNotice{alarm: *s.alarm, transition: AlarmCleared}
+		if s.alarm.Acknowledged {
+			s.alarm = nil
+		}
+		return notice
+	}
+
+	if s.active() {
+		return nil
+	}
+	s.value, s.measured, s.limit = value, measured, limit
+	if s.pendingSince.IsZero() {
+		s.pendingSince = now
+	}
+	if now.Sub(s.pendingSince) < delay {
+		return nil
+	}
+	return e.raise(p, condition, s, now)
+}
+
+func (e *AlarmEngine) raise(p *alarmPoint, condition string, s *alarmState, now time.Time) *alarmNotice {
+	s.pendingSince = time.Time{}
+	s.alarm = &Alarm{
+		Id:         p.Task + ":" + p.Key + ":" + condition,
+		Task:       p.Task,
+		Source:     p.Source,
+		Key:        p.Key,
+		OrigKey:    p.OrigKey,
+		Condition:  condition,
+		Message:    alarmMessage(p, condition, s.measured, s.limit),
+		Value:      s.value,
+		Limit:      s.limit,
+		Active:     true,
+		ActiveTime: now.Format(time.RFC3339),
+	}
+	return &alarmNotice{alarm: *s.alarm, transition: AlarmRaised}
+}
+
+func alarmMessage(p *alarmPoint, condition string, measured float64, limit *float64) string {
+	name := alarmConditionNames[condition]
+	switch condition {
+	case AlarmRoc:
+		return fmt.Sprintf("%s %s报警：%.4g/秒，上限 %v/秒", p.Key, name, measured, *limit)
+	case AlarmBadQuality:
+		return fmt.Sprintf("%s %s报警：quality=%d", p.Key, name, int(measured))
+	case AlarmStale:
+		return fmt.Sprintf("%s %s报警：超过 %d 秒未更新", p.Key, name, p.Rule.StaleSecond)
+	}
+	return fmt.Sprintf("%s %s报警：当前值 %v，限值 %v", p.Key, name, measured, *limit)
+}
+
+// tick 检查僵值，并触发 on_delay 已到期但之后一直没有新样本的条件
+func (e *AlarmEngine) tick(now time.Time) {
+	var notices []alarmNotice
+	e.mu.Lock()
+	for _, p := range e.points {
+		delay := time.Duration(p.Rule.OnDelaySecond) * time.Second
+		for condition, s := range p.states {
+			if !s.pendingSince.IsZero() && now.Sub(s.pendingSince) >= delay {
+				notices = append(notices, *e.raise(p, condition, s, now))
+			}
+		}
+		if p.Rule.StaleSecond > 0 && !p.state(AlarmStale).active() &&
+			now.Sub(p.lastChange) >= time.Duration(p.Rule.StaleSecond)*time.Second {
+			s := p.state(AlarmStale)
+			s.value = p.lastValue
+			notices = append(notices, *e.raise(p, AlarmStale, s, now))
+		}
+	}
+	e.mu.Unlock()
+	e.dispatch(notices)
+}
+
+// Run 每秒执行一次 tick，直到 ctx 取消
+func (e *AlarmEngine) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			e.tick(now)
+		}
+	}
+}
+
+// Ack 确认报警，id 为空时确认全部未确认的报警；返回本次确认的条数
+func (e *AlarmEngine) Ack(id string) int {
+	now := time.Now().Format(time.RFC3339)
+	var notices []alarmNotice
+	e.mu.Lock()
+	for _, p := range e.points {
+		for _, s := range p.states {
+			if s.alarm == nil || s.alarm.Acknowledged || (id != "" && s.alarm.Id != id) {
+				continue
+			}
+			s.alarm.Acknowledged = true
+			s.alarm.AckTime = now
+			notices = append(notices, alarmNotice{alarm: *s.alarm, transition: AlarmAcknowledged})
+			if !s.alarm.Active {
+				s.alarm = nil
+			}
+		}
+	}
+	e.mu.Unlock()
+	e.dispatch(notices)
+	return len(notices)
+}
+
+// List 返回激活中与未确认的报警：激活的在前，同类按触发时间倒序
+func (e *AlarmEngine) List() AlarmList {
+	list := AlarmList{Items: make([]Alarm, 0)}
+	e.mu.Lock()
+	for _, p := range e.points {
+		for _, s := range p.states {
+			if s.alarm == nil {
+				continue
+			}
+			if s.alarm.Active {
+				list.Active++
+			}
+			if !s.alarm.Acknowledged {
+				list.Unacknowledged++
+			}
+			list.Items = append(list.Items, *s.alarm)
+		}
+	}
+	e.mu.Unlock()
+
+	sort.Slice(list.Items, func(i, j int) bool {
+		a, b := list.Items[i], list.Items[j]
+		if a.Active != b.Active {
+			return a.Active
+		}
+		if a.ActiveTime != b.ActiveTime {
+			return a.ActiveTime > b.ActiveTime
+		}
+		return a.Id < b.Id
+	})
+	return list
+}
+
+func (e *AlarmEngine) dispatch(notices []alarmNotice) {
+	if e.notify == nil {
+		return
+	}
+	for _, n := range notices {
+		e.notify(n.alarm, n.transition)
+	}
+}
+
+// handleAlarms 返回当前报警列表
+func (ws *WebServer) handleAlarms(w http.ResponseWriter, r *http.Request) {
+	if ws.collector == nil {
+		ws.writeJSON(w, false, "采集器未启动", nil)
+		return
+	}
+	ws.writeJSON(w, true, "获取成功", ws.collector.alarms.List())
+}
+
+// handleAlarmAck 确认报警，请求体 {"id": "..."}；id 为空或 {"all": true} 时确认全部
+func (ws *WebServer) handleAlarmAck(w http.ResponseWriter, r *http.Request) {
+	if ws.collector == nil {
+		ws.writeJSON(w, false, "采集器未启动", nil)
+		return
+	}
+	var req struct {
+		Id  string `json:"id"`
+		All bool   `json:"all"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ws.writeJSON(w, false, "JSON解析失败", nil)
+		return
+	}
+	if req.Id == "" && !req.All {
+		ws.writeJSON(w, false, "请指定报警 id 或 all", nil)
+		return
+	}
+	if req.All {
+		req.Id = ""
+	}
+	n := ws.collector.alarms.Ack(req.Id)
+	if n == 0 && req.Id != "" {
+		ws.writeJSON(w, false, "报警不存在或已确认", nil)
+		return
+	}
+	ws.writeJSON(w, true, fmt.Sprintf("已确认 %d 条报警", n), map[string]int{"acknowledged": n})
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// alarmStep 是报警引擎的一步输入：at 为相对起点的秒数；tick 为真时只执行 tick，ack 为真时确认全部报警，
+// 否则以 value/quality 调用 Evaluate（时间戳为 0，由值变化判断是否更新）。want 为本步产生的 "条件:变化" 序列。
+type alarmStep struct {
+	at      int
+	value   interface{}
+	quality int
+	tick    bool
+	ack     bool
+	want    []string
+}
+
+func newTestAlarmEngine(rule *TagAlarm) (*AlarmEngine, *[]string) {
+	var got []string
+	engine := NewAlarmEngine(func(alarm Alarm, transition string) {
+		got = append(got, alarm.Condition+":"+transition)
+	})
+	engine.Configure([]alarmBinding{{Task: "task1", Source: "line1", Key: "a", OrigKey: "A", Rule: rule}})
+	return engine, &got
+}
+
+func TestAlarmEngineEvaluate(t *testing.T) {
+	cases := []struct {
+		name  string
+		rule  *TagAlarm
+		steps []alarmStep
+	}{
+		{
+			name: "高限回差",
+			rule: &TagAlarm{Hi: floatPtr(100), Deadband: 5},
+			steps: []alarmStep{
+				{at: 0, value: 90.0, quality: 192},
+				{at: 1, value: 100.0, quality: 192, want: []string{"hi:raised"}},
+				// 激活后需回到 100-5 以下才解除
+				{at: 2, value: 97.0, quality: 192},
+				{at: 3, value: 95.0, quality: 192},
+				{at: 4, value: 94.0, quality: 192, want: []string{"hi:cleared"}},
+				// 解除后回差不再生效
+				{at: 5, value: 99.0, quality: 192},
+				{at: 6, value: 100.0, quality: 192, want: []string{"hi:raised"}},
+			},
+		},
+		{
+			name: "低限回差",
+			rule: &TagAlarm{Lo: floatPtr(10), Deadband: 2},
+			steps: []alarmStep{
+				{at: 0, value: 10.0, quality: 192, want: []string{"lo:raised"}},
+				{at: 1, value: 11.0, quality: 192},
+				{at: 2, value: 12.5, quality: 192, want: []string{"lo:cleared"}},
+			},
+		},
+		{
+			name: "高高限与高限",
+			rule: &TagAlarm{HiHi: floatPtr(120), Hi: floatPtr(100)},
+			steps: []alarmStep{
+				{at: 0, value: 110.0, quality: 192, want: []string{"hi:raised"}},
+				{at: 1, value: 130.0, quality: 192, want: []string{"hihi:raised"}},
+				{at: 2, value: 50.0, quality: 192, want: []string{"hihi:cleared", "hi:cleared"}},
+			},
+		},
+		{
+			name: "on_delay 延迟触发",
+			rule: &TagAlarm{Hi: floatPtr(100), OnDelaySecond: 5},
+			steps: []alarmStep{
+				{at: 0, value: 110.0, quality: 192},
+				{at: 3, value: 111.0, quality: 192},
+				// 条件中途不成立，重新计时
+				{at: 4, value: 90.0, quality: 192},
+				{at: 5, value: 110.0, quality: 192},
+				{at: 9, value: 112.0, quality: 192},
+				{at: 10, value: 113.0, quality: 192, want: []string{"hi:raised"}},
+				{at: 11, value: 80.0, quality: 192, want: []string{"hi:cleared"}},
+			},
+		},
+		{
+			name: "on_delay 到期后由 tick 触发",
+			rule: &TagAlarm{Hi: floatPtr(100), OnDelaySecond: 5},
+			steps: []alarmStep{
+				{at: 0, value: 110.0, quality: 192},
+				{at: 4, tick: true},
+				{at: 5, tick: true, want: []string{"hi:raised"}},
+				{at: 6, tick: true},
+			},
+		},
+		{
+			name: "僵值",
+			rule: &TagAlarm{StaleSecond: 10},
+			steps: []alarmStep{
+				{at: 0, value: 1.0, quality: 192},
+				// 同一个缓存值反复返回不算更新
+				{at: 5, value: 1.0, quality: 192},
+				{at: 9, tick: true},
+				{at: 10, tick: true, want: []string{"stale:raised"}},
+				{at: 11, tick: true},
+				{at: 12, value: 2.0, quality: 192, want: []string{"stale:cleared"}},
+				{at: 21, tick: true},
+				{at: 22, tick: true, want: []string{"stale:raised"}},
+			},
+		},
+		{
+			name: "坏质量不判断限值",
+			rule: &TagAlarm{Hi: floatPtr(100), BadQuality: true},
+			steps: []alarmStep{
+				{at: 0, value: 150.0, quality: 0, want: []string{"bad_quality:raised"}},
+				{at: 1, value: 150.0, quality: 192, want: []string{"bad_quality:cleared", "hi:raised"}},
+				// 坏质量期间保持限值报警的状态
+				{at: 2, value: 50.0, quality: 64, want: []string{"bad_quality:raised"}},
+				{at: 3, value: 50.0, quality: 192, want: []string{"bad_quality:cleared", "hi:cleared"}},
+			},
+		},
+		{
+			name: "非数值",
+			rule: &TagAlarm{Hi: floatPtr(100)},
+			steps: []alarmStep{
+				// 字符串不按数值判断限值
+				{at: 0, value: "150", quality: 192},
+				{at: 1, value: 150, quality: 192, want: []string{"hi:raised"}},
+				// 非数值样本不改变已激活报警的状态
+				{at: 2, value: "abc", quality: 192},
+				{at: 3, value: true, quality: 192},
+				{at: 4, value: int64(50), quality: 192, want: []string{"hi:cleared"}},
+			},
+		},
+		{
+			name: "变化率",
+			rule: &TagAlarm{RateOfChange: floatPtr(10)},
+			steps: []alarmStep{
+				{at: 0, value: 0.0, quality: 192},
+				{at: 1, value: 5.0, quality: 192},
+				{at: 2, value: 30.0, quality: 192, want: []string{"roc:raised"}},
+				{at: 4, value: 40.0, quality: 192, want: []string{"roc:cleared"}},
+			},
+		},
+		{
+			name: "确认",
+			rule: &TagAlarm{Hi: floatPtr(100)},
+			steps: []alarmStep{
+				{at: 0, value: 110.0, quality: 192, want: []string{"hi:raised"}},
+				{at: 1, ack: true, want: []string{"hi:acknowledged"}},
+				{at: 2, ack: true},
+				{at: 3, value: 90.0, quality: 192, want: []string{"hi:cleared"}},
+				// 解除后未确认的报警仍可确认
+				{at: 4, value: 110.0, quality: 192, want: []string{"hi:raised"}},
+				{at: 5, value: 90.0, quality: 192, want: []string{"hi:cleared"}},
+				{at: 6, ack: true, want: []string{"hi:acknowledged"}},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			engine, got := newTestAlarmEngine(c.rule)
+			base := time.Now()
+			for i, step := range c.steps {
+				*got = nil
+				now := base.Add(time.Duration(step.at) * time.Second)
+				switch {
+				case step.tick:
+					engine.tick(now)
+				case step.ack:
+					engine.Ack("")
+				default:
+					engine.Evaluate("task1", "a", step.value, step.quality, 0, now)
+				}
+				if !reflect.DeepEqual(*got, step.want) {
+					t.Fatalf("第 %d 步（%ds）: 报警变化 = %v, want %v", i+1, step.at, *got, step.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAlarmEngineAck(t *testing.T) {
+	engine, _ := newTestAlarmEngine(&TagAlarm{Hi: floatPtr(100), Lo: floatPtr(0)})
+	base := time.Now()
+
+	engine.Evaluate("task1", "a", 110.0, 192, 0, base)
+	list := engine.List()
+	if list.Active != 1 || list.Unacknowledged != 1 || len(list.Items) != 1 {
+		t.Fatalf("触发后列表 = %+v", list)
+	}
+	alarm := list.Items[0]
+	if alarm.Id != "task1:a:hi" || alarm.Source != "line1" || alarm.OrigKey != "A" || *alarm.Limit != 100 || alarm.Value != 110.0 {
+		t.Errorf("报警 = %+v", alarm)
+	}
+
+	if n := engine.Ack("task1:a:lo"); n != 0 {
+		t.Errorf("确认不存在的报警返回 %d", n)
+	}
+	if n := engine.Ack(alarm.Id); n != 1 {
+		t.Fatalf("确认返回 %d", n)
+	}
+	list = engine.List()
+	if list.Active != 1 || list.Unacknowledged != 0 || !list.Items[0].Acknowledged || list.Items[0].AckTime == "" {
+		t.Errorf("确认后列表 = %+v", list)
+	}
+	if n := engine.Ack(alarm.Id); n != 0 {
+		t.Errorf("重复确认返回 %d", n)
+	}
+
+	// 已确认的报警解除后移出列表
+	engine.Evaluate("task1", "a", 50.0, 192, 0, base.Add(time.Second))
+	if list = engine.List(); len(list.Items) != 0 {
+		t.Errorf("解除后列表 = %+v", list)
+	}
+
+	// 未确认的报警解除后保留，确认后移出；激活的排在前面
+	engine.Evaluate("task1", "a", 110.0, 192, 0, base.Add(2*time.Second))
+	engine.Evaluate("task1", "a", 50.0, 192, 0, base.Add(3*time.Second))
+	engine.Evaluate("task1", "a", -1.0, 192, 0, base.Add(4*time.Second))
+	list = engine.List()
+	if list.Active != 1 || list.Unacknowledged != 2 || len(list.Items) != 2 || list.Items[0].Condition != AlarmLo || list.Items[1].ClearTime == "" {
+		t.Fatalf("列表 = %+v", list)
+	}
+	if n := engine.Ack(""); n != 2 {
+		t.Errorf("确认全部返回 %d", n)
+	}
+	if list = engine.List(); list.Active != 1 || list.Unacknowledged != 0 || len(list.Items) != 1 {
+		t.Errorf("确认全部后列表 = %+v", list)
+	}
+}
+
+func TestAlarmEngineConfigureKeepsState(t *testing.T) {
+	rule := &TagAlarm{Hi: floatPtr(100)}
+	engine, got := newTestAlarmEngine(rule)
+	engine.Evaluate("task1", "a", 110.0, 192, 0, time.Now())
+
+	// 热加载后仍在配置中的点保留激活的报警，不重复触发
+	engine.Configure([]alarmBinding{{Task: "task1", Source: "line1", Key: "a", OrigKey: "A", Rule: rule}})
+	engine.Evaluate("task1", "a", 120.0, 192, 0, time.Now())
+	if !reflect.DeepEqual(*got, []string{"hi:raised"}) || engine.List().Active != 1 {
+		t.Errorf("热加载后报警变化 = %v, 列表 = %+v", *got, engine.List())
+	}
+
+	// 去掉条件后报警一并丢弃，不发送解除
+	engine.Configure([]alarmBinding{{Task: "task1", Source: "line1", Key: "a", OrigKey: "A", Rule: &TagAlarm{Lo: floatPtr(0)}}})
+	if list := engine.List(); len(list.Items) != 0 || len(*got) != 1 {
+		t.Errorf("去掉条件后列表 = %+v, 报警变化 = %v", list, *got)
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 事件总线与告警分发：数据源、SSE、输出端等在出错 / 恢复时发出事件，
+// 告警分发器按通道（Webhook 等）订阅的事件名过滤，对持续存在的故障去重，失败时重试投递。
+
+const (
+	EventMqttError    = "mqtt_error"
+	EventRtdbError    = "rtdb_error"
+	EventHttpError    = "http_error"
+	EventSseError     = "sse_error"
+	EventCollectError = "collect_error"
+
+	EventTransformCollision = "transform_collision"
+	EventTransformError     = "transform_error"
+	EventTransformReloaded  = "transform_reloaded"
+)
+
+const (
+	SeverityError     = "error"
+	SeverityRecovered = "recovered"
+	// 通知类事件（如规则重新加载）不对应故障，不去重也没有恢复
+	SeverityInfo = "info"
+)
+
+// Event 是一条告警事件。Subject 标识故障对象（数据源名、任务名、输出端），
+// 同一 Type+Subject 的错误视为同一故障，直到对应的恢复事件出现。
+type Event struct {
+	Type     string `json:"event"`
+	Subject  string `json:"subject"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Time     string `json:"timestamp"`
+	// Count 为本次通知前该故障累计出现的次数（去重期间被合并的次数也计入）
+	Count int `json:"count,omitempty"`
+	// DurationSeconds 为恢复事件对应故障持续的秒数
+	DurationSeconds int64 `json:"duration_seconds,omitempty"`
+}
+
+// RecoveredType 返回错误事件对应的恢复事件名，如 mqtt_error → mqtt_recovered
+func RecoveredType(errorType string) string {
+	return strings.TrimSuffix(errorType, "_error") + "_recovered"
+}
+
+// EventBus 是进程内的同步事件总线，订阅者需自行保证不阻塞
+type EventBus struct {
+	mu     sync.RWMutex
+	nextId int
+	subs   map[int]func(Event)
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[int]func(Event))}
+}
+
+// Subscribe 注册订阅者，返回取消订阅函数
+func (b *EventBus) Subscribe(fn func(Event)) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextId++
+	id := b.nextId
+	b.subs[id] = fn
+	return func() {
+		b.mu.Lock()
+		delete(b.subs, id)
+		b.mu.Unlock()
+	}
+}
+
+func (b *EventBus) publish(e Event) {
+	if e.Time == "" {
+		e.Time = time.Now().Format(time.RFC3339)
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, fn := range b.subs {
+		fn(e)
+	}
+}
+
+// Error 发出错误事件
+func (b *EventBus) Error(eventType, subject string, err error) {
+	b.publish(Event{Type: eventType, Subject: subject, Severity: SeverityError, Message: err.Error()})
+}
+
+// Recover 声明故障已恢复；分发器只在该故障确实处于告警状态时才发送恢复通知
+func (b *EventBus) Recover(eventType, subject, message string) {
+	b.publish(Event{Type: eventType, Subject: subject, Severity: SeverityRecovered, Message: message})
+}
+
+// Info 发出通知类事件
+func (b *EventBus) Info(eventType, subject, message string) {
+	b.publish(Event{Type: eventType, Subject: subject, Severity: SeverityInfo, Message: message})
+}
+
+// AlertChannel 是告警通知通道
+type AlertChannel interface {
+	Name() string
+	// Accepts 判断通道是否订阅了该事件名
+	Accepts(eventType string) bool
+	Send(e Event) error
+}
+
+// alertCondition 是一个尚未恢复的故障
+type alertCondition struct {
+	since    time.Time
+	lastSent time.Time
+	count    int
+}
+
+// AlertDispatcher 把总线上的事件去重后投递到各通道：
+// 同一故障首次出现立即通知，之后每 repeat 间隔最多提醒一次；恢复时发送 *_recovered 事件。
+type AlertDispatcher struct {
+	channels   []AlertChannel
+	repeat     time.Duration
+	retries    int
+	retryDelay time.Duration
+
+	mu     sync.Mutex
+	active map[string]*alertCondition
+	queue  chan Event
+	done   chan struct{}
+}
+
+func NewAlertDispatcher(channels []AlertChannel, repeat time.Duration, retries int) *AlertDispatcher {
+	if repeat <= 0 {
+		repeat = 10 * time.Minute
+	}
+	if retries < 0 {
+		retries = 0
+	}
+	return &AlertDispatcher{
+		channels:   channels,
+		repeat:     repeat,
+		retries:    retries,
+		retryDelay: 2 * time.Second,
+		active:     make(map[string]*alertCondition),
+		queue:      make(chan Event, 256),
+		done:       make(chan struct{}),
+	}
+}
+
+// Start 启动投递协程并订阅总线，返回的函数用于停止
+func (d *AlertDispatcher) Start(bus *EventBus) func() {
+	go d.run()
+	unsubscribe := bus.Subscribe(d.Handle)
+	return func() {
+		unsubscribe()
+		close(d.done)
+	}
+}
+
+// Handle 处理一条事件：更新故障状态并决定是否通知（不阻塞调用方）
+func (d *AlertDispatcher) Handle(e Event) {
+	key := e.Type + "\x00" + e.Subject
+	now := time.Now()
+
+	d.mu.Lock()
+	cond := d.active[key]
+	switch e.Severity {
+	case SeverityInfo:
+		// 直接投递
+	case SeverityRecovered:
+		if cond == nil {
+			d.mu.Unlock()
+			return
+		}
+		delete(d.active, key)
+		e.Type = RecoveredType(e.Type)
+		e.Count = cond.count
+		e.DurationSeconds = int64(now.Sub(cond.since).Seconds())
+	default:
+		if cond == nil {
+			cond = &alertCondition{since: now}
+			d.active[key] = cond
+		}
+		cond.count++
+		if !cond.lastSent.IsZero() && now.Sub(cond.lastSent) < d.repeat {
+			d.mu.Unlock()
+			return
+		}
+		cond.lastSent = now
+		e.Count = cond.count
+	}
+	d.mu.Unlock()
+
+	select {
+	case d.queue <- e:
+	default:
+		log.Printf("⚠️ 告警队列已满，丢弃事件 %s[%s]", e.Type, e.Subject)
+	}
+}
+
+func (d *AlertDispatcher) run() {
+	for {
+		select {
+		case <-d.done:
+			return
+		case e := <-d.queue:
+			for _, ch := range d.channels {
+				if ch.Accepts(e.Type) {
+					d.deliver(ch, e)
+				}
+			}
+		}
+	}
+}
+
+// deliver 投递到单个通道，失败后按 2s、4s、8s… 退避重试
+func (d *AlertDispatcher) deliver(ch AlertChannel, e Event) {
+	delay := d.retryDelay
+	for attempt := 0; ; attempt++ {
+		err := ch.Send(e)
+		if err == nil {
+			log.Printf("🔔 %s告警已发送: %s[%s] %s", ch.Name(), e.Type, e.Subject, e.Message)
+			return
+		}
+		if attempt >= d.retries {
+			log.Printf("⚠️ %s告警发送失败（已重试 %d 次）: %v", ch.Name(), attempt, err)
+			return
+		}
+		select {
+		case <-d.done:
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// WebhookChannel 以 JSON POST 投递事件
+type WebhookChannel struct {
+	url    string
+	events map[string]bool
+	client *http.Client
+}
+
+// NewWebhookChannel 创建 Webhook 通道，events 规则见 eventSet
+func NewWebhookChannel(config *WebhookConfig) *WebhookChannel {
+	return &WebhookChannel{
+		url:    config.Url,
+		events: eventSet(config.Events),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// eventSet 解析通道订阅的事件名；为空（返回 nil）表示接收全部事件。
+// 订阅了 xxx_error（或 alarm）的通道同时接收对应的 xxx_recovered（alarm_recovered）。
+func eventSet(names []string) map[string]bool {
+	var events map[string]bool
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			if events == nil {
+				events = make(map[string]bool)
+			}
+			events[name] = true
+			if strings.HasSuffix(name, "_error") || name == EventAlarm {
+				events[RecoveredType(name)] = true
+			}
+		}
+	}
+	return events
+}
+
+func (ch *WebhookChannel) Name() string { return "Webhook" }
+
+func (ch *WebhookChannel) Accepts(eventType string) bool {
+	return ch.events == nil || ch.events[eventType]
+}
+
+func (ch *WebhookChannel) Send(e Event) error {
+	payload := map[string]interface{}{
+		"event":     e.Type,
+		"subject":   e.Subject,
+		"severity":  e.Severity,
+		"message":   e.Message,
+		"timestamp": e.Time,
+		"source":    "opc_collector",
+	}
+	if e.Count > 0 {
+		payload["count"] = e.Count
+	}
+	if e.DurationSeconds > 0 {
+		payload["duration_seconds"] = e.DurationSeconds
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := ch.client.Post(ch.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Webhook返回状态码: %d", resp.StatusCode)
+	}
+	return nil
+}
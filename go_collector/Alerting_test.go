@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeChannel 记录每次 Send 调用，前 fails 次返回错误
+type fakeChannel struct {
+	events map[string]bool
+	fails  int
+
+	mu    sync.Mutex
+	calls []time.Time
+	sent  []Event
+}
+
+func (ch *fakeChannel) Name() string { return "测试" }
+
+func (ch *fakeChannel) Accepts(eventType string) bool {
+	return ch.events == nil || ch.events[eventType]
+}
+
+func (ch *fakeChannel) Send(e Event) error {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.calls = append(ch.calls, time.Now())
+	if len(ch.calls) <= ch.fails {
+		return errors.New("发送失败")
+	}
+	ch.sent = append(ch.sent, e)
+	return nil
+}
+
+func (ch *fakeChannel) result() (calls []time.Time, sent []Event) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	return append([]time.Time(nil), ch.calls...), append([]Event(nil), ch.sent...)
+}
+
+// drainAlerts 取出分发器已排队待投递的事件（测试中不启动投递协程）
+func drainAlerts(d *AlertDispatcher) []Event {
+	var events []Event
+	for {
+		select {
+		case e := <-d.queue:
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+func TestAlertDispatcherDedup(t *testing.T) {
+	d := NewAlertDispatcher(nil, time.Minute, 0)
+	failure := errors.New("连接断开")
+	bus := NewEventBus()
+	bus.Subscribe(d.Handle)
+
+	bus.Error(EventMqttError, "mqtt", failure)
+	bus.Error(EventMqttError, "mqtt", failure)
+	// 不同的 Type 或 Subject 是不同的故障
+	bus.Error(EventHttpError, "mqtt", failure)
+	bus.Error(EventMqttError, "rtdb", failure)
+	got := drainAlerts(d)
+	if len(got) != 3 || got[0].Type != EventMqttError || got[0].Count != 1 || got[0].Message != "连接断开" {
+		t.Fatalf("首次故障通知 = %+v", got)
+	}
+
+	// repeat 间隔内合并，到期后再提醒一次并带上累计次数
+	bus.Error(EventMqttError, "mqtt", failure)
+	if got = drainAlerts(d); len(got) != 0 {
+		t.Fatalf("间隔内重复通知 = %+v", got)
+	}
+	cond := d.active[EventMqttError+"\x00mqtt"]
+	cond.lastSent = time.Now().Add(-time.Minute)
+	cond.since = time.Now().Add(-90 * time.Second)
+	bus.Error(EventMqttError, "mqtt", failure)
+	if got = drainAlerts(d); len(got) != 1 || got[0].Count != 4 {
+		t.Fatalf("间隔到期后通知 = %+v", got)
+	}
+
+	// 恢复事件带上累计次数与持续时间，只发送一次
+	bus.Recover(EventMqttError, "mqtt", "已重新连接")
+	bus.Recover(EventMqttError, "mqtt", "已重新连接")
+	got = drainAlerts(d)
+	if len(got) != 1 || got[0].Type != "mqtt_recovered" || got[0].Severity != SeverityRecovered || got[0].Count != 4 ||
+		got[0].DurationSeconds < 90 || got[0].Message != "已重新连接" {
+		t.Fatalf("恢复通知 = %+v", got)
+	}
+	// 从未告警的故障不发送恢复
+	bus.Recover(EventSseError, "line1", "已恢复")
+	if got = drainAlerts(d); len(got) != 0 {
+		t.Fatalf("未告警故障的恢复通知 = %+v", got)
+	}
+
+	// 恢复后再次出错重新计数并立即通知
+	bus.Error(EventMqttError, "mqtt", failure)
+	if got = drainAlerts(d); len(got) != 1 || got[0].Count != 1 {
+		t.Fatalf("恢复后再次故障 = %+v", got)
+	}
+
+	// 通知类事件不去重
+	bus.Info(EventTransformReloaded, "rules", "已重新加载")
+	bus.Info(EventTransformReloaded, "rules", "已重新加载")
+	if got = drainAlerts(d); len(got) != 2 || got[0].Severity != SeverityInfo {
+		t.Fatalf("通知类事件 = %+v", got)
+	}
+}
+
+func TestAlertDispatcherRetry(t *testing.T) {
+	cases := []struct {
+		name      string
+		fails     int
+		retries   int
+		wantCalls int
+		wantSent  bool
+	}{
+		{name: "一次成功", fails: 0, retries: 2, wantCalls: 1, wantSent: true},
+		{name: "不重试", fails: 1, retries: 0, wantCalls: 1, wantSent: false},
+		{name: "重试后成功", fails: 2, retries: 3, wantCalls: 3, wantSent: true},
+		{name: "重试用尽", fails: 5, retries: 2, wantCalls: 3, wantSent: false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d := NewAlertDispatcher(nil, time.Minute, c.retries)
+			d.retryDelay = 20 * time.Millisecond
+			ch := &fakeChannel{fails: c.fails}
+			d.deliver(ch, Event{Type: EventMqttError, Subject: "mqtt", Message: "连接断开"})
+
+			calls, sent := ch.result()
+			if len(calls) != c.wantCalls || (len(sent) == 1) != c.wantSent {
+				t.Fatalf("调用 %d 次, 送达 %d 条; want %d 次, 送达 %v", len(calls), len(sent), c.wantCalls, c.wantSent)
+			}
+			// 退避间隔逐次加倍：20ms、40ms…
+			delay := d.retryDelay
+			for i := 1; i < len(calls); i++ {
+				if gap := calls[i].Sub(calls[i-1]); gap < delay {
+					t.Errorf("第 %d 次重试间隔 %v < %v", i, gap, delay)
+				}
+				delay *= 2
+			}
+		})
+	}
+}
+
+func TestAlertDispatcherRetryStops(t *testing.T) {
+	d := NewAlertDispatcher(nil, time.Minute, 3)
+	d.retryDelay = time.Hour
+	ch := &fakeChannel{fails: 10}
+	done := make(chan struct{})
+	go func() {
+		d.deliver(ch, Event{Type: EventMqttError, Subject: "mqtt"})
+		close(done)
+	}()
+	waitFor(t, time.Second, "首次发送", func() bool {
+		calls, _ := ch.result()
+		return len(calls) == 1
+	})
+
+	// 停止分发器时中断退避等待
+	close(d.done)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("停止后仍在等待重试")
+	}
+}
+
+func TestAlertDispatcherStart(t *testing.T) {
+	mqtt := &fakeChannel{events: eventSet([]string{EventMqttError})}
+	all := &fakeChannel{}
+	d := NewAlertDispatcher([]AlertChannel{mqtt, all}, time.Minute, 0)
+	bus := NewEventBus()
+	stop := d.Start(bus)
+	defer stop()
+
+	bus.Error(EventHttpError, "line1", errors.New("超时"))
+	bus.Error(EventMqttError, "mqtt", errors.New("连接断开"))
+	bus.Recover(EventMqttError, "mqtt", "已重新连接")
+	waitFor(t, time.Second, "投递完成", func() bool {
+		_, sent := all.result()
+		return len(sent) == 3
+	})
+
+	// 通道只收到订阅的事件及对应的恢复事件，顺序与发出顺序一致
+	_, sent := mqtt.result()
+	if len(sent) != 2 || sent[0].Type != EventMqttError || sent[1].Type != "mqtt_recovered" {
+		t.Errorf("订阅通道收到 %+v", sent)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"strconv"
 	"strings"
 
 	"gopkg.in/ini.v1"
@@ -55,6 +56,14 @@ func (cm *ConfigManager) LoadIni(path string) *AppConfig {
 		httpConfig.Url = section.Key("url").String()
 		httpConfig.Method = section.Key("method").String()
 		httpConfig.Timeout, _ = section.Key("timeout").Int()
+		httpConfig.Type = section.Key("type").String()
+		httpConfig.SimFile = section.Key("sim_file").String()
+		switch httpConfig.Type {
+		case "", HttpTypeHttp, HttpTypeSimulate:
+		default:
+			fmt.Printf("[ConfigManager] ⚠️ [%s] type=%s 无效，按 http 数据源处理\n", sectionName, httpConfig.Type)
+			httpConfig.Type = ""
+		}
 		config.HttpConfigs = append(config.HttpConfigs, httpConfig)
 	}
 
@@ -87,6 +96,18 @@ func (cm *ConfigManager) LoadIni(path string) *AppConfig {
 		config.MqttConfig.Format = section.Key("format").String()
 		config.MqttConfig.JsTransform = section.Key("js_transform").String()
 		config.MqttConfig.Split, _ = section.Key("split").Bool()
+		config.MqttConfig.Protocol = section.Key("protocol").String()
+		config.MqttConfig.WsPath = section.Key("ws_path").String()
+		config.MqttConfig.TlsCaFile = section.Key("tls_ca_file").String()
+		config.MqttConfig.TlsCertFile = section.Key("tls_cert_file").String()
+		config.MqttConfig.TlsKeyFile = section.Key("tls_key_file").String()
+		config.MqttConfig.TlsInsecureSkipVerify, _ = section.Key("tls_insecure_skip_verify").Bool()
+		config.MqttConfig.TlsServerName = section.Key("tls_server_name").String()
+		config.MqttConfig.SparkplugGroupId = section.Key("sparkplug_group_id").String()
+		config.MqttConfig.SparkplugEdgeNodeId = section.Key("sparkplug_edge_node_id").String()
+		config.MqttConfig.AlarmTopic = section.Key("alarm_topic").String()
+		config.MqttConfig.CommandTopic = section.Key("command_topic").String()
+		config.MqttConfig.CommandAckTopic = section.Key("command_ack_topic").String()
 	}
 
 	if section := cfg.Section("rtdb"); section != nil {
@@ -105,6 +126,44 @@ func (cm *ConfigManager) LoadIni(path string) *AppConfig {
 		if eventsStr != "" {
 			config.WebhookConfig.Events = strings.Split(eventsStr, ",")
 		}
+		config.WebhookConfig.RepeatMinutes, _ = section.Key("repeat_minutes").Int()
+		config.WebhookConfig.Retries = iniOptionalInt(section, "retries")
+	}
+
+	if section := cfg.Section("monitor"); section != nil && len(section.Keys()) > 0 {
+		config.MonitorConfig = &MonitorConfig{}
+		config.MonitorConfig.Monitor, _ = section.Key("monitor").Bool()
+		config.MonitorConfig.Mode = section.Key("mode").String()
+		config.MonitorConfig.Email = section.Key("email").String()
+		config.MonitorConfig.SmtpHost = section.Key("smtp_host").String()
+		config.MonitorConfig.SmtpPort, _ = section.Key("smtp_port").Int()
+		config.MonitorConfig.SmtpSecurity = section.Key("smtp_security").String()
+		config.MonitorConfig.SmtpUsername = section.Key("smtp_username").String()
+		config.MonitorConfig.SmtpPassword = section.Key("smtp_password").String()
+		config.MonitorConfig.SmtpFrom = section.Key("smtp_from").String()
+		config.MonitorConfig.Subject = section.Key("subject").String()
+		if eventsStr := section.Key("events").String(); eventsStr != "" {
+			config.MonitorConfig.Events = strings.Split(eventsStr, ",")
+		}
+		switch config.MonitorConfig.SmtpSecurity {
+		case "", SmtpSecurityNone, SmtpSecurityStartTls, SmtpSecuritySsl:
+		default:
+			fmt.Printf("[ConfigManager] ⚠️ [monitor] smtp_security=%s 无效，按端口自动选择\n", config.MonitorConfig.SmtpSecurity)
+			config.MonitorConfig.SmtpSecurity = ""
+		}
+	}
+
+	if section := cfg.Section("buffer"); section != nil && len(section.Keys()) > 0 {
+		config.BufferConfig = &BufferConfig{}
+		config.BufferConfig.Enabled, _ = section.Key("enabled").Bool()
+		config.BufferConfig.Dir = section.Key("dir").String()
+		config.BufferConfig.MaxSizeMB, _ = section.Key("max_size_mb").Int()
+		config.BufferConfig.MaxAgeHours, _ = section.Key("max_age_hours").Int()
+		config.BufferConfig.Overflow = section.Key("overflow").String()
+		if !validOverflow(config.BufferConfig.Overflow) {
+			fmt.Printf("[ConfigManager] ❌ [buffer] overflow=%s 无效，可选 drop_oldest / drop_newest\n", config.BufferConfig.Overflow)
+			return nil
+		}
 	}
 
 	// Task sections
@@ -128,6 +187,22 @@ func (cm *ConfigManager) LoadIni(path string) *AppConfig {
 		task.Enabled, _ = section.Key("task").Bool()
 		task.HttpSource = section.Key("http_source").String()
 		task.JobIntervalSecond, _ = section.Key("job_interval_second").Int()
+		task.Strict, _ = section.Key("strict").Bool()
+		task.ReportByException, _ = section.Key("report_by_exception").Bool()
+		task.Deadband, _ = section.Key("deadband").Float64()
+		task.DeadbandPercent, _ = section.Key("deadband_percent").Float64()
+		task.MaxSilenceSecond, _ = section.Key("max_silence_second").Int()
+		task.TagPrecision = iniOptionalInt(section, "tag_precision")
+		task.TimestampSource = section.Key("timestamp_source").String()
+		if task.TimestampSource != "" && task.TimestampSource != TimestampSourceSource && task.TimestampSource != TimestampSourceCollector {
+			fmt.Printf("[ConfigManager] ⚠️ [%s] timestamp_source=%s 无效，使用数据源时间\n", section.Name(), task.TimestampSource)
+			task.TimestampSource = TimestampSourceSource
+		}
+		task.CollisionPolicy = section.Key("collision_policy").String()
+		if !validCollisionPolicy(task.CollisionPolicy) {
+			fmt.Printf("[ConfigManager] ⚠️ [%s] collision_policy=%s 无效，使用 keep_last\n", section.Name(), task.CollisionPolicy)
+			task.CollisionPolicy = ""
+		}
 
 		for j := 1; ; j++ {
 			opcKey := fmt.Sprintf("tag_opc%d", j)
@@ -141,8 +216,19 @@ func (cm *ConfigManager) LoadIni(path string) *AppConfig {
 			}
 
 			task.Tags = append(task.Tags, &TagMapping{
-				OpcTag: opcTag,
-				DbName: dbName,
+				OpcTag:           opcTag,
+				DbName:           dbName,
+				Deadband:         iniOptionalFloat(section, fmt.Sprintf("tag_deadband%d", j)),
+				DeadbandPercent:  iniOptionalFloat(section, fmt.Sprintf("tag_deadband_pct%d", j)),
+				MaxSilenceSecond: iniOptionalInt(section, fmt.Sprintf("tag_max_silence%d", j)),
+				Scale:            iniFloatList(section, fmt.Sprintf("tag_scale%d", j), 4),
+				Gain:             iniOptionalFloat(section, fmt.Sprintf("tag_gain%d", j)),
+				Clamp:            iniFloatList(section, fmt.Sprintf("tag_clamp%d", j), 2),
+				Precision:        iniOptionalInt(section, fmt.Sprintf("tag_precision%d", j)),
+				Offset:           section.Key(fmt.Sprintf("tag_offset%d", j)).MustFloat64(0),
+				Unit:             section.Key(fmt.Sprintf("tag_unit%d", j)).String(),
+				Alarm:            iniTagAlarm(section, j),
+				Writable:         section.Key(fmt.Sprintf("tag_writable%d", j)).MustBool(false),
 			})
 		}
 
@@ -155,6 +241,106 @@ func (cm *ConfigManager) LoadIni(path string) *AppConfig {
 	return config
 }
 
+// iniOptionalFloat 读取可选的浮点配置项，未配置或格式错误时返回 nil
+func iniOptionalFloat(section *ini.Section, name string) *float64 {
+	if !section.HasKey(name) {
+		return nil
+	}
+	v, err := section.Key(name).Float64()
+	if err != nil {
+		return nil
+	}
+	return &v
+}
+
+// iniOptionalInt 读取可选的整数配置项，未配置或格式错误时返回 nil
+func iniOptionalInt(section *ini.Section, name string) *int {
+	if !section.HasKey(name) {
+		return nil
+	}
+	v, err := section.Key(name).Int()
+	if err != nil {
+		return nil
+	}
+	return &v
+}
+
+// iniTagAlarm 读取第 n 个点的报警规则（tag_alarm_*n），一项都未配置时返回 nil
+func iniTagAlarm(section *ini.Section, n int) *TagAlarm {
+	key := func(name string) string { return fmt.Sprintf("tag_alarm_%s%d", name, n) }
+	alarm := &TagAlarm{
+		HiHi:          iniOptionalFloat(section, key("hihi")),
+		Hi:            iniOptionalFloat(section, key("hi")),
+		Lo:            iniOptionalFloat(section, key("lo")),
+		LoLo:          iniOptionalFloat(section, key("lolo")),
+		RateOfChange:  iniOptionalFloat(section, key("roc")),
+		BadQuality:    section.Key(key("bad_quality")).MustBool(false),
+		StaleSecond:   section.Key(key("stale")).MustInt(0),
+		Deadband:      section.Key(key("deadband")).MustFloat64(0),
+		OnDelaySecond: section.Key(key("on_delay")).MustInt(0),
+	}
+	if *alarm == (TagAlarm{}) {
+		return nil
+	}
+	return alarm
+}
+
+// saveTagAlarm 写出第 n 个点的报警规则，只写已配置的项
+func saveTagAlarm(section *ini.Section, n int, alarm *TagAlarm) {
+	key := func(name string) string { return fmt.Sprintf("tag_alarm_%s%d", name, n) }
+	limits := []struct {
+		name  string
+		value *float64
+	}{{"hihi", alarm.HiHi}, {"hi", alarm.Hi}, {"lo", alarm.Lo}, {"lolo", alarm.LoLo}, {"roc", alarm.RateOfChange}}
+	for _, limit := range limits {
+		if limit.value != nil {
+			section.NewKey(key(limit.name), fmt.Sprintf("%v", *limit.value))
+		}
+	}
+	if alarm.BadQuality {
+		section.NewKey(key("bad_quality"), "true")
+	}
+	if alarm.StaleSecond > 0 {
+		section.NewKey(key("stale"), fmt.Sprintf("%d", alarm.StaleSecond))
+	}
+	if alarm.Deadband != 0 {
+		section.NewKey(key("deadband"), fmt.Sprintf("%v", alarm.Deadband))
+	}
+	if alarm.OnDelaySecond > 0 {
+		section.NewKey(key("on_delay"), fmt.Sprintf("%d", alarm.OnDelaySecond))
+	}
+}
+
+// iniFloatList 读取逗号分隔的 n 个浮点数（如 tag_scale1=0,27648,0,100），个数或格式不符时返回 nil
+func iniFloatList(section *ini.Section, name string, n int) []float64 {
+	if !section.HasKey(name) {
+		return nil
+	}
+	parts := strings.Split(section.Key(name).String(), ",")
+	if len(parts) != n {
+		fmt.Printf("[ConfigManager] ⚠️ [%s] %s 需要 %d 个逗号分隔的数值，已忽略\n", section.Name(), name, n)
+		return nil
+	}
+	values := make([]float64, n)
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			fmt.Printf("[ConfigManager] ⚠️ [%s] %s 第 %d 个数值无效，已忽略\n", section.Name(), name, i+1)
+			return nil
+		}
+		values[i] = v
+	}
+	return values
+}
+
+func joinFloats(values []float64) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return strings.Join(parts, ",")
+}
+
 // LoadJson 从JSON文件加载
 func (cm *ConfigManager) LoadJson(path string) *AppConfig {
 	data, err := ioutil.ReadFile(path)
@@ -167,6 +353,10 @@ func (cm *ConfigManager) LoadJson(path string) *AppConfig {
 		fmt.Printf("解析JSON配置失败: %v\n", err)
 		return nil
 	}
+	if config.BufferConfig != nil && !validOverflow(config.BufferConfig.Overflow) {
+		fmt.Printf("[ConfigManager] ❌ buffer.overflow=%s 无效，可选 drop_oldest / drop_newest\n", config.BufferConfig.Overflow)
+		return nil
+	}
 
 	return &config
 }
@@ -201,6 +391,24 @@ func (cm *ConfigManager) SaveIni(path string, config *AppConfig) error {
 		section.NewKey("format", config.MqttConfig.Format)
 		section.NewKey("js_transform", config.MqttConfig.JsTransform)
 		section.NewKey("split", fmt.Sprintf("%v", config.MqttConfig.Split))
+		section.NewKey("protocol", config.MqttConfig.Protocol)
+		section.NewKey("ws_path", config.MqttConfig.WsPath)
+		section.NewKey("tls_ca_file", config.MqttConfig.TlsCaFile)
+		section.NewKey("tls_cert_file", config.MqttConfig.TlsCertFile)
+		section.NewKey("tls_key_file", config.MqttConfig.TlsKeyFile)
+		section.NewKey("tls_insecure_skip_verify", fmt.Sprintf("%v", config.MqttConfig.TlsInsecureSkipVerify))
+		section.NewKey("tls_server_name", config.MqttConfig.TlsServerName)
+		section.NewKey("sparkplug_group_id", config.MqttConfig.SparkplugGroupId)
+		section.NewKey("sparkplug_edge_node_id", config.MqttConfig.SparkplugEdgeNodeId)
+		if config.MqttConfig.AlarmTopic != "" {
+			section.NewKey("alarm_topic", config.MqttConfig.AlarmTopic)
+		}
+		if config.MqttConfig.CommandTopic != "" {
+			section.NewKey("command_topic", config.MqttConfig.CommandTopic)
+		}
+		if config.MqttConfig.CommandAckTopic != "" {
+			section.NewKey("command_ack_topic", config.MqttConfig.CommandAckTopic)
+		}
 	}
 
 	for i, httpConfig := range config.HttpConfigs {
@@ -211,6 +419,12 @@ func (cm *ConfigManager) SaveIni(path string, config *AppConfig) error {
 		section.NewKey("url", httpConfig.Url)
 		section.NewKey("method", httpConfig.Method)
 		section.NewKey("timeout", fmt.Sprintf("%d", httpConfig.Timeout))
+		if httpConfig.Type != "" {
+			section.NewKey("type", httpConfig.Type)
+		}
+		if httpConfig.SimFile != "" {
+			section.NewKey("sim_file", httpConfig.SimFile)
+		}
 	}
 
 	if config.RtdbConfig != nil {
@@ -226,6 +440,36 @@ func (cm *ConfigManager) SaveIni(path string, config *AppConfig) error {
 		section.NewKey("enabled", fmt.Sprintf("%v", config.WebhookConfig.Enabled))
 		section.NewKey("url", config.WebhookConfig.Url)
 		section.NewKey("events", strings.Join(config.WebhookConfig.Events, ","))
+		if config.WebhookConfig.RepeatMinutes > 0 {
+			section.NewKey("repeat_minutes", fmt.Sprintf("%d", config.WebhookConfig.RepeatMinutes))
+		}
+		if config.WebhookConfig.Retries != nil {
+			section.NewKey("retries", fmt.Sprintf("%d", *config.WebhookConfig.Retries))
+		}
+	}
+
+	if config.MonitorConfig != nil {
+		section = cfg.Section("monitor")
+		section.NewKey("monitor", fmt.Sprintf("%v", config.MonitorConfig.Monitor))
+		section.NewKey("mode", config.MonitorConfig.Mode)
+		section.NewKey("email", config.MonitorConfig.Email)
+		section.NewKey("smtp_host", config.MonitorConfig.SmtpHost)
+		section.NewKey("smtp_port", fmt.Sprintf("%d", config.MonitorConfig.SmtpPort))
+		section.NewKey("smtp_security", config.MonitorConfig.SmtpSecurity)
+		section.NewKey("smtp_username", config.MonitorConfig.SmtpUsername)
+		section.NewKey("smtp_password", config.MonitorConfig.SmtpPassword)
+		section.NewKey("smtp_from", config.MonitorConfig.SmtpFrom)
+		section.NewKey("subject", config.MonitorConfig.Subject)
+		section.NewKey("events", strings.Join(config.MonitorConfig.Events, ","))
+	}
+
+	if config.BufferConfig != nil {
+		section = cfg.Section("buffer")
+		section.NewKey("enabled", fmt.Sprintf("%v", config.BufferConfig.Enabled))
+		section.NewKey("dir", config.BufferConfig.Dir)
+		section.NewKey("max_size_mb", fmt.Sprintf("%d", config.BufferConfig.MaxSizeMB))
+		section.NewKey("max_age_hours", fmt.Sprintf("%d", config.BufferConfig.MaxAgeHours))
+		section.NewKey("overflow", config.BufferConfig.Overflow)
 	}
 
 	for i, task := range config.Tasks {
@@ -234,10 +478,61 @@ func (cm *ConfigManager) SaveIni(path string, config *AppConfig) error {
 		section.NewKey("task", fmt.Sprintf("%v", task.Enabled))
 		section.NewKey("http_source", task.HttpSource)
 		section.NewKey("job_interval_second", fmt.Sprintf("%d", task.JobIntervalSecond))
+		if task.Strict {
+			section.NewKey("strict", "true")
+		}
+		if task.ReportByException {
+			section.NewKey("report_by_exception", "true")
+			section.NewKey("deadband", fmt.Sprintf("%v", task.Deadband))
+			section.NewKey("deadband_percent", fmt.Sprintf("%v", task.DeadbandPercent))
+			section.NewKey("max_silence_second", fmt.Sprintf("%d", task.MaxSilenceSecond))
+		}
+		if task.TimestampSource != "" {
+			section.NewKey("timestamp_source", task.TimestampSource)
+		}
+		if task.CollisionPolicy != "" {
+			section.NewKey("collision_policy", task.CollisionPolicy)
+		}
+		if task.TagPrecision != nil {
+			section.NewKey("tag_precision", fmt.Sprintf("%d", *task.TagPrecision))
+		}
 
 		for j, tag := range task.Tags {
 			section.NewKey(fmt.Sprintf("tag_opc%d", j+1), tag.OpcTag)
 			section.NewKey(fmt.Sprintf("tag_dbn%d", j+1), tag.DbName)
+			if tag.Deadband != nil {
+				section.NewKey(fmt.Sprintf("tag_deadband%d", j+1), fmt.Sprintf("%v", *tag.Deadband))
+			}
+			if tag.DeadbandPercent != nil {
+				section.NewKey(fmt.Sprintf("tag_deadband_pct%d", j+1), fmt.Sprintf("%v", *tag.DeadbandPercent))
+			}
+			if tag.MaxSilenceSecond != nil {
+				section.NewKey(fmt.Sprintf("tag_max_silence%d", j+1), fmt.Sprintf("%d", *tag.MaxSilenceSecond))
+			}
+			if len(tag.Scale) == 4 {
+				section.NewKey(fmt.Sprintf("tag_scale%d", j+1), joinFloats(tag.Scale))
+			}
+			if tag.Gain != nil {
+				section.NewKey(fmt.Sprintf("tag_gain%d", j+1), fmt.Sprintf("%v", *tag.Gain))
+			}
+			if tag.Offset != 0 {
+				section.NewKey(fmt.Sprintf("tag_offset%d", j+1), fmt.Sprintf("%v", tag.Offset))
+			}
+			if len(tag.Clamp) == 2 {
+				section.NewKey(fmt.Sprintf("tag_clamp%d", j+1), joinFloats(tag.Clamp))
+			}
+			if tag.Precision != nil {
+				section.NewKey(fmt.Sprintf("tag_precision%d", j+1), fmt.Sprintf("%d", *tag.Precision))
+			}
+			if tag.Unit != "" {
+				section.NewKey(fmt.Sprintf("tag_unit%d", j+1), tag.Unit)
+			}
+			if tag.Alarm != nil {
+				saveTagAlarm(section, j+1, tag.Alarm)
+			}
+			if tag.Writable {
+				section.NewKey(fmt.Sprintf("tag_writable%d", j+1), "true")
+			}
 		}
 	}
 
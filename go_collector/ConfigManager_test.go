@@ -0,0 +1,173 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func floatPtr(v float64) *float64 { return &v }
+func intPtr(v int) *int           { return &v }
+
+// fullTestConfig 返回各节都有非默认值的配置，用于往返测试
+func fullTestConfig() *AppConfig {
+	return &AppConfig{
+		Title:     "测试采集器",
+		OpcServer: "Kepware.KEPServerEX.V6",
+		HttpConfigs: []*HttpConfig{
+			{Name: "数据源1", Enabled: true, Url: "http://127.0.0.1:8080/api/data", Method: "GET", Timeout: 5},
+			{Name: "line2", Enabled: false, Url: "http://10.0.0.2:8080/api/stream", Method: "SSE", Timeout: 10},
+		},
+		MqttConfig: &MqttConfig{
+			Enabled: true, Broker: "broker.local", Port: 8883, Topic: "plant/{source}",
+			Username: "u", Password: "p", ClientId: "collector-1", Qos: 1, Retain: true,
+			Format: "custom", JsTransform: "return data;", Split: true,
+			Protocol: "ssl", WsPath: "/mqtt", TlsCaFile: "ca.pem", TlsCertFile: "c.pem", TlsKeyFile: "k.pem",
+			TlsInsecureSkipVerify: true, TlsServerName: "broker",
+			SparkplugGroupId: "g1", SparkplugEdgeNodeId: "n1", AlarmTopic: "alarm/{source}/{key}",
+			CommandTopic: "cmd/{source}/{key}", CommandAckTopic: "cmd-ack/{source}/{key}",
+		},
+		RtdbConfig:    &RtdbConfig{Enabled: true, Host: "127.0.0.1", Port: 9000, Format: "{key}={value}"},
+		WebhookConfig: &WebhookConfig{Enabled: true, Url: "http://hook", Events: []string{"mqtt_error", "alarm"}, RepeatMinutes: 5, Retries: intPtr(0)},
+		MonitorConfig: &MonitorConfig{
+			Monitor: true, Mode: MonitorModeEmail, Email: "a@x.com,b@x.com",
+			SmtpHost: "smtp.x.com", SmtpPort: 465, SmtpSecurity: SmtpSecuritySsl,
+			SmtpUsername: "bot@x.com", SmtpPassword: "secret", SmtpFrom: "bot@x.com",
+			Subject: "[{title}] {event}", Events: []string{"alarm"},
+		},
+		BufferConfig: &BufferConfig{Enabled: true, Dir: "buffer", MaxSizeMB: 64, MaxAgeHours: 24, Overflow: "drop_oldest"},
+		Tasks: []*TaskConfig{
+			{
+				Enabled: true, HttpSource: "数据源1", JobIntervalSecond: 2, Strict: true,
+				ReportByException: true, Deadband: 0.5, DeadbandPercent: 1.5, MaxSilenceSecond: 60,
+				TagPrecision: intPtr(2), TimestampSource: TimestampSourceCollector, CollisionPolicy: CollisionSuffix,
+				Tags: []*TagMapping{
+					{
+						OpcTag: "Channel1.Device1.T1", DbName: "t1",
+						Deadband: floatPtr(0.1), DeadbandPercent: floatPtr(2), MaxSilenceSecond: intPtr(30),
+						Scale: []float64{0, 27648, 0, 100}, Gain: floatPtr(1.5), Offset: -2, Clamp: []float64{0, 100},
+						Precision: intPtr(1), Unit: "℃", Writable: true,
+						Alarm: &TagAlarm{
+							HiHi: floatPtr(95), Hi: floatPtr(90), Lo: floatPtr(10), LoLo: floatPtr(5),
+							RateOfChange: floatPtr(3), BadQuality: true, StaleSecond: 120, Deadband: 1, OnDelaySecond: 5,
+						},
+					},
+					{OpcTag: "Channel1.Device1.T2", DbName: "t2"},
+				},
+			},
+			{Enabled: false, HttpSource: "line2", JobIntervalSecond: 5, Tags: []*TagMapping{{OpcTag: "A", DbName: "a"}}},
+		},
+	}
+}
+
+func TestConfigIniRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.ini")
+	cm := NewConfigManager()
+	want := fullTestConfig()
+	if err := cm.Save(path, want); err != nil {
+		t.Fatal(err)
+	}
+	got := cm.Load(path)
+	if got == nil {
+		t.Fatal("加载INI失败")
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("INI往返不一致:\n got: %s\nwant: %s", cm.ToJsonString(got), cm.ToJsonString(want))
+	}
+}
+
+func TestConfigJsonRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	cm := NewConfigManager()
+	want := fullTestConfig()
+	if err := cm.Save(path, want); err != nil {
+		t.Fatal(err)
+	}
+	got := cm.Load(path)
+	if got == nil {
+		t.Fatal("加载JSON失败")
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("JSON往返不一致:\n got: %s\nwant: %s", cm.ToJsonString(got), cm.ToJsonString(want))
+	}
+}
+
+func TestConfigIniInvalidValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.ini")
+	content := `[main]
+title = t
+
+[http]
+enabled = true
+url = http://127.0.0.1/api/data
+
+[monitor]
+monitor = true
+smtp_security = tls13
+
+[task1]
+task = true
+http_source = 数据源1
+timestamp_source = gps
+tag_opc1 = A
+tag_dbn1 = a
+tag_scale1 = 0,1,x,4
+tag_clamp1 = 1,2,3
+tag_gain1 = abc
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := NewConfigManager().LoadIni(path)
+	if config == nil {
+		t.Fatal("加载INI失败")
+	}
+	if len(config.HttpConfigs) != 1 || config.HttpConfigs[0].Name != "数据源1" {
+		t.Errorf("旧版 [http] 节应兼容为数据源1，得到 %+v", config.HttpConfigs)
+	}
+	if config.MonitorConfig.SmtpSecurity != "" {
+		t.Errorf("无效 smtp_security 应重置为空，得到 %q", config.MonitorConfig.SmtpSecurity)
+	}
+	task := config.Tasks[0]
+	if task.TimestampSource != TimestampSourceSource {
+		t.Errorf("无效 timestamp_source 应回退为 source，得到 %q", task.TimestampSource)
+	}
+	tag := task.Tags[0]
+	if tag.Scale != nil || tag.Clamp != nil || tag.Gain != nil {
+		t.Errorf("无效换算参数应忽略，得到 scale=%v clamp=%v gain=%v", tag.Scale, tag.Clamp, tag.Gain)
+	}
+	if tag.Alarm != nil {
+		t.Errorf("未配置报警时 Alarm 应为 nil")
+	}
+}
+
+func TestConfigLoadMissingFile(t *testing.T) {
+	cm := NewConfigManager()
+	dir := t.TempDir()
+	if cm.Load(filepath.Join(dir, "missing.ini")) != nil {
+		t.Error("INI 文件不存在时应返回 nil")
+	}
+	if cm.Load(filepath.Join(dir, "missing.json")) != nil {
+		t.Error("JSON 文件不存在时应返回 nil")
+	}
+}
+
+func TestConfigRejectsUnknownOverflow(t *testing.T) {
+	dir := t.TempDir()
+	cm := NewConfigManager()
+	iniPath := filepath.Join(dir, "config.ini")
+	if err := os.WriteFile(iniPath, []byte("[main]\ntitle = t\n\n[buffer]\nenabled = true\noverflow = drop_all\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cm.Load(iniPath) != nil {
+		t.Error("INI 中未知的 overflow 应拒绝加载")
+	}
+	jsonPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(jsonPath, []byte(`{"buffer": {"enabled": true, "overflow": "drop_all"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cm.Load(jsonPath) != nil {
+		t.Error("JSON 中未知的 overflow 应拒绝加载")
+	}
+}
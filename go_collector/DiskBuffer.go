@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	OverflowDropOldest = "drop_oldest"
+	OverflowDropNewest = "drop_newest"
+)
+
+// validOverflow 空值表示默认的 drop_oldest
+func validOverflow(overflow string) bool {
+	switch overflow {
+	case "", OverflowDropOldest, OverflowDropNewest:
+		return true
+	}
+	return false
+}
+
+// DiskBuffer 是单个输出端（MQTT / RTDB）的磁盘暂存队列。
+// 每批未送达的数据落成一个文件，文件名以入队时间（纳秒）开头，按文件名即可按时间顺序补发。
+type DiskBuffer struct {
+	name     string
+	dir      string
+	maxBytes int64
+	maxAge   time.Duration
+	overflow string
+
+	mu      sync.Mutex
+	entries []bufferEntry
+	size    int64
+	seq     int
+}
+
+type bufferEntry struct {
+	file string
+	size int64
+	ts   int64
+}
+
+// bufferedMessage 是落盘的报文结构，保留数据源以便补发时沿用原来的发布参数
+type bufferedMessage struct {
+	Source   string                            `json:"source"`
+	Queued   int64                             `json:"queued"`
+	Time     string                            `json:"timestamp"`
+	Values   map[string]interface{}            `json:"values"`
+	Metadata map[string]map[string]interface{} `json:"metadata"`
+}
+
+// NewDiskBuffer 创建（或重新打开）名为 name 的缓冲队列，已存在的积压文件会被加载。
+func NewDiskBuffer(config *BufferConfig, name string) (*DiskBuffer, error) {
+	dir := config.Dir
+	if dir == "" {
+		dir = "buffer"
+	}
+	b := &DiskBuffer{
+		name:     name,
+		dir:      filepath.Join(dir, name),
+		maxBytes: int64(config.MaxSizeMB) * 1024 * 1024,
+		maxAge:   time.Duration(config.MaxAgeHours) * time.Hour,
+		overflow: config.Overflow,
+	}
+	if !validOverflow(b.overflow) {
+		return nil, fmt.Errorf("未知的溢出策略: %s", b.overflow)
+	}
+	if b.overflow == "" {
+		b.overflow = OverflowDropOldest
+	}
+	if err := os.MkdirAll(b.dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建缓冲目录失败: %v", err)
+	}
+	if err := b.scan(); err != nil {
+		return nil, err
+	}
+	if len(b.entries) > 0 {
+		log.Printf("📦 %s缓冲区加载积压 %d 批 (%d 字节)", b.name, len(b.entries), b.size)
+	}
+	return b, nil
+}
+
+func (b *DiskBuffer) scan() error {
+	files, err := os.ReadDir(b.dir)
+	if err != nil {
+		return fmt.Errorf("读取缓冲目录失败: %v", err)
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		var ts int64
+		fmt.Sscanf(f.Name(), "%d_", &ts)
+		b.entries = append(b.entries, bufferEntry{file: f.Name(), size: info.Size(), ts: ts})
+		b.size += info.Size()
+	}
+	sort.Slice(b.entries, func(i, j int) bool { return b.entries[i].file < b.entries[j].file })
+	return nil
+}
+
+// Len 返回当前积压的批数
+func (b *DiskBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.entries)
+}
+
+// Size 返回当前积压占用的字节数
+func (b *DiskBuffer) Size() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.size
+}
+
+// Push 把一批数据写入缓冲；超出容量时按 overflow 策略丢弃最旧或最新的数据。
+func (b *DiskBuffer) Push(message map[string]interface{}, source string) error {
+	now := time.Now()
+	record := bufferedMessage{
+		Source: source,
+		Queued: now.UnixMilli(),
+	}
+	record.Time, _ = message["timestamp"].(string)
+	record.Values, _ = message["values"].(map[string]interface{})
+	record.Metadata, _ = message["metadata"].(map[string]map[string]interface{})
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("缓冲序列化失败: %v", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.expireLocked(now)
+	size := int64(len(data))
+	if b.maxBytes > 0 {
+		if size > b.maxBytes {
+			return fmt.Errorf("单批数据 %d 字节超过缓冲上限", size)
+		}
+		for b.size+size > b.maxBytes && len(b.entries) > 0 {
+			if b.overflow == OverflowDropNewest {
+				return fmt.Errorf("%s缓冲区已满，丢弃最新数据", b.name)
+			}
+			log.Printf("⚠️ %s缓冲区已满，丢弃最旧数据 %s", b.name, b.entries[0].file)
+			b.removeLocked(0)
+		}
+	}
+
+	b.seq++
+	name := fmt.Sprintf("%019d_%06d.json", now.UnixNano(), b.seq%1000000)
+	if err := os.WriteFile(filepath.Join(b.dir, name), data, 0644); err != nil {
+		return fmt.Errorf("写入缓冲文件失败: %v", err)
+	}
+	b.entries = append(b.entries, bufferEntry{file: name, size: size, ts: now.UnixNano()})
+	b.size += size
+	return nil
+}
+
+// Replay 按时间顺序逐批补发，send 返回错误时停止并保留剩余数据，返回已补发的批数。
+func (b *DiskBuffer) Replay(send func(message map[string]interface{}, source string) error) (int, error) {
+	sent := 0
+	for {
+		b.mu.Lock()
+		b.expireLocked(time.Now())
+		if len(b.entries) == 0 {
+			b.mu.Unlock()
+			return sent, nil
+		}
+		entry := b.entries[0]
+		b.mu.Unlock()
+
+		message, source, err := b.read(entry)
+		if err != nil {
+			log.Printf("⚠️ %s缓冲文件损坏，已丢弃 %s: %v", b.name, entry.file, err)
+			b.drop(entry.file)
+			continue
+		}
+		if err := send(message, source); err != nil {
+			// 部分送出时把该批改写为剩余的点，下次只补发剩余部分
+			var partial *partialSendError
+			if errors.As(err, &partial) {
+				b.rewrite(entry, unsentMessage(message, err), source)
+			}
+			return sent, err
+		}
+		b.drop(entry.file)
+		sent++
+	}
+}
+
+func (b *DiskBuffer) read(entry bufferEntry) (map[string]interface{}, string, error) {
+	data, err := os.ReadFile(filepath.Join(b.dir, entry.file))
+	if err != nil {
+		return nil, "", err
+	}
+	var record bufferedMessage
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, "", err
+	}
+	// JSON 反序列化后数字均为 float64，这里还原成发送端约定的类型
+	for _, meta := range record.Metadata {
+		if q, ok := meta["quality"].(float64); ok {
+			meta["quality"] = int(q)
+		}
+		if t, ok := meta["timestamp"].(float64); ok {
+			meta["timestamp"] = int64(t)
+		}
+	}
+	message := map[string]interface{}{
+		"timestamp": record.Time,
+		"values":    record.Values,
+		"metadata":  record.Metadata,
+	}
+	return message, record.Source, nil
+}
+
+// rewrite 用剩余的数据覆盖一批积压，保留原来的排队位置
+func (b *DiskBuffer) rewrite(entry bufferEntry, message map[string]interface{}, source string) {
+	record := bufferedMessage{Source: source, Queued: entry.ts / int64(time.Millisecond)}
+	record.Time, _ = message["timestamp"].(string)
+	record.Values, _ = message["values"].(map[string]interface{})
+	record.Metadata = messageMetadata(message)
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, e := range b.entries {
+		if e.file != entry.file {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(b.dir, e.file), data, 0644); err != nil {
+			log.Printf("⚠️ %s缓冲文件改写失败 %s: %v", b.name, e.file, err)
+			return
+		}
+		b.size += int64(len(data)) - e.size
+		b.entries[i].size = int64(len(data))
+		return
+	}
+}
+
+func (b *DiskBuffer) drop(file string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, e := range b.entries {
+		if e.file == file {
+			b.removeLocked(i)
+			return
+		}
+	}
+}
+
+func (b *DiskBuffer) removeLocked(i int) {
+	entry := b.entries[i]
+	os.Remove(filepath.Join(b.dir, entry.file))
+	b.size -= entry.size
+	b.entries = append(b.entries[:i], b.entries[i+1:]...)
+}
+
+// expireLocked 清理超过 max_age 的积压
+func (b *DiskBuffer) expireLocked(now time.Time) {
+	if b.maxAge <= 0 {
+		return
+	}
+	cutoff := now.Add(-b.maxAge).UnixNano()
+	expired := 0
+	for len(b.entries) > 0 && b.entries[0].ts < cutoff {
+		b.removeLocked(0)
+		expired++
+	}
+	if expired > 0 {
+		log.Printf("⚠️ %s缓冲区丢弃 %d 批过期数据", b.name, expired)
+	}
+}
+
+// partialSendError 表示一批数据只送出了一部分，remaining 为未送出的发布键
+type partialSendError struct {
+	err       error
+	remaining []string
+}
+
+func (e *partialSendError) Error() string { return e.err.Error() }
+
+func (e *partialSendError) Unwrap() error { return e.err }
+
+// unsentPayloads 在第 failed 条报文发送失败时返回错误；其后的报文都按点拆分时带上未送出的点
+func unsentPayloads(payloads []mqttMessage, failed int, err error) error {
+	if failed == 0 {
+		return err
+	}
+	var remaining []string
+	for _, payload := range payloads[failed:] {
+		if payload.Keys == nil {
+			return err
+		}
+		remaining = append(remaining, payload.Keys...)
+	}
+	return &partialSendError{err: err, remaining: remaining}
+}
+
+// unsentMessage 返回发送失败后仍需缓冲的数据：部分送出时只保留未送出的点，否则为整批
+func unsentMessage(message map[string]interface{}, err error) map[string]interface{} {
+	var partial *partialSendError
+	if !errors.As(err, &partial) {
+		return message
+	}
+	values, _ := message["values"].(map[string]interface{})
+	metadata := messageMetadata(message)
+	subset := make(map[string]interface{}, len(partial.remaining))
+	subsetMeta := make(map[string]map[string]interface{}, len(partial.remaining))
+	for _, key := range partial.remaining {
+		if value, ok := values[key]; ok {
+			subset[key] = value
+		}
+		if meta, ok := metadata[key]; ok {
+			subsetMeta[key] = meta
+		}
+	}
+	return map[string]interface{}{
+		"timestamp": message["timestamp"],
+		"values":    subset,
+		"metadata":  subsetMeta,
+	}
+}
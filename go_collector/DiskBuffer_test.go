@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func bufferMessage(values map[string]interface{}) map[string]interface{} {
+	metadata := make(map[string]map[string]interface{}, len(values))
+	for key := range values {
+		metadata[key] = map[string]interface{}{"quality": 192, "timestamp": int64(1700000000000)}
+	}
+	return map[string]interface{}{"timestamp": "2024-01-01 00:00:00", "values": values, "metadata": metadata}
+}
+
+func replayAll(t *testing.T, b *DiskBuffer) []map[string]interface{} {
+	t.Helper()
+	var got []map[string]interface{}
+	if _, err := b.Replay(func(message map[string]interface{}, source string) error {
+		got = append(got, message["values"].(map[string]interface{}))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestDiskBufferReplayOrder(t *testing.T) {
+	config := &BufferConfig{Dir: t.TempDir()}
+	b, err := NewDiskBuffer(config, "rtdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		if err := b.Push(bufferMessage(map[string]interface{}{"A": float64(i)}), "line1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 重新打开后加载已有积压
+	b, err = NewDiskBuffer(config, "rtdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Len() != 3 || b.Size() == 0 {
+		t.Fatalf("重新打开后积压 = %d 批 %d 字节", b.Len(), b.Size())
+	}
+
+	// 发送失败时停止并保留剩余数据
+	calls := 0
+	sent, err := b.Replay(func(message map[string]interface{}, source string) error {
+		calls++
+		if calls == 2 {
+			return errors.New("断开")
+		}
+		if source != "line1" {
+			t.Errorf("source = %s", source)
+		}
+		if q := message["metadata"].(map[string]map[string]interface{})["A"]["quality"]; q != 192 {
+			t.Errorf("quality = %#v", q)
+		}
+		return nil
+	})
+	if sent != 1 || err == nil || b.Len() != 2 {
+		t.Fatalf("sent = %d, err = %v, len = %d", sent, err, b.Len())
+	}
+
+	got := replayAll(t, b)
+	if len(got) != 2 || got[0]["A"] != float64(2) || got[1]["A"] != float64(3) {
+		t.Errorf("补发顺序 = %v", got)
+	}
+	if b.Len() != 0 || b.Size() != 0 {
+		t.Errorf("补发后积压 = %d 批 %d 字节", b.Len(), b.Size())
+	}
+}
+
+func TestDiskBufferOverflow(t *testing.T) {
+	one := bufferMessage(map[string]interface{}{"A": 1.0})
+	for _, overflow := range []string{OverflowDropOldest, OverflowDropNewest} {
+		b, err := NewDiskBuffer(&BufferConfig{Dir: t.TempDir(), Overflow: overflow}, "mqtt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Push(one, ""); err != nil {
+			t.Fatal(err)
+		}
+		// 容量只够放下两批
+		b.maxBytes = b.Size()*2 + b.Size()/2
+		b.Push(bufferMessage(map[string]interface{}{"A": 2.0}), "")
+		err = b.Push(bufferMessage(map[string]interface{}{"A": 3.0}), "")
+
+		got := replayAll(t, b)
+		want := []float64{2, 3}
+		if overflow == OverflowDropNewest {
+			want = []float64{1, 2}
+			if err == nil {
+				t.Errorf("%s: 缓冲区已满时应返回错误", overflow)
+			}
+		}
+		if len(got) != 2 || got[0]["A"] != want[0] || got[1]["A"] != want[1] {
+			t.Errorf("%s: 补发 = %v, want %v", overflow, got, want)
+		}
+	}
+
+	if _, err := NewDiskBuffer(&BufferConfig{Dir: t.TempDir(), Overflow: "drop_all"}, "mqtt"); err == nil {
+		t.Error("未知的溢出策略应返回错误")
+	}
+}
+
+func TestDiskBufferExpire(t *testing.T) {
+	b, err := NewDiskBuffer(&BufferConfig{Dir: t.TempDir(), MaxAgeHours: 1}, "rtdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Push(bufferMessage(map[string]interface{}{"A": 1.0}), "")
+	b.Push(bufferMessage(map[string]interface{}{"A": 2.0}), "")
+	b.entries[0].ts = time.Now().Add(-2 * time.Hour).UnixNano()
+
+	got := replayAll(t, b)
+	if len(got) != 1 || got[0]["A"] != 2.0 {
+		t.Errorf("过期后补发 = %v", got)
+	}
+	if files, _ := os.ReadDir(b.dir); len(files) != 0 {
+		t.Errorf("过期文件未删除: %d", len(files))
+	}
+}
+
+func TestDiskBufferPartialReplay(t *testing.T) {
+	b, err := NewDiskBuffer(&BufferConfig{Dir: t.TempDir()}, "rtdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Push(bufferMessage(map[string]interface{}{"A": 1.0, "B": 2.0, "C": 3.0}), "line1")
+	before := b.Size()
+
+	// 只送出 A，剩余的 B、C 改写回原批次
+	_, err = b.Replay(func(message map[string]interface{}, source string) error {
+		return &partialSendError{err: errors.New("断开"), remaining: []string{"B", "C"}}
+	})
+	if err == nil || b.Len() != 1 || b.Size() >= before {
+		t.Fatalf("err = %v, len = %d, size = %d → %d", err, b.Len(), before, b.Size())
+	}
+	if info, _ := os.Stat(filepath.Join(b.dir, b.entries[0].file)); info.Size() != b.Size() {
+		t.Errorf("文件大小 %d 与记录 %d 不一致", info.Size(), b.Size())
+	}
+
+	var source string
+	var metadata map[string]map[string]interface{}
+	got := replayAll(t, b)
+	b.Push(bufferMessage(map[string]interface{}{"D": 4.0}), "line1")
+	b.Replay(func(message map[string]interface{}, s string) error {
+		source = s
+		metadata = message["metadata"].(map[string]map[string]interface{})
+		return nil
+	})
+	if len(got) != 1 || !reflect.DeepEqual(got[0], map[string]interface{}{"B": 2.0, "C": 3.0}) {
+		t.Errorf("剩余数据 = %v", got)
+	}
+	if source != "line1" || metadata["D"]["quality"] != 192 {
+		t.Errorf("source = %s, metadata = %v", source, metadata)
+	}
+}
+
+func TestUnsentPayloads(t *testing.T) {
+	failure := errors.New("断开")
+	split := []mqttMessage{{Keys: []string{"A"}}, {Keys: []string{"B"}}, {Keys: []string{"C"}}}
+
+	// 第一条就失败时整批重新缓冲
+	if err := unsentPayloads(split, 0, failure); err != failure {
+		t.Errorf("首条失败 err = %v", err)
+	}
+	// 整批报文（没有按点拆分）无法区分已送出的点
+	if err := unsentPayloads([]mqttMessage{{Keys: []string{"A"}}, {}}, 1, failure); err != failure {
+		t.Errorf("整批报文 err = %v", err)
+	}
+
+	err := unsentPayloads(split, 1, failure)
+	var partial *partialSendError
+	if !errors.As(err, &partial) || !errors.Is(err, failure) || !reflect.DeepEqual(partial.remaining, []string{"B", "C"}) {
+		t.Fatalf("部分送出 err = %#v", err)
+	}
+
+	message := bufferMessage(map[string]interface{}{"A": 1.0, "B": 2.0, "C": 3.0})
+	rest := unsentMessage(message, err)
+	if !reflect.DeepEqual(rest["values"], map[string]interface{}{"B": 2.0, "C": 3.0}) || len(messageMetadata(rest)) != 2 {
+		t.Errorf("剩余数据 = %v", rest)
+	}
+	if rest["timestamp"] != message["timestamp"] {
+		t.Errorf("timestamp = %v", rest["timestamp"])
+	}
+	if unsent := unsentMessage(message, failure); !reflect.DeepEqual(unsent, message) {
+		t.Errorf("整批失败应原样缓冲: %v", unsent)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EmailChannel 通过 SMTP 发送告警邮件，由 [monitor] mode=email 启用
+
+const defaultEmailSubject = "[{title}] {event} {subject}"
+
+type EmailChannel struct {
+	host     string
+	port     int
+	security string
+	username string
+	password string
+	from     string
+	to       []string
+	subject  string
+	title    string
+	events   map[string]bool
+	timeout  time.Duration
+}
+
+// NewEmailChannel 校验配置并创建邮件通道；title 用于标题模板中的 {title}
+func NewEmailChannel(config *MonitorConfig, title string) (*EmailChannel, error) {
+	if config.SmtpHost == "" {
+		return nil, fmt.Errorf("未配置 smtp_host")
+	}
+	var to []string
+	for _, addr := range strings.FieldsFunc(config.Email, func(r rune) bool { return r == ',' || r == ';' }) {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			to = append(to, addr)
+		}
+	}
+	if len(to) == 0 {
+		return nil, fmt.Errorf("未配置收件人 email")
+	}
+	from := config.SmtpFrom
+	if from == "" {
+		from = config.SmtpUsername
+	}
+	if from == "" {
+		return nil, fmt.Errorf("未配置发件人 smtp_from")
+	}
+
+	ch := &EmailChannel{
+		host:     config.SmtpHost,
+		port:     config.SmtpPort,
+		security: config.SmtpSecurity,
+		username: config.SmtpUsername,
+		password: config.SmtpPassword,
+		from:     from,
+		to:       to,
+		subject:  config.Subject,
+		title:    title,
+		events:   eventSet(config.Events),
+		timeout:  15 * time.Second,
+	}
+	if ch.security == "" && ch.port == 465 {
+		ch.security = SmtpSecuritySsl
+	}
+	if ch.port <= 0 {
+		ch.port = 25
+		if ch.security == SmtpSecuritySsl {
+			ch.port = 465
+		}
+	}
+	if ch.subject == "" {
+		ch.subject = defaultEmailSubject
+	}
+	if ch.title == "" {
+		ch.title = "OPC采集器"
+	}
+	return ch, nil
+}
+
+func (ch *EmailChannel) Name() string { return "邮件" }
+
+func (ch *EmailChannel) Accepts(eventType string) bool {
+	return ch.events == nil || ch.events[eventType]
+}
+
+func (ch *EmailChannel) Send(e Event) error {
+	addr := net.JoinHostPort(ch.host, strconv.Itoa(ch.port))
+	dialer := &net.Dialer{Timeout: ch.timeout}
+	var conn net.Conn
+	var err error
+	if ch.security == SmtpSecuritySsl {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: ch.host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("连接SMTP服务器失败: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(ch.timeout))
+
+	client, err := smtp.NewClient(conn, ch.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP握手失败: %w", err)
+	}
+	defer client.Close()
+
+	// 未指定加密方式时，服务器支持 STARTTLS 就升级；指定 starttls 时不支持则报错
+	if ch.security != SmtpSecuritySsl && ch.security != SmtpSecurityNone {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: ch.host}); err != nil {
+				return fmt.Errorf("STARTTLS失败: %w", err)
+			}
+		} else if ch.security == SmtpSecurityStartTls {
+			return fmt.Errorf("SMTP服务器不支持STARTTLS")
+		}
+	}
+	// PlainAuth 只允许在加密连接或本机地址上发送口令
+	if ch.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", ch.username, ch.password, ch.host)); err != nil {
+			return fmt.Errorf("SMTP认证失败: %w", err)
+		}
+	}
+
+	if err := client.Mail(ch.from); err != nil {
+		return fmt.Errorf("发件人被拒绝: %w", err)
+	}
+	for _, to := range ch.to {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("收件人 %s 被拒绝: %w", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(ch.buildMessage(e, time.Now())); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// renderSubject 渲染标题模板，去掉换行防止头部注入
+func (ch *EmailChannel) renderSubject(e Event) string {
+	subject := strings.NewReplacer(
+		"{title}", ch.title,
+		"{event}", e.Type,
+		"{subject}", e.Subject,
+		"{severity}", e.Severity,
+		"{message}", e.Message,
+		"{time}", e.Time,
+	).Replace(ch.subject)
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(subject)
+}
+
+// buildMessage 生成 UTF-8 纯文本邮件，标题按 RFC 2047 编码，正文 base64
+func (ch *EmailChannel) buildMessage(e Event, now time.Time) []byte {
+	var body strings.Builder
+	fmt.Fprintf(&body, "事件: %s\r\n", e.Type)
+	fmt.Fprintf(&body, "对象: %s\r\n", e.Subject)
+	fmt.Fprintf(&body, "级别: %s\r\n", e.Severity)
+	fmt.Fprintf(&body, "时间: %s\r\n", e.Time)
+	fmt.Fprintf(&body, "内容: %s\r\n", e.Message)
+	if e.Count > 0 {
+		fmt.Fprintf(&body, "累计次数: %d\r\n", e.Count)
+	}
+	if e.DurationSeconds > 0 {
+		fmt.Fprintf(&body, "持续时间: %d 秒\r\n", e.DurationSeconds)
+	}
+	fmt.Fprintf(&body, "来源: opc_collector (%s)\r\n", ch.title)
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", ch.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(ch.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", ch.renderSubject(e)))
+	fmt.Fprintf(&msg, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(body.String()))
+	for len(encoded) > 76 {
+		msg.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	msg.WriteString(encoded + "\r\n")
+	return msg.Bytes()
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewEmailChannelValidation(t *testing.T) {
+	cases := []struct {
+		name   string
+		config MonitorConfig
+	}{
+		{"缺少smtp_host", MonitorConfig{Email: "a@x.com", SmtpFrom: "bot@x.com"}},
+		{"缺少收件人", MonitorConfig{SmtpHost: "smtp.x.com", Email: " , ", SmtpFrom: "bot@x.com"}},
+		{"缺少发件人", MonitorConfig{SmtpHost: "smtp.x.com", Email: "a@x.com"}},
+	}
+	for _, tc := range cases {
+		if _, err := NewEmailChannel(&tc.config, ""); err == nil {
+			t.Errorf("%s: 应返回错误", tc.name)
+		}
+	}
+
+	ch, err := NewEmailChannel(&MonitorConfig{SmtpHost: "smtp.x.com", SmtpPort: 465, Email: "a@x.com; b@x.com", SmtpUsername: "bot@x.com"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ch.security != SmtpSecuritySsl || ch.from != "bot@x.com" || !reflect.DeepEqual(ch.to, []string{"a@x.com", "b@x.com"}) {
+		t.Errorf("默认值推断错误: security=%s from=%s to=%v", ch.security, ch.from, ch.to)
+	}
+}
+
+func TestEmailChannelSend(t *testing.T) {
+	server := newFakeSmtp(t)
+	ch, err := NewEmailChannel(&MonitorConfig{
+		SmtpHost: "127.0.0.1", SmtpPort: server.port(), SmtpSecurity: SmtpSecurityNone,
+		SmtpUsername: "bot@x.com", SmtpPassword: "secret", Email: "ops@x.com",
+	}, "一号线")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := Event{Type: EventMqttError, Subject: "mqtt", Severity: SeverityError, Message: "连接断开\r\nBcc: evil@x.com", Time: "2026-01-02T03:04:05+08:00", Count: 3}
+	if err := ch.Send(e); err != nil {
+		t.Fatal(err)
+	}
+
+	var mail smtpMail
+	select {
+	case mail = <-server.mail:
+	case <-time.After(5 * time.Second):
+		t.Fatal("SMTP服务端未收到邮件")
+	}
+	if mail.From != "bot@x.com" || !reflect.DeepEqual(mail.To, []string{"ops@x.com"}) {
+		t.Errorf("信封 from=%s to=%v", mail.From, mail.To)
+	}
+	auth, _ := base64.StdEncoding.DecodeString(mail.Auth)
+	if string(auth) != "\x00bot@x.com\x00secret" {
+		t.Errorf("PLAIN认证内容 = %q", auth)
+	}
+
+	header, body, _ := strings.Cut(mail.Data, "\r\n\r\n")
+	var subject string
+	for _, line := range strings.Split(header, "\r\n") {
+		if strings.HasPrefix(line, "Subject: ") {
+			subject, _ = new(mime.WordDecoder).DecodeHeader(strings.TrimPrefix(line, "Subject: "))
+		}
+		if strings.HasPrefix(line, "Bcc:") {
+			t.Errorf("邮件头被注入: %s", line)
+		}
+	}
+	if subject != "[一号线] mqtt_error mqtt" {
+		t.Errorf("标题 = %q", subject)
+	}
+	text, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(body, "\r\n", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"事件: mqtt_error", "对象: mqtt", "累计次数: 3"} {
+		if !strings.Contains(string(text), want) {
+			t.Errorf("正文缺少 %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestSmtpPasswordMasked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.ini")
+	ws := NewWebServer(path, nil)
+	if err := ws.configManager.Save(path, &AppConfig{MonitorConfig: &MonitorConfig{Monitor: true, SmtpHost: "smtp.x.com", SmtpPassword: "secret"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	ws.handleGetConfig(rec, httptest.NewRequest("GET", "/api/config", nil))
+	if body := rec.Body.String(); strings.Contains(body, "secret") || !strings.Contains(body, maskedPassword) {
+		t.Errorf("配置接口不应返回明文密码: %s", body)
+	}
+
+	save := func(password string) string {
+		t.Helper()
+		body := `{"monitor": {"smtp_password": "` + password + `"}}`
+		ws.handleUpdateConfig(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/config", strings.NewReader(body)))
+		return ws.configManager.Load(path).MonitorConfig.SmtpPassword
+	}
+	// 提交占位符或空值时沿用原密码
+	if got := save(maskedPassword); got != "secret" {
+		t.Errorf("提交占位符后密码 = %q", got)
+	}
+	if got := save(""); got != "secret" {
+		t.Errorf("提交空值后密码 = %q", got)
+	}
+	if got := save("changed"); got != "changed" {
+		t.Errorf("修改后密码 = %q", got)
+	}
+
+	// 显式清除
+	ws.handleUpdateConfig(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/config",
+		strings.NewReader(`{"monitor": {"smtp_password": "********", "smtp_password_clear": true}}`)))
+	if got := ws.configManager.Load(path).MonitorConfig.SmtpPassword; got != "" {
+		t.Errorf("清除后密码 = %q", got)
+	}
+}
+
+func TestEmailTestKeepsStoredPasswordOnSameServer(t *testing.T) {
+	saved := newFakeSmtp(t)
+	other := newFakeSmtp(t)
+	path := filepath.Join(t.TempDir(), "config.ini")
+	ws := NewWebServer(path, nil)
+	if err := ws.configManager.Save(path, &AppConfig{MonitorConfig: &MonitorConfig{
+		SmtpHost: "127.0.0.1", SmtpPort: saved.port(), SmtpSecurity: SmtpSecurityNone,
+		SmtpUsername: "bot@x.com", SmtpPassword: "secret", Email: "ops@x.com",
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	send := func(port int, username, password string) map[string]interface{} {
+		t.Helper()
+		body := fmt.Sprintf(`{"smtp_host": "127.0.0.1", "smtp_port": %d, "smtp_security": "none", "smtp_username": %q, "smtp_password": %q, "email": "ops@x.com"}`,
+			port, username, password)
+		rec := httptest.NewRecorder()
+		ws.handleEmailTest(rec, httptest.NewRequest("POST", "/api/email/test", strings.NewReader(body)))
+		var result map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		return result
+	}
+
+	// 服务器或用户名变化时不使用已保存的密码
+	for _, c := range []struct {
+		port     int
+		username string
+	}{{other.port(), "bot@x.com"}, {saved.port(), "evil@x.com"}} {
+		result := send(c.port, c.username, maskedPassword)
+		if result["success"] != false || !strings.Contains(result["message"].(string), "请重新输入密码") {
+			t.Errorf("port=%d username=%s 结果 = %v", c.port, c.username, result)
+		}
+	}
+	select {
+	case mail := <-other.mail:
+		t.Fatalf("其他服务器收到了邮件 auth=%s", mail.Auth)
+	case mail := <-saved.mail:
+		t.Fatalf("用户名变化后仍发送了邮件 auth=%s", mail.Auth)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// 同一服务器与账号沿用已保存的密码
+	if result := send(saved.port(), "bot@x.com", maskedPassword); result["success"] != true {
+		t.Fatalf("结果 = %v", result)
+	}
+	select {
+	case mail := <-saved.mail:
+		if auth, _ := base64.StdEncoding.DecodeString(mail.Auth); string(auth) != "\x00bot@x.com\x00secret" {
+			t.Errorf("PLAIN认证内容 = %q", auth)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("SMTP服务端未收到邮件")
+	}
+}
@@ -0,0 +1,611 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 测试替身：C# 采集代理（/api/data、/api/stream）、最小 MQTT Broker、RTDB TCP 监听端、SMTP 服务端。
+
+// waitFor 轮询直到 cond 成立，超时则报错
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待超时: %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// fakeAgent 模拟 C# 采集代理：/api/data 返回当前点列表，/api/stream 以 SSE 推送 push 的数据，
+// /api/write 记录收到的写入请求
+type fakeAgent struct {
+	server *httptest.Server
+
+	mu             sync.Mutex
+	points         []map[string]interface{}
+	failData       bool
+	failWrite      string
+	writes         []agentWrite
+	streams        map[chan string]struct{}
+	streamConnects int
+	closed         bool
+}
+
+type agentWrite struct {
+	NodeId string      `json:"node_id"`
+	Value  interface{} `json:"value"`
+}
+
+func newFakeAgent(t *testing.T) *fakeAgent {
+	a := &fakeAgent{streams: make(map[chan string]struct{})}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/data", a.handleData)
+	mux.HandleFunc("/api/stream", a.handleStream)
+	mux.HandleFunc("/api/write", a.handleWrite)
+	a.server = httptest.NewServer(mux)
+	t.Cleanup(a.close)
+	return a
+}
+
+func (a *fakeAgent) url(path string) string {
+	return a.server.URL + path
+}
+
+// setPoints 设置 /api/data 返回的点列表，每项为 {key, value, quality, timestamp}
+func (a *fakeAgent) setPoints(points ...map[string]interface{}) {
+	a.mu.Lock()
+	a.points = points
+	a.mu.Unlock()
+}
+
+func (a *fakeAgent) setFailData(fail bool) {
+	a.mu.Lock()
+	a.failData = fail
+	a.mu.Unlock()
+}
+
+func (a *fakeAgent) handleData(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	resp := map[string]interface{}{"success": true, "data": a.points}
+	if a.failData {
+		resp = map[string]interface{}{"success": false, "message": "OPC服务器未连接"}
+	}
+	a.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// setFailWrite 设置后 /api/write 以该消息返回失败，空串恢复成功
+func (a *fakeAgent) setFailWrite(message string) {
+	a.mu.Lock()
+	a.failWrite = message
+	a.mu.Unlock()
+}
+
+func (a *fakeAgent) handleWrite(w http.ResponseWriter, r *http.Request) {
+	var req agentWrite
+	if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&req) != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	a.mu.Lock()
+	resp := map[string]interface{}{"success": true, "message": "写入成功"}
+	if a.failWrite != "" {
+		resp = map[string]interface{}{"success": false, "message": a.failWrite}
+	} else {
+		a.writes = append(a.writes, req)
+	}
+	a.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// written 返回已成功写入的请求
+func (a *fakeAgent) written() []agentWrite {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]agentWrite(nil), a.writes...)
+}
+
+func (a *fakeAgent) handleStream(w http.ResponseWriter, r *http.Request) {
+	flusher := w.(http.Flusher)
+	ch := make(chan string, 16)
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		http.Error(w, "closed", http.StatusServiceUnavailable)
+		return
+	}
+	a.streams[ch] = struct{}{}
+	a.streamConnects++
+	a.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			a.mu.Lock()
+			delete(a.streams, ch)
+			a.mu.Unlock()
+			return
+		case payload, ok := <-ch:
+			if !ok {
+				return
+			}
+			fmt.Fprintf(w, "data: %s\n\n", payload)
+			flusher.Flush()
+		}
+	}
+}
+
+// push 向所有 SSE 连接推送一批点，格式同代理的 {ts, values: [{key, value, quality}]}
+func (a *fakeAgent) push(values ...map[string]interface{}) {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"ts":     time.Now().Format(time.RFC3339Nano),
+		"values": values,
+	})
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for ch := range a.streams {
+		ch <- string(payload)
+	}
+}
+
+// dropStreams 由服务端关闭全部 SSE 连接，模拟代理重启
+func (a *fakeAgent) dropStreams() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for ch := range a.streams {
+		close(ch)
+		delete(a.streams, ch)
+	}
+}
+
+func (a *fakeAgent) connects() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.streamConnects
+}
+
+func (a *fakeAgent) activeStreams() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.streams)
+}
+
+func (a *fakeAgent) close() {
+	a.mu.Lock()
+	a.closed = true
+	a.mu.Unlock()
+	a.dropStreams()
+	a.server.CloseClientConnections()
+	a.server.Close()
+}
+
+// point 构造一条代理点数据
+func point(key string, value interface{}) map[string]interface{} {
+	return map[string]interface{}{"key": key, "value": value, "quality": "Good"}
+}
+
+// brokerMessage 是 fakeBroker 收到的一条 PUBLISH
+type brokerMessage struct {
+	Topic   string
+	Payload string
+	Qos     byte
+	Retain  bool
+}
+
+type brokerConn struct {
+	conn    net.Conn
+	mu      sync.Mutex
+	filters []string
+}
+
+func (c *brokerConn) write(packet []byte) {
+	c.mu.Lock()
+	c.conn.Write(packet)
+	c.mu.Unlock()
+}
+
+// fakeBroker 是最小的 MQTT 3.1.1 服务端：CONNECT / PUBLISH(QoS 0~2) / SUBSCRIBE / PINGREQ / DISCONNECT，
+// 记录收到的全部发布，并转发给通配符匹配的订阅者（以 QoS 0）
+type fakeBroker struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	messages []brokerMessage
+	conns    map[*brokerConn]struct{}
+	connects int
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBroker{ln: ln, conns: make(map[*brokerConn]struct{})}
+	go b.serve()
+	t.Cleanup(b.close)
+	return b
+}
+
+func (b *fakeBroker) port() int {
+	return b.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (b *fakeBroker) serve() {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(&brokerConn{conn: conn})
+	}
+}
+
+func (b *fakeBroker) handle(c *brokerConn) {
+	b.mu.Lock()
+	b.conns[c] = struct{}{}
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.conns, c)
+		b.mu.Unlock()
+		c.conn.Close()
+	}()
+
+	r := bufio.NewReader(c.conn)
+	for {
+		header, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		length, err := readMqttLength(r)
+		if err != nil {
+			return
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return
+		}
+
+		switch header >> 4 {
+		case 1: // CONNECT
+			b.mu.Lock()
+			b.connects++
+			b.mu.Unlock()
+			c.write([]byte{0x20, 0x02, 0x00, 0x00})
+		case 3: // PUBLISH
+			qos := (header >> 1) & 0x03
+			topicLen := int(body[0])<<8 | int(body[1])
+			msg := brokerMessage{Topic: string(body[2 : 2+topicLen]), Qos: qos, Retain: header&0x01 == 1}
+			rest := body[2+topicLen:]
+			if qos > 0 {
+				id := rest[:2]
+				rest = rest[2:]
+				if qos == 1 {
+					c.write([]byte{0x40, 0x02, id[0], id[1]})
+				} else {
+					c.write([]byte{0x50, 0x02, id[0], id[1]})
+				}
+			}
+			msg.Payload = string(rest)
+			b.mu.Lock()
+			b.messages = append(b.messages, msg)
+			b.mu.Unlock()
+			b.forward(msg.Topic, rest)
+		case 6: // PUBREL
+			c.write([]byte{0x70, 0x02, body[0], body[1]})
+		case 8: // SUBSCRIBE
+			ack := []byte{body[0], body[1]}
+			for rest := body[2:]; len(rest) >= 3; {
+				n := int(rest[0])<<8 | int(rest[1])
+				c.mu.Lock()
+				c.filters = append(c.filters, string(rest[2:2+n]))
+				c.mu.Unlock()
+				ack = append(ack, 0x00)
+				rest = rest[2+n+1:]
+			}
+			c.write(append([]byte{0x90, byte(len(ack))}, ack...))
+		case 12: // PINGREQ
+			c.write([]byte{0xD0, 0x00})
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+func readMqttLength(r *bufio.Reader) (int, error) {
+	length, multiplier := 0, 1
+	for i := 0; i < 4; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		length += int(b&0x7F) * multiplier
+		if b&0x80 == 0 {
+			return length, nil
+		}
+		multiplier *= 128
+	}
+	return 0, fmt.Errorf("剩余长度无效")
+}
+
+func mqttPublishPacket(topic string, payload []byte) []byte {
+	body := append([]byte{byte(len(topic) >> 8), byte(len(topic))}, topic...)
+	body = append(body, payload...)
+	packet := []byte{0x30}
+	for n := len(body); ; {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if n == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+func (b *fakeBroker) forward(topic string, payload []byte) {
+	b.mu.Lock()
+	var targets []*brokerConn
+	for c := range b.conns {
+		c.mu.Lock()
+		for _, f := range c.filters {
+			if mqttTopicMatch(f, topic) {
+				targets = append(targets, c)
+				break
+			}
+		}
+		c.mu.Unlock()
+	}
+	b.mu.Unlock()
+	for _, c := range targets {
+		c.write(mqttPublishPacket(topic, payload))
+	}
+}
+
+// subscribed 是否已有客户端订阅了 filter
+func (b *fakeBroker) subscribed(filter string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.conns {
+		c.mu.Lock()
+		for _, f := range c.filters {
+			if f == filter {
+				c.mu.Unlock()
+				return true
+			}
+		}
+		c.mu.Unlock()
+	}
+	return false
+}
+
+// publish 由 Broker 直接向订阅者下发一条报文（模拟其他客户端发布）
+func (b *fakeBroker) publish(topic, payload string) {
+	b.forward(topic, []byte(payload))
+}
+
+// received 返回主题匹配 filter 的已收报文
+func (b *fakeBroker) received(filter string) []brokerMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var result []brokerMessage
+	for _, m := range b.messages {
+		if mqttTopicMatch(filter, m.Topic) {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// waitMessage 等待一条主题匹配 filter 且满足 match 的报文
+func (b *fakeBroker) waitMessage(t *testing.T, filter string, match func(brokerMessage) bool) brokerMessage {
+	t.Helper()
+	var found brokerMessage
+	waitFor(t, 10*time.Second, "MQTT报文 "+filter, func() bool {
+		for _, m := range b.received(filter) {
+			if match == nil || match(m) {
+				found = m
+				return true
+			}
+		}
+		return false
+	})
+	return found
+}
+
+func (b *fakeBroker) close() {
+	b.ln.Close()
+	b.mu.Lock()
+	for c := range b.conns {
+		c.conn.Close()
+	}
+	b.mu.Unlock()
+}
+
+// fakeRtdb 是 RTDB 的 TCP 监听端，按行记录收到的数据
+type fakeRtdb struct {
+	ln net.Listener
+
+	mu      sync.Mutex
+	lines   []string
+	conns   []net.Conn
+	accepts int
+}
+
+func newFakeRtdb(t *testing.T) *fakeRtdb {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRtdb{ln: ln}
+	go r.serve()
+	t.Cleanup(r.close)
+	return r
+}
+
+func (r *fakeRtdb) port() int {
+	return r.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (r *fakeRtdb) serve() {
+	for {
+		conn, err := r.ln.Accept()
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		r.accepts++
+		r.conns = append(r.conns, conn)
+		r.mu.Unlock()
+		go func() {
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				r.mu.Lock()
+				r.lines = append(r.lines, scanner.Text())
+				r.mu.Unlock()
+			}
+		}()
+	}
+}
+
+func (r *fakeRtdb) received() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.lines...)
+}
+
+// waitLine 等待一行满足 match 的数据
+func (r *fakeRtdb) waitLine(t *testing.T, what string, match func(string) bool) string {
+	t.Helper()
+	var found string
+	waitFor(t, 10*time.Second, "RTDB数据 "+what, func() bool {
+		for _, line := range r.received() {
+			if match(line) {
+				found = line
+				return true
+			}
+		}
+		return false
+	})
+	return found
+}
+
+func (r *fakeRtdb) close() {
+	r.ln.Close()
+	r.mu.Lock()
+	for _, conn := range r.conns {
+		conn.Close()
+	}
+	r.mu.Unlock()
+}
+
+// fakeSmtp 是只接收邮件的 SMTP 服务端（无 TLS），记录每封邮件的信封与内容
+type fakeSmtp struct {
+	ln   net.Listener
+	mail chan smtpMail
+}
+
+type smtpMail struct {
+	From string
+	To   []string
+	Auth string
+	Data string
+}
+
+func newFakeSmtp(t *testing.T) *fakeSmtp {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSmtp{ln: ln, mail: make(chan smtpMail, 16)}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *fakeSmtp) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSmtp) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeSmtp) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+	reply("220 fake smtp")
+
+	var mail smtpMail
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimSpace(line)
+		upper := strings.ToUpper(cmd)
+		switch {
+		case strings.HasPrefix(upper, "EHLO"):
+			reply("250-fake smtp")
+			reply("250 AUTH PLAIN")
+		case strings.HasPrefix(upper, "AUTH PLAIN"):
+			mail.Auth = strings.TrimSpace(cmd[len("AUTH PLAIN"):])
+			reply("235 2.7.0 Authentication successful")
+		case strings.HasPrefix(upper, "MAIL FROM:"):
+			mail.From = strings.Trim(cmd[len("MAIL FROM:"):], "<> ")
+			reply("250 OK")
+		case strings.HasPrefix(upper, "RCPT TO:"):
+			mail.To = append(mail.To, strings.Trim(cmd[len("RCPT TO:"):], "<> "))
+			reply("250 OK")
+		case upper == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			mail.Data = data.String()
+			s.mail <- mail
+			mail = smtpMail{}
+			reply("250 OK")
+		case upper == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
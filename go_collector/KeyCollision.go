@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// 发布键冲突：多个原始点经 db_name 映射或键名转换（如 ToLower、SplitAndSelect）得到同一个发布键时，
+// 按任务的 collision_policy 决定发布哪一个，避免后出现的点静默覆盖前一个。
+// 解析器记住每个发布键对应过的全部原始点（最先出现的为占用者）和追加的序号，冲突的点即使分在不同批次
+// 也能识别，且跨批次结果稳定；原始点因规则变化改发到其他键时才从原来的键移除。
+
+// KeyCollision 是一次发布键冲突
+type KeyCollision struct {
+	Key string `json:"key"`
+	// 按出现顺序排列的原始键
+	Origins []string `json:"origins"`
+	Policy  string   `json:"policy"`
+	// 原始键 → 实际发布键，被丢弃的为空串
+	Result map[string]string `json:"result"`
+}
+
+func validCollisionPolicy(policy string) bool {
+	switch policy {
+	case "", CollisionKeepLast, CollisionKeepFirst, CollisionSuffix, CollisionReject:
+		return true
+	}
+	return false
+}
+
+// collisionResolver 只在所属任务的处理协程中使用，无需加锁
+type collisionResolver struct {
+	origins  map[string][]string // 发布键 → 得到该键的原始键，按首次出现排序，首个为占用者
+	keyOf    map[string]string   // 原始键 → 最近一次转换得到的发布键
+	suffixed map[string]string   // 原始键 → 追加序号后的发布键
+	taken    map[string]bool     // 已分配的序号键
+	reported map[string]string   // 已报告的冲突：发布键 → 原始键列表
+	alerted  string              // 最近一次发出事件时的冲突发布键集合
+}
+
+func newCollisionResolver() *collisionResolver {
+	return &collisionResolver{
+		origins:  make(map[string][]string),
+		keyOf:    make(map[string]string),
+		suffixed: make(map[string]string),
+		taken:    make(map[string]bool),
+		reported: make(map[string]string),
+	}
+}
+
+// resolve 对一批 (发布键, 原始键) 按策略求出实际发布键，被丢弃的为空串；
+// 同时返回本批次涉及的冲突，包括与之前批次中的原始点冲突的键
+func (r *collisionResolver) resolve(policy string, keys, origKeys []string) ([]string, []KeyCollision) {
+	if policy == "" {
+		policy = CollisionKeepLast
+	}
+
+	result := append([]string(nil), keys...)
+	groups := make(map[string][]string, len(keys))
+	last := make(map[string]string, len(keys))
+	var order []string
+	for i, key := range keys {
+		last[key] = origKeys[i]
+		origins, seen := groups[key]
+		if !seen {
+			order = append(order, key)
+		}
+		if !containsKey(origins, origKeys[i]) {
+			groups[key] = append(origins, origKeys[i])
+		}
+		r.track(key, origKeys[i])
+	}
+
+	var collisions []KeyCollision
+	fates := make(map[string]map[string]string)
+	for _, key := range order {
+		origins := r.origins[key]
+		if len(origins) < 2 {
+			continue
+		}
+		fate := r.decide(policy, key, origins, last[key], groups)
+		fates[key] = fate
+		collisions = append(collisions, KeyCollision{Key: key, Origins: origins, Policy: policy, Result: fate})
+	}
+	for i, key := range keys {
+		if fate, ok := fates[key]; ok {
+			result[i] = fate[origKeys[i]]
+		}
+	}
+	return result, collisions
+}
+
+// track 记录原始键本次得到的发布键；规则变化后改发到其他键时，从原来的键移除
+func (r *collisionResolver) track(key, origin string) {
+	if prev, ok := r.keyOf[origin]; ok && prev != key {
+		var rest []string
+		for _, o := range r.origins[prev] {
+			if o != origin {
+				rest = append(rest, o)
+			}
+		}
+		if len(rest) == 0 {
+			delete(r.origins, prev)
+		} else {
+			r.origins[prev] = rest
+		}
+		if len(rest) < 2 {
+			delete(r.reported, prev)
+		}
+	}
+	r.keyOf[origin] = key
+	if !containsKey(r.origins[key], origin) {
+		r.origins[key] = append(r.origins[key], origin)
+	}
+}
+
+// conflicts 返回当前仍有多个原始键的发布键
+func (r *collisionResolver) conflicts() []string {
+	var keys []string
+	for key, origins := range r.origins {
+		if len(origins) > 1 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// decide 决定一个冲突键下每个原始键的发布键，origins 的首个为占用者，lastOrigin 为本批次最后出现的原始键
+func (r *collisionResolver) decide(policy, key string, origins []string, lastOrigin string, batch map[string][]string) map[string]string {
+	fate := make(map[string]string, len(origins))
+	winner := origins[0]
+
+	switch policy {
+	case CollisionKeepFirst:
+		fate[winner] = key
+	case CollisionKeepLast:
+		fate[lastOrigin] = key
+	case CollisionSuffix:
+		fate[winner] = key
+		for _, origin := range origins {
+			if origin != winner {
+				fate[origin] = r.suffixFor(key, origin, batch)
+			}
+		}
+	}
+	// reject：全部丢弃
+	for _, origin := range origins {
+		if _, ok := fate[origin]; !ok {
+			fate[origin] = ""
+		}
+	}
+	return fate
+}
+
+// suffixFor 为原始键分配稳定的序号键（key_2、key_3…），跳过本批次已有的发布键
+func (r *collisionResolver) suffixFor(key, origin string, batch map[string][]string) string {
+	if suffixed, ok := r.suffixed[origin]; ok && strings.HasPrefix(suffixed, key+"_") {
+		if owners, used := batch[suffixed]; !used || (len(owners) == 1 && owners[0] == origin) {
+			return suffixed
+		}
+	}
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s_%d", key, n)
+		if _, used := batch[candidate]; used || r.taken[candidate] {
+			continue
+		}
+		if owners := r.origins[candidate]; len(owners) > 0 && owners[0] != origin {
+			continue
+		}
+		r.suffixed[origin] = candidate
+		r.taken[candidate] = true
+		return candidate
+	}
+}
+
+// newCollisions 返回本批次中首次出现或原始键集合发生变化的冲突，用于只记录一次日志与事件
+func (r *collisionResolver) newCollisions(collisions []KeyCollision) []KeyCollision {
+	var fresh []KeyCollision
+	for _, collision := range collisions {
+		origins := append([]string(nil), collision.Origins...)
+		sort.Strings(origins)
+		signature := strings.Join(origins, "\x00")
+		if r.reported[collision.Key] != signature {
+			r.reported[collision.Key] = signature
+			fresh = append(fresh, collision)
+		}
+	}
+	return fresh
+}
+
+// pendingPoints 是一批待发布的点，冲突处理后再逐个发布
+type pendingPoints struct {
+	keys     []string
+	origKeys []string
+	points   []pendingPoint
+}
+
+type pendingPoint struct {
+	tag     *TagMapping
+	val     interface{}
+	quality int
+	item    map[string]interface{}
+}
+
+func (p *pendingPoints) add(key, origKey string, tag *TagMapping, val interface{}, quality int, item map[string]interface{}) {
+	p.keys = append(p.keys, key)
+	p.origKeys = append(p.origKeys, origKey)
+	p.points = append(p.points, pendingPoint{tag: tag, val: val, quality: quality, item: item})
+}
+
+// reportCollisions 新出现的冲突记录日志；出现新冲突或冲突的发布键集合变化时发出 transform_collision 事件，
+// 冲突持续存在时不重复发出，全部消除后才恢复
+func (tr *TaskRunner) reportCollisions(collector *Collector, collisions []KeyCollision) {
+	fresh := tr.collisions.newCollisions(collisions)
+	for _, collision := range fresh {
+		log.Printf("⚠️ 任务[%s] %s", tr.name, describeCollision(collision))
+	}
+	conflicts := tr.collisions.conflicts()
+	metricKeyCollisions.Set(float64(len(conflicts)), tr.name)
+	signature := strings.Join(conflicts, "\x00")
+	changed := signature != tr.collisions.alerted
+	tr.collisions.alerted = signature
+	if len(conflicts) == 0 {
+		collector.events.Recover(EventTransformCollision, tr.name, "发布键冲突已消除")
+		return
+	}
+	if len(fresh) == 0 && !changed {
+		return
+	}
+	policy := tr.task.CollisionPolicy
+	if policy == "" {
+		policy = CollisionKeepLast
+	}
+	keys := conflicts
+	if len(keys) > 10 {
+		keys = append(keys[:10:10], "…")
+	}
+	collector.events.Error(EventTransformCollision, tr.name,
+		fmt.Errorf("%d 个发布键冲突（%s）: %s", len(conflicts), policy, strings.Join(keys, ", ")))
+}
+
+// originalKeys 返回任务实际出现过的原始键与配置的点，供冲突预览使用
+func (tr *TaskRunner) originalKeys() []string {
+	keys := tr.transformer.ObservedOrigins()
+	for _, tag := range tr.task.Tags {
+		keys = append(keys, tag.OpcTag)
+	}
+	return uniqueKeys(keys)
+}
+
+// describeCollision 生成冲突的日志描述
+func describeCollision(c KeyCollision) string {
+	parts := make([]string, 0, len(c.Origins))
+	for _, origin := range c.Origins {
+		if key := c.Result[origin]; key != "" {
+			parts = append(parts, fmt.Sprintf("%s→%s", origin, key))
+		} else {
+			parts = append(parts, origin+"(丢弃)")
+		}
+	}
+	return fmt.Sprintf("发布键 %s 冲突 [%s]: %s", c.Key, c.Policy, strings.Join(parts, ", "))
+}
+
+func containsKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
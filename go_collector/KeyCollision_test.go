@@ -0,0 +1,166 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCollisionResolverPolicies(t *testing.T) {
+	keys := []string{"a", "b", "a"}
+	origins := []string{"A", "b", "a"}
+	cases := []struct {
+		policy string
+		want   []string
+	}{
+		{"", []string{"", "b", "a"}},
+		{CollisionKeepLast, []string{"", "b", "a"}},
+		{CollisionKeepFirst, []string{"a", "b", ""}},
+		{CollisionSuffix, []string{"a", "b", "a_2"}},
+		{CollisionReject, []string{"", "b", ""}},
+	}
+	for _, c := range cases {
+		resolved, collisions := newCollisionResolver().resolve(c.policy, keys, origins)
+		if !reflect.DeepEqual(resolved, c.want) {
+			t.Errorf("%q: resolved = %v, want %v", c.policy, resolved, c.want)
+		}
+		if len(collisions) != 1 || collisions[0].Key != "a" || !reflect.DeepEqual(collisions[0].Origins, []string{"A", "a"}) {
+			t.Errorf("%q: collisions = %+v", c.policy, collisions)
+		}
+	}
+
+	// 同一原始点在一批中重复出现不算冲突
+	if _, collisions := newCollisionResolver().resolve(CollisionReject, []string{"a", "a"}, []string{"A", "A"}); len(collisions) != 0 {
+		t.Errorf("重复点 collisions = %+v", collisions)
+	}
+}
+
+func TestCollisionResolverStable(t *testing.T) {
+	r := newCollisionResolver()
+
+	// keep_first 以最先占用该键的点为准，不受批内顺序影响
+	r.resolve(CollisionKeepFirst, []string{"k"}, []string{"B"})
+	if resolved, _ := r.resolve(CollisionKeepFirst, []string{"k", "k"}, []string{"A", "B"}); !reflect.DeepEqual(resolved, []string{"", "k"}) {
+		t.Errorf("keep_first resolved = %v", resolved)
+	}
+
+	// 占用者之外的点单独出现在后续批次中，同样按冲突处理
+	if resolved, collisions := r.resolve(CollisionKeepFirst, []string{"k"}, []string{"C"}); !reflect.DeepEqual(resolved, []string{""}) ||
+		len(collisions) != 1 || !reflect.DeepEqual(collisions[0].Origins, []string{"B", "A", "C"}) {
+		t.Errorf("跨批次 keep_first resolved = %v, collisions = %+v", resolved, collisions)
+	}
+	if resolved, _ := r.resolve(CollisionReject, []string{"k"}, []string{"B"}); !reflect.DeepEqual(resolved, []string{""}) {
+		t.Errorf("跨批次 reject resolved = %v", resolved)
+	}
+	if resolved, _ := r.resolve(CollisionKeepLast, []string{"k"}, []string{"A"}); !reflect.DeepEqual(resolved, []string{"k"}) {
+		t.Errorf("跨批次 keep_last resolved = %v", resolved)
+	}
+
+	// 原始点改发到其他键后不再参与原来的冲突
+	r.resolve(CollisionKeepFirst, []string{"j", "j"}, []string{"A", "C"})
+	if conflicts := r.conflicts(); !reflect.DeepEqual(conflicts, []string{"j"}) {
+		t.Errorf("conflicts = %v", conflicts)
+	}
+
+	// suffix 的序号跨批次保持不变
+	r = newCollisionResolver()
+	first, _ := r.resolve(CollisionSuffix, []string{"x", "x", "x"}, []string{"X", "x", "x."})
+	second, _ := r.resolve(CollisionSuffix, []string{"x", "x", "x"}, []string{"x.", "x", "X"})
+	if !reflect.DeepEqual(first, []string{"x", "x_2", "x_3"}) || !reflect.DeepEqual(second, []string{"x_3", "x_2", "x"}) {
+		t.Errorf("suffix first = %v, second = %v", first, second)
+	}
+
+	// 序号键被真实的点占用时改用下一个序号
+	resolved, _ := r.resolve(CollisionSuffix, []string{"x", "x", "x_2"}, []string{"x", "X", "x_2"})
+	if !reflect.DeepEqual(resolved, []string{"x_4", "x", "x_2"}) {
+		t.Errorf("序号被占用 resolved = %v", resolved)
+	}
+}
+
+func TestCollisionResolverReportsOnce(t *testing.T) {
+	r := newCollisionResolver()
+	_, collisions := r.resolve(CollisionKeepLast, []string{"a", "a"}, []string{"A", "a"})
+	if fresh := r.newCollisions(collisions); len(fresh) != 1 {
+		t.Fatalf("首次冲突 fresh = %+v", fresh)
+	}
+	_, collisions = r.resolve(CollisionKeepLast, []string{"a", "a"}, []string{"a", "A"})
+	if fresh := r.newCollisions(collisions); len(fresh) != 0 {
+		t.Errorf("相同冲突不应重复报告: %+v", fresh)
+	}
+	_, collisions = r.resolve(CollisionKeepLast, []string{"a", "a", "a"}, []string{"a", "A", "a."})
+	if fresh := r.newCollisions(collisions); len(fresh) != 1 {
+		t.Errorf("原始键变化后应重新报告: %+v", fresh)
+	}
+
+	if got := describeCollision(KeyCollision{Key: "a", Origins: []string{"A", "a"}, Policy: CollisionKeepLast,
+		Result: map[string]string{"A": "", "a": "a"}}); got != "发布键 a 冲突 [keep_last]: A(丢弃), a→a" {
+		t.Errorf("describeCollision = %s", got)
+	}
+}
+
+func TestProcessAndPublishCollision(t *testing.T) {
+	task := testTask("line1", &TagMapping{OpcTag: "Mapped", DbName: "tag.a"})
+	task.CollisionPolicy = CollisionSuffix
+	config := &AppConfig{Tasks: []*TaskConfig{task}}
+	runner := newTaskRunner("task1", task, config)
+	runner.transformer.ImportRules([]TransformRule{{RuleType: "ToLower", Enabled: true}})
+	collector := NewCollector(config)
+
+	var events []Event
+	collector.events.Subscribe(func(e Event) {
+		if e.Type == EventTransformCollision {
+			events = append(events, e)
+		}
+	})
+
+	runner.processAndPublish(collector, []map[string]interface{}{
+		{"topic": "Tag.A", "value": 1, "quality": 192},
+		{"topic": "TAG.A", "value": 2, "quality": 192},
+		{"topic": "Mapped", "value": 3, "quality": 192},
+	}, true)
+	// db_name 映射同样参与冲突：Tag.A 最先占用 tag.a，其余追加序号
+	for key, want := range map[string]string{"tag.a": "Tag.A", "tag.a_2": "TAG.A", "tag.a_3": "Mapped"} {
+		found := collector.values.Find(key)
+		if len(found) != 1 || found[0].OrigKey != want {
+			t.Errorf("%s = %+v, want %s", key, found, want)
+		}
+	}
+	if len(events) != 1 || events[0].Severity != SeverityError || events[0].Subject != "task1" {
+		t.Fatalf("冲突事件 = %+v", events)
+	}
+
+	// 冲突的点分在不同批次时仍按冲突处理，不恢复
+	runner.processAndPublish(collector, []map[string]interface{}{{"topic": "TAG.A", "value": 4, "quality": 192}}, true)
+	if found := collector.values.Find("tag.a_2"); len(found) != 1 || found[0].Value != 4 {
+		t.Errorf("跨批次 tag.a_2 = %+v", found)
+	}
+	if len(events) != 1 {
+		t.Errorf("冲突未变化时不应重复发出事件，也不应恢复: %+v", events)
+	}
+
+	// 规则变化后各原始点得到不同的键，冲突全部消除才恢复
+	runner.transformer.ImportRules(nil)
+	runner.processAndPublish(collector, []map[string]interface{}{{"topic": "Tag.A", "value": 1, "quality": 192}}, true)
+	if len(events) != 1 {
+		t.Errorf("TAG.A 仍映射到 tag.a 时不应恢复: %+v", events)
+	}
+	runner.processAndPublish(collector, []map[string]interface{}{{"topic": "TAG.A", "value": 2, "quality": 192}}, true)
+	if len(events) != 2 || events[1].Severity != SeverityRecovered {
+		t.Errorf("冲突消除后应发出恢复事件: %+v", events)
+	}
+
+	// 冲突再次出现时重新发出事件，新增冲突的发布键时再发出一次
+	runner.transformer.ImportRules([]TransformRule{{RuleType: "ToLower", Enabled: true}})
+	runner.processAndPublish(collector, []map[string]interface{}{{"topic": "Tag.A", "value": 1, "quality": 192}}, true)
+	if len(events) != 3 || events[2].Severity != SeverityError {
+		t.Fatalf("冲突再次出现 = %+v", events)
+	}
+	runner.processAndPublish(collector, []map[string]interface{}{{"topic": "Tag.A", "value": 1, "quality": 192}}, true)
+	runner.processAndPublish(collector, []map[string]interface{}{
+		{"topic": "Tag.B", "value": 1, "quality": 192},
+		{"topic": "TAG.B", "value": 2, "quality": 192},
+	}, true)
+	if len(events) != 4 || !strings.Contains(events[3].Message, "tag.b") {
+		t.Errorf("新增冲突键 = %+v", events)
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// 键名反向转换：由发布键找回原始 OPC 点名。
+// 前后缀与替换规则可以直接逆推（结果再经正向转换校验）；正则、大小写、分割等不可逆规则
+// 依靠 Transform 时记录的“转换后 → 原始键”观测索引反查。多个原始键得到同一发布键时报告为歧义。
+
+const (
+	ReverseByRules    = "rules"
+	ReverseByObserved = "observed"
+	ReverseNone       = "none"
+
+	// 单个键逆推的候选上限，防止 Replace 规则组合爆炸
+	maxReverseCandidates = 256
+	// 观测索引记录的原始键上限
+	maxObservedKeys = 100000
+)
+
+// ReverseResult 是一次反向转换的结果
+type ReverseResult struct {
+	Key        string   `json:"key"`
+	Candidates []string `json:"candidates"`
+	Method     string   `json:"method"`
+	Ambiguous  bool     `json:"ambiguous"`
+	Message    string   `json:"message,omitempty"`
+}
+
+// Reverse 反查发布键对应的原始键：规则可逆时逆推，观测索引用于缩小歧义；规则不可逆时只用观测索引
+func (kt *KeyTransformer) Reverse(key string) ReverseResult {
+	result := ReverseResult{Key: key, Candidates: []string{}}
+	observed := kt.Observed(key)
+
+	kt.mu.RLock()
+	candidates, reversible := kt.reverseByRules(key)
+	kt.mu.RUnlock()
+
+	switch {
+	case reversible:
+		result.Method = ReverseByRules
+		if len(candidates) > 1 && len(observed) > 0 {
+			// 规则逆推有多个候选时，以实际出现过的原始键为准
+			if seen := intersectKeys(candidates, observed); len(seen) > 0 {
+				candidates = seen
+				result.Method = ReverseByObserved
+			}
+		}
+		result.Candidates = candidates
+		if len(candidates) == 0 {
+			result.Message = "没有原始键能转换为该键"
+		}
+	case len(observed) > 0:
+		result.Method = ReverseByObserved
+		result.Candidates = observed
+	default:
+		result.Method = ReverseNone
+		result.Message = "规则不可逆，且尚未观测到转换为该键的原始键"
+	}
+
+	result.Ambiguous = len(result.Candidates) > 1
+	if result.Ambiguous && result.Message == "" {
+		result.Message = "多个原始键转换为同一个键"
+	}
+	return result
+}
+
+// reverseByRules 按规则倒序逐条逆推，候选再经正向转换校验；存在不可逆规则时返回 false。调用方需持有 mu
+func (kt *KeyTransformer) reverseByRules(key string) ([]string, bool) {
+	if !kt.enabled || key == "" {
+		return []string{key}, true
+	}
+	if !rulesReversible(kt.rules) {
+		return nil, false
+	}
+
+	candidates := []string{key}
+	for i := len(kt.rules) - 1; i >= 0; i-- {
+		rule := kt.rules[i]
+		if !rule.Enabled {
+			continue
+		}
+		var next []string
+		for _, candidate := range candidates {
+			next = append(next, invertRule(candidate, rule)...)
+		}
+		candidates = uniqueKeys(next)
+		if len(candidates) > maxReverseCandidates {
+			candidates = candidates[:maxReverseCandidates]
+		}
+	}
+
+	verified := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		if candidate != "" && kt.transform(candidate) == key {
+			verified = append(verified, candidate)
+		}
+	}
+	return verified, true
+}
+
+// rulesReversible 启用的规则是否都能逆推
+func rulesReversible(rules []TransformRule) bool {
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		switch rule.RuleType {
+		case "ToLower", "ToUpper":
+			return false
+		case "RegexReplace", "SplitAndSelect":
+			// 模式为空时规则不生效
+			if rule.Pattern != "" {
+				return false
+			}
+		case "Replace":
+			// 替换为空（删除）无法知道原来的位置
+			if rule.Pattern != "" && rule.Replacement == "" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// invertRule 返回经过该规则后可能得到 key 的输入（可能多于实际，最终由正向转换校验）
+func invertRule(key string, rule TransformRule) []string {
+	switch rule.RuleType {
+	case "RemovePrefix":
+		if rule.Pattern == "" {
+			return []string{key}
+		}
+		// 原始键带前缀被移除，或原始键本就不带该前缀
+		candidates := []string{rule.Pattern + key}
+		if !strings.HasPrefix(key, rule.Pattern) {
+			candidates = append(candidates, key)
+		}
+		return candidates
+
+	case "RemoveSuffix":
+		if rule.Pattern == "" {
+			return []string{key}
+		}
+		candidates := []string{key + rule.Pattern}
+		if !strings.HasSuffix(key, rule.Pattern) {
+			candidates = append(candidates, key)
+		}
+		return candidates
+
+	case "AddPrefix":
+		if strings.HasPrefix(key, rule.Replacement) {
+			return []string{key[len(rule.Replacement):]}
+		}
+		return nil
+
+	case "AddSuffix":
+		if strings.HasSuffix(key, rule.Replacement) {
+			return []string{key[:len(key)-len(rule.Replacement)]}
+		}
+		return nil
+
+	case "Replace":
+		if rule.Pattern == "" || rule.Pattern == rule.Replacement {
+			return []string{key}
+		}
+		return invertReplace(key, rule.Pattern, rule.Replacement)
+
+	default:
+		// Trim 无法恢复空白，其余为恒等规则
+		return []string{key}
+	}
+}
+
+// invertReplace 键中每处 replacement 既可能来自 pattern，也可能原本就是 replacement，枚举所有组合
+func invertReplace(key, pattern, replacement string) []string {
+	var positions []int
+	for offset := 0; ; {
+		i := strings.Index(key[offset:], replacement)
+		if i < 0 {
+			break
+		}
+		positions = append(positions, offset+i)
+		offset += i + len(replacement)
+	}
+	if len(positions) == 0 {
+		return []string{key}
+	}
+	if len(positions) > 8 {
+		// 组合过多时只取“全部还原”与“全部保留”两种
+		return []string{strings.ReplaceAll(key, replacement, pattern), key}
+	}
+
+	candidates := make([]string, 0, 1<<len(positions))
+	for mask := (1 << len(positions)) - 1; mask >= 0; mask-- {
+		var b strings.Builder
+		last := 0
+		for i, pos := range positions {
+			b.WriteString(key[last:pos])
+			if mask&(1<<i) != 0 {
+				b.WriteString(pattern)
+			} else {
+				b.WriteString(replacement)
+			}
+			last = pos + len(replacement)
+		}
+		b.WriteString(key[last:])
+		candidates = append(candidates, b.String())
+	}
+	return candidates
+}
+
+// observe 记录一次转换，供不可逆规则反查
+func (kt *KeyTransformer) observe(originalKey, key string) {
+	if originalKey == "" {
+		return
+	}
+	kt.observedMu.Lock()
+	defer kt.observedMu.Unlock()
+	origins := kt.observed[key]
+	for _, origin := range origins {
+		if origin == originalKey {
+			return
+		}
+	}
+	if kt.observedCount >= maxObservedKeys {
+		return
+	}
+	kt.observed[key] = append(origins, originalKey)
+	kt.observedCount++
+}
+
+// resetObserved 规则变化后清空观测索引，调用方需持有 mu
+func (kt *KeyTransformer) resetObserved() {
+	kt.observedMu.Lock()
+	kt.observed = make(map[string][]string)
+	kt.observedCount = 0
+	kt.observedMu.Unlock()
+}
+
+// Observed 返回观测到的转换为 key 的原始键（按名称排序）
+func (kt *KeyTransformer) Observed(key string) []string {
+	kt.observedMu.Lock()
+	defer kt.observedMu.Unlock()
+	origins := append([]string(nil), kt.observed[key]...)
+	sort.Strings(origins)
+	return origins
+}
+
+// ObservedOrigins 返回观测索引中的全部原始键（按名称排序）
+func (kt *KeyTransformer) ObservedOrigins() []string {
+	kt.observedMu.Lock()
+	defer kt.observedMu.Unlock()
+	origins := make([]string, 0, kt.observedCount)
+	for _, keys := range kt.observed {
+		origins = append(origins, keys...)
+	}
+	sort.Strings(origins)
+	return origins
+}
+
+// Collisions 返回观测到的冲突：多个原始键转换为同一个键
+func (kt *KeyTransformer) Collisions() map[string][]string {
+	kt.observedMu.Lock()
+	defer kt.observedMu.Unlock()
+	collisions := make(map[string][]string)
+	for key, origins := range kt.observed {
+		if len(origins) > 1 {
+			sorted := append([]string(nil), origins...)
+			sort.Strings(sorted)
+			collisions[key] = sorted
+		}
+	}
+	return collisions
+}
+
+// clone 复制规则与观测索引
+func (kt *KeyTransformer) clone() *KeyTransformer {
+	copied := NewKeyTransformer()
+	kt.mu.RLock()
+	copied.enabled = kt.enabled
+	copied.rules = append([]TransformRule{}, kt.rules...)
+	copied.compiled = append([]*regexp.Regexp{}, kt.compiled...)
+	kt.mu.RUnlock()
+
+	kt.observedMu.Lock()
+	for key, origins := range kt.observed {
+		copied.observed[key] = append([]string(nil), origins...)
+	}
+	copied.observedCount = kt.observedCount
+	kt.observedMu.Unlock()
+	return copied
+}
+
+func uniqueKeys(keys []string) []string {
+	seen := make(map[string]bool, len(keys))
+	result := keys[:0]
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			result = append(result, key)
+		}
+	}
+	return result
+}
+
+func intersectKeys(keys, allowed []string) []string {
+	var result []string
+	for _, key := range keys {
+		for _, a := range allowed {
+			if key == a {
+				result = append(result, key)
+				break
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func reverseTransformer(rules ...TransformRule) *KeyTransformer {
+	kt := NewKeyTransformer()
+	for i := range rules {
+		rules[i].Enabled = true
+	}
+	kt.ImportRules(rules)
+	return kt
+}
+
+func TestKeyTransformerReverseByRules(t *testing.T) {
+	kt := reverseTransformer(
+		TransformRule{RuleType: "RemovePrefix", Pattern: "Channel2."},
+		TransformRule{RuleType: "AddPrefix", Replacement: "10011_"},
+	)
+
+	// 不带前缀的原始键同样会得到该键，规则逆推有两个候选
+	result := kt.Reverse("10011_Device1.Value")
+	want := []string{"Channel2.Device1.Value", "Device1.Value"}
+	if result.Method != ReverseByRules || !result.Ambiguous || !reflect.DeepEqual(result.Candidates, want) {
+		t.Errorf("Reverse = %+v", result)
+	}
+
+	// 观测到实际原始键后以观测为准
+	kt.Transform("Channel2.Device1.Value")
+	result = kt.Reverse("10011_Device1.Value")
+	if result.Method != ReverseByObserved || result.Ambiguous || !reflect.DeepEqual(result.Candidates, want[:1]) {
+		t.Errorf("观测后 Reverse = %+v", result)
+	}
+
+	// 缺少 AddPrefix 的前缀，任何原始键都得不到该键
+	if result := kt.Reverse("Device1.Value"); len(result.Candidates) != 0 || result.Message == "" {
+		t.Errorf("Reverse(无前缀) = %+v", result)
+	}
+}
+
+func TestKeyTransformerReverseReplace(t *testing.T) {
+	kt := reverseTransformer(
+		TransformRule{RuleType: "Replace", Pattern: ".", Replacement: "_"},
+		TransformRule{RuleType: "RemoveSuffix", Pattern: "_Value"},
+	)
+	result := kt.Reverse("A_B")
+	for _, candidate := range result.Candidates {
+		if kt.Transform(candidate) != "A_B" {
+			t.Errorf("候选 %s 正向转换结果不一致", candidate)
+		}
+	}
+	for _, want := range []string{"A.B", "A_B", "A.B.Value", "A_B_Value"} {
+		found := false
+		for _, candidate := range result.Candidates {
+			found = found || candidate == want
+		}
+		if !found {
+			t.Errorf("候选缺少 %s: %v", want, result.Candidates)
+		}
+	}
+
+	// 替换为空无法逆推，按观测索引反查
+	kt = reverseTransformer(TransformRule{RuleType: "Replace", Pattern: "-", Replacement: ""})
+	if result := kt.Reverse("AB"); result.Method != ReverseNone {
+		t.Errorf("删除字符后应无法逆推: %+v", result)
+	}
+}
+
+func TestKeyTransformerReverseObserved(t *testing.T) {
+	kt := reverseTransformer(
+		TransformRule{RuleType: "RegexReplace", Pattern: `^Ch(\d+)\.`, Replacement: "c${1}_"},
+		TransformRule{RuleType: "ToLower"},
+	)
+	if result := kt.Reverse("c1_tag"); result.Method != ReverseNone || len(result.Candidates) != 0 {
+		t.Errorf("未观测前 Reverse = %+v", result)
+	}
+
+	kt.Transform("Ch1.Tag")
+	kt.Transform("Ch1.TAG")
+	kt.Transform("Ch2.Other")
+	result := kt.Reverse("c1_tag")
+	if result.Method != ReverseByObserved || !result.Ambiguous || !reflect.DeepEqual(result.Candidates, []string{"Ch1.TAG", "Ch1.Tag"}) {
+		t.Errorf("Reverse = %+v", result)
+	}
+	if got := kt.Collisions(); !reflect.DeepEqual(got, map[string][]string{"c1_tag": {"Ch1.TAG", "Ch1.Tag"}}) {
+		t.Errorf("Collisions = %v", got)
+	}
+
+	// 规则变化后观测索引失效
+	kt.AddRule(TransformRule{RuleType: "AddSuffix", Replacement: "_x", Enabled: true})
+	if result := kt.Reverse("c1_tag"); result.Method != ReverseNone {
+		t.Errorf("规则变化后 Reverse = %+v", result)
+	}
+}
+
+func TestKeyTransformerReverseKeepsIndexOnSameFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transform.json")
+	os.WriteFile(path, []byte(`{"enabled": true, "rules": [{"rule_type": "ToUpper", "enabled": true}]}`), 0644)
+
+	kt := NewKeyTransformer()
+	kt.LoadFromFile(path)
+	kt.Transform("tag.a")
+	// 采集周期内重复加载同一文件，不应清空观测索引
+	kt.LoadFromFile(path)
+	if got := kt.Observed("TAG.A"); !reflect.DeepEqual(got, []string{"tag.a"}) {
+		t.Errorf("重复加载后 Observed = %v", got)
+	}
+
+	os.WriteFile(path, []byte(`{"enabled": true, "rules": [{"rule_type": "ToLower", "enabled": true}]}`), 0644)
+	kt.LoadFromFile(path)
+	if got := kt.Observed("TAG.A"); len(got) != 0 {
+		t.Errorf("规则变化后 Observed = %v", got)
+	}
+}
+
+func TestProcessAndPublishSkipsTransformForMappedTags(t *testing.T) {
+	task := testTask("line1", &TagMapping{OpcTag: "Mapped", DbName: "m"})
+	config := &AppConfig{Tasks: []*TaskConfig{task}}
+	runner := newTaskRunner("task1", task, config)
+	runner.transformer.ImportRules([]TransformRule{{RuleType: "ToLower", Enabled: true}})
+
+	runner.processAndPublish(NewCollector(config), []map[string]interface{}{
+		{"topic": "Mapped", "value": 1, "quality": 192},
+		{"topic": "Other", "value": 2, "quality": 192},
+	}, true)
+	if got := runner.transformer.Observed("mapped"); len(got) != 0 {
+		t.Errorf("映射的点不应进入观测索引: %v", got)
+	}
+	if got := runner.transformer.Observed("other"); !reflect.DeepEqual(got, []string{"Other"}) {
+		t.Errorf("Observed(other) = %v", got)
+	}
+}
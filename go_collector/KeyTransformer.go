@@ -2,14 +2,25 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"reflect"
 	"regexp"
 	"strings"
+	"sync"
 )
 
 type KeyTransformer struct {
-	rules  []TransformRule
+	mu      sync.RWMutex
+	rules   []TransformRule
 	enabled bool
+	// 与 rules 一一对应的预编译正则，非 RegexReplace 规则为 nil
+	compiled []*regexp.Regexp
+
+	// 反向索引：转换后的键 → 观测到的原始键，规则变化时清空
+	observedMu    sync.Mutex
+	observed      map[string][]string
+	observedCount int
 }
 
 type TransformRule struct {
@@ -22,17 +33,38 @@ type TransformRule struct {
 }
 
 type TransformConfig struct {
-	Enabled        bool           `json:"enabled"`
-	DefaultPrefix  string         `json:"default_prefix"`
-	DefaultSuffix  string         `json:"default_suffix"`
-	Rules          []TransformRule `json:"rules"`
+	Enabled       bool            `json:"enabled"`
+	DefaultPrefix string          `json:"default_prefix"`
+	DefaultSuffix string          `json:"default_suffix"`
+	Rules         []TransformRule `json:"rules"`
 }
 
 func NewKeyTransformer() *KeyTransformer {
 	return &KeyTransformer{
-		rules:   []TransformRule{},
-		enabled: true,
+		rules:    []TransformRule{},
+		enabled:  true,
+		observed: make(map[string][]string),
+	}
+}
+
+// ruleSet 是一份校验并预编译过的规则，可同时替换到多个转换器
+type ruleSet struct {
+	enabled  bool
+	rules    []TransformRule
+	compiled []*regexp.Regexp
+}
+
+// parseRuleSet 解析规则文件内容，规则无效时返回错误
+func parseRuleSet(data []byte) (*ruleSet, error) {
+	var config TransformConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	compiled, err := compileRules(config.Rules)
+	if err != nil {
+		return nil, err
 	}
+	return &ruleSet{enabled: config.Enabled, rules: config.Rules, compiled: compiled}, nil
 }
 
 func (kt *KeyTransformer) LoadFromFile(path string) error {
@@ -40,30 +72,83 @@ func (kt *KeyTransformer) LoadFromFile(path string) error {
 	if err != nil {
 		return err
 	}
-
-	var config TransformConfig
-	if err := json.Unmarshal(data, &config); err != nil {
+	// 规则无效时保留原有规则
+	set, err := parseRuleSet(data)
+	if err != nil {
 		return err
 	}
-
-	kt.enabled = config.Enabled
-	kt.rules = config.Rules
+	kt.swap(set)
 	return nil
 }
 
+// swap 原子地替换规则；内容未变时保留反向索引
+func (kt *KeyTransformer) swap(set *ruleSet) {
+	kt.mu.Lock()
+	defer kt.mu.Unlock()
+	if kt.enabled != set.enabled || !reflect.DeepEqual(kt.rules, set.rules) {
+		kt.enabled = set.enabled
+		kt.rules = set.rules
+		kt.compiled = set.compiled
+		kt.resetObserved()
+	}
+}
+
+// compileRules 校验并预编译启用的规则，错误信息带规则序号（与规则页面的 #1、#2… 一致）
+func compileRules(rules []TransformRule) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, len(rules))
+	for i, rule := range rules {
+		if !rule.Enabled || rule.RuleType != "RegexReplace" || rule.Pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("规则 #%d (%s) 正则表达式无效: %v", i+1, rule.RuleType, err)
+		}
+		compiled[i] = re
+	}
+	return compiled, nil
+}
+
 func (kt *KeyTransformer) SetEnabled(enabled bool) {
-	kt.enabled = enabled
+	kt.mu.Lock()
+	defer kt.mu.Unlock()
+	if kt.enabled != enabled {
+		kt.enabled = enabled
+		kt.resetObserved()
+	}
 }
 
 func (kt *KeyTransformer) IsEnabled() bool {
+	kt.mu.RLock()
+	defer kt.mu.RUnlock()
 	return kt.enabled
 }
 
-func (kt *KeyTransformer) AddRule(rule TransformRule) {
-	kt.rules = append(kt.rules, rule)
+func (kt *KeyTransformer) AddRule(rule TransformRule) error {
+	kt.mu.Lock()
+	defer kt.mu.Unlock()
+	rules := append(append([]TransformRule{}, kt.rules...), rule)
+	compiled, err := compileRules(rules)
+	if err != nil {
+		return err
+	}
+	kt.rules = rules
+	kt.compiled = compiled
+	kt.resetObserved()
+	return nil
 }
 
 func (kt *KeyTransformer) Transform(originalKey string) string {
+	kt.mu.RLock()
+	result := kt.transform(originalKey)
+	kt.mu.RUnlock()
+
+	kt.observe(originalKey, result)
+	return result
+}
+
+// transform 依次应用启用的规则，调用方需持有 mu
+func (kt *KeyTransformer) transform(originalKey string) string {
 	if originalKey == "" {
 		return originalKey
 	}
@@ -74,17 +159,18 @@ func (kt *KeyTransformer) Transform(originalKey string) string {
 
 	result := originalKey
 
-	for _, rule := range kt.rules {
+	for i, rule := range kt.rules {
 		if !rule.Enabled {
 			continue
 		}
-		result = kt.applyRule(result, rule)
+		result = applyRule(result, rule, kt.compiled[i])
 	}
 
 	return result
 }
 
-func (kt *KeyTransformer) applyRule(key string, rule TransformRule) string {
+// applyRule 应用单条规则，re 为 RegexReplace 规则预编译的正则
+func applyRule(key string, rule TransformRule, re *regexp.Regexp) string {
 	switch rule.RuleType {
 	case "RemovePrefix":
 		if strings.HasPrefix(key, rule.Pattern) {
@@ -108,8 +194,7 @@ func (kt *KeyTransformer) applyRule(key string, rule TransformRule) string {
 		return strings.ReplaceAll(key, rule.Pattern, rule.Replacement)
 
 	case "RegexReplace":
-		if rule.Pattern != "" {
-			re := regexp.MustCompile(rule.Pattern)
+		if re != nil {
 			return re.ReplaceAllString(key, rule.Replacement)
 		}
 		return key
@@ -138,21 +223,42 @@ func (kt *KeyTransformer) applyRule(key string, rule TransformRule) string {
 }
 
 func (kt *KeyTransformer) ExportRules() []TransformRule {
+	kt.mu.RLock()
+	defer kt.mu.RUnlock()
 	return append([]TransformRule{}, kt.rules...)
 }
 
-func (kt *KeyTransformer) ImportRules(rules []TransformRule) {
+func (kt *KeyTransformer) ImportRules(rules []TransformRule) error {
+	compiled, err := compileRules(rules)
+	if err != nil {
+		return err
+	}
+	kt.mu.Lock()
+	defer kt.mu.Unlock()
 	kt.rules = append([]TransformRule{}, rules...)
+	kt.compiled = compiled
+	kt.resetObserved()
+	return nil
 }
 
 func (kt *KeyTransformer) ClearRules() {
+	kt.mu.Lock()
+	defer kt.mu.Unlock()
 	kt.rules = []TransformRule{}
+	kt.compiled = nil
+	kt.resetObserved()
 }
 
 func (kt *KeyTransformer) GetStatus() map[string]interface{} {
+	kt.mu.RLock()
+	defer kt.mu.RUnlock()
+	kt.observedMu.Lock()
+	defer kt.observedMu.Unlock()
 	return map[string]interface{}{
-		"enabled":   kt.enabled,
-		"rule_count": len(kt.rules),
+		"enabled":       kt.enabled,
+		"rule_count":    len(kt.rules),
+		"observed_keys": kt.observedCount,
+		"reversible":    rulesReversible(kt.rules),
 	}
 }
 
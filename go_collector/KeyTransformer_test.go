@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKeyTransformerRules(t *testing.T) {
+	cases := []struct {
+		name string
+		rule TransformRule
+		in   string
+		want string
+	}{
+		{"RemovePrefix", TransformRule{RuleType: "RemovePrefix", Pattern: "Channel1.Device1."}, "Channel1.Device1.Tag1", "Tag1"},
+		{"RemovePrefix不匹配", TransformRule{RuleType: "RemovePrefix", Pattern: "X."}, "Channel1.Tag1", "Channel1.Tag1"},
+		{"RemoveSuffix", TransformRule{RuleType: "RemoveSuffix", Pattern: ".Value"}, "Tag1.Value", "Tag1"},
+		{"AddPrefix", TransformRule{RuleType: "AddPrefix", Replacement: "plant_"}, "Tag1", "plant_Tag1"},
+		{"AddSuffix", TransformRule{RuleType: "AddSuffix", Replacement: "_pv"}, "Tag1", "Tag1_pv"},
+		{"Replace", TransformRule{RuleType: "Replace", Pattern: ".", Replacement: "_"}, "A.B.C", "A_B_C"},
+		{"RegexReplace", TransformRule{RuleType: "RegexReplace", Pattern: `^Ch(\d+)\.`, Replacement: "c${1}_"}, "Ch12.Tag", "c12_Tag"},
+		{"RegexReplace空模式", TransformRule{RuleType: "RegexReplace"}, "Tag", "Tag"},
+		{"ToLower", TransformRule{RuleType: "ToLower"}, "TagA", "taga"},
+		{"ToUpper", TransformRule{RuleType: "ToUpper"}, "TagA", "TAGA"},
+		{"Trim", TransformRule{RuleType: "Trim"}, "  Tag  ", "Tag"},
+		{"SplitAndSelect", TransformRule{RuleType: "SplitAndSelect", Pattern: ".", Index: 2}, "A.B.C", "C"},
+		{"SplitAndSelect越界", TransformRule{RuleType: "SplitAndSelect", Pattern: ".", Index: 5}, "A.B.C", "A.B.C"},
+		{"未知规则", TransformRule{RuleType: "Unknown"}, "Tag", "Tag"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			kt := NewKeyTransformer()
+			tc.rule.Enabled = true
+			kt.AddRule(tc.rule)
+			if got := kt.Transform(tc.in); got != tc.want {
+				t.Errorf("Transform(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestKeyTransformerChainAndDisabled(t *testing.T) {
+	kt := NewKeyTransformer()
+	kt.ImportRules([]TransformRule{
+		{RuleType: "RemovePrefix", Pattern: "Channel1.", Enabled: true},
+		{RuleType: "AddSuffix", Replacement: "_skip", Enabled: false},
+		{RuleType: "Replace", Pattern: ".", Replacement: "_", Enabled: true},
+		{RuleType: "ToLower", Enabled: true},
+	})
+	if got := kt.Transform("Channel1.Device1.TagA"); got != "device1_taga" {
+		t.Errorf("规则链结果 = %q", got)
+	}
+	if got := kt.Transform(""); got != "" {
+		t.Errorf("空键应原样返回，得到 %q", got)
+	}
+
+	kt.SetEnabled(false)
+	if got := kt.Transform("Channel1.Device1.TagA"); got != "Channel1.Device1.TagA" {
+		t.Errorf("禁用后应原样返回，得到 %q", got)
+	}
+	if len(kt.ExportRules()) != 4 {
+		t.Errorf("ExportRules 数量 = %d", len(kt.ExportRules()))
+	}
+}
+
+func TestKeyTransformerLoadFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transform.json")
+	content := `{"enabled": true, "rules": [
+		{"rule_type": "RemovePrefix", "pattern": "Ch1.", "enabled": true},
+		{"rule_type": "AddPrefix", "replacement": "p_", "enabled": true}
+	]}`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	kt := NewKeyTransformer()
+	if err := kt.LoadFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := kt.Transform("Ch1.Tag"); got != "p_Tag" {
+		t.Errorf("Transform = %q", got)
+	}
+
+	if err := kt.LoadFromFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("文件不存在时应返回错误")
+	}
+	os.WriteFile(path, []byte("{bad json"), 0644)
+	if err := kt.LoadFromFile(path); err == nil {
+		t.Error("JSON 无效时应返回错误")
+	}
+}
+
+func TestKeyTransformerInvalidRegex(t *testing.T) {
+	kt := NewKeyTransformer()
+	kt.ImportRules([]TransformRule{{RuleType: "ToLower", Enabled: true}})
+
+	err := kt.ImportRules([]TransformRule{
+		{RuleType: "Trim", Enabled: true},
+		{RuleType: "RegexReplace", Pattern: "(unclosed", Enabled: true},
+	})
+	if err == nil || !strings.Contains(err.Error(), "#2") {
+		t.Fatalf("无效正则应返回带规则序号的错误: %v", err)
+	}
+	// 导入失败时保留原有规则
+	if got := kt.Transform("TAG"); got != "tag" {
+		t.Errorf("导入失败后 Transform = %q", got)
+	}
+	if err := kt.AddRule(TransformRule{RuleType: "RegexReplace", Pattern: "[", Enabled: true}); err == nil || !strings.Contains(err.Error(), "#2") {
+		t.Errorf("AddRule 无效正则: %v", err)
+	}
+	// 禁用的规则不校验
+	if err := kt.ImportRules([]TransformRule{{RuleType: "RegexReplace", Pattern: "(", Enabled: false}}); err != nil {
+		t.Errorf("禁用的规则不应校验: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "transform.json")
+	os.WriteFile(path, []byte(`{"enabled": true, "rules": [{"rule_type": "AddPrefix", "replacement": "p_", "enabled": true}]}`), 0644)
+	if err := kt.LoadFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(path, []byte(`{"enabled": true, "rules": [{"rule_type": "RegexReplace", "pattern": "a{2,1}", "enabled": true}]}`), 0644)
+	if err := kt.LoadFromFile(path); err == nil || !strings.Contains(err.Error(), "#1") {
+		t.Errorf("LoadFromFile 无效正则: %v", err)
+	}
+	if got := kt.Transform("x"); got != "p_x" {
+		t.Errorf("加载失败后应保留原有规则，得到 %q", got)
+	}
+}
+
+func BenchmarkKeyTransformer10k(b *testing.B) {
+	kt := NewKeyTransformer()
+	kt.ImportRules([]TransformRule{
+		{RuleType: "RemovePrefix", Pattern: "lt.sc.", Enabled: true},
+		{RuleType: "RegexReplace", Pattern: `[^\w\.]+`, Replacement: "_", Enabled: true},
+		{RuleType: "RegexReplace", Pattern: `^(\d+)_M`, Replacement: "m${1}_", Enabled: true},
+		{RuleType: "Replace", Pattern: ".", Replacement: "_", Enabled: true},
+		{RuleType: "ToLower", Enabled: true},
+	})
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("lt.sc.%d_M%04d-ZZT #%d", 20250+i%8, i, i%3)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, key := range keys {
+			kt.Transform(key)
+		}
+	}
+}
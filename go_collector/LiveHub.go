@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LiveHub 把 processAndPublish 产出的每批数据（转换、映射之后，与输出端收到的一致）
+// 广播给 /api/live 的 SSE 订阅者。订阅者处理不过来时丢弃该批，不阻塞采集。
+
+type LiveFilter struct {
+	Task   string
+	Source string
+	Prefix string
+	Keys   map[string]bool
+}
+
+type liveSubscriber struct {
+	filter  LiveFilter
+	ch      chan []byte
+	dropped int
+}
+
+type LiveHub struct {
+	mu   sync.Mutex
+	subs map[*liveSubscriber]struct{}
+}
+
+func NewLiveHub() *LiveHub {
+	return &LiveHub{subs: make(map[*liveSubscriber]struct{})}
+}
+
+func (h *LiveHub) subscribe(filter LiveFilter) *liveSubscriber {
+	sub := &liveSubscriber{filter: filter, ch: make(chan []byte, 64)}
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+	return sub
+}
+
+func (h *LiveHub) unsubscribe(sub *liveSubscriber) {
+	h.mu.Lock()
+	delete(h.subs, sub)
+	h.mu.Unlock()
+}
+
+// Publish 向所有订阅者推送一批数据，按各自的过滤条件裁剪
+func (h *LiveHub) Publish(task, source string, message map[string]interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.subs) == 0 {
+		return
+	}
+
+	values, _ := message["values"].(map[string]interface{})
+	metadata := messageMetadata(message)
+	for sub := range h.subs {
+		f := sub.filter
+		if (f.Task != "" && f.Task != task) || (f.Source != "" && f.Source != source) {
+			continue
+		}
+		event := map[string]interface{}{
+			"task":      task,
+			"source":    source,
+			"timestamp": message["timestamp"],
+		}
+		if f.Prefix == "" && len(f.Keys) == 0 {
+			event["values"], event["metadata"] = values, metadata
+		} else {
+			filtered := make(map[string]interface{})
+			filteredMeta := make(map[string]map[string]interface{})
+			for key, value := range values {
+				if (f.Prefix != "" && !strings.HasPrefix(key, f.Prefix)) || (len(f.Keys) > 0 && !f.Keys[key]) {
+					continue
+				}
+				filtered[key] = value
+				filteredMeta[key] = metadata[key]
+			}
+			if len(filtered) == 0 {
+				continue
+			}
+			event["values"], event["metadata"] = filtered, filteredMeta
+		}
+
+		data, err := json.Marshal(event)
+		if err != nil {
+			continue
+		}
+		select {
+		case sub.ch <- data:
+		default:
+			sub.dropped++
+		}
+	}
+}
+
+// handleLive 以 SSE 推送实时数据，参数 task / source / prefix / keys(逗号分隔) 均可选
+func (ws *WebServer) handleLive(w http.ResponseWriter, r *http.Request) {
+	if ws.collector == nil {
+		ws.writeJSON(w, false, "采集器未启动", nil)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		ws.writeJSON(w, false, "当前连接不支持流式推送", nil)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := LiveFilter{
+		Task:   query.Get("task"),
+		Source: query.Get("source"),
+		Prefix: query.Get("prefix"),
+	}
+	if keys := query.Get("keys"); keys != "" {
+		filter.Keys = make(map[string]bool)
+		for _, key := range strings.Split(keys, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				filter.Keys[key] = true
+			}
+		}
+	}
+
+	sub := ws.collector.live.subscribe(filter)
+	defer ws.collector.live.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	fmt.Fprint(w, "retry: 3000\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+	reported := 0
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case data := <-sub.ch:
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			// 顺带告知客户端因处理过慢被丢弃的批数
+			ws.collector.live.mu.Lock()
+			dropped := sub.dropped
+			ws.collector.live.mu.Unlock()
+			if dropped > reported {
+				fmt.Fprintf(w, "event: dropped\ndata: {\"dropped\":%d}\n\n", dropped-reported)
+				reported = dropped
+			} else {
+				fmt.Fprint(w, ": ping\n\n")
+			}
+			flusher.Flush()
+		}
+	}
+}
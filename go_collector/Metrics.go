@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 采集器运行指标，/metrics 以 Prometheus 文本格式（text/plain; version=0.0.4）输出。
+// 计数类指标在各处埋点累加；连接状态、缓冲积压等在抓取时从 Collector 现场读取。
+
+var (
+	metricPointsCollected = newMetricVec("opc_collector_points_collected_total", "counter", "从数据源读取的点数", "task")
+	metricPointsPublished = newMetricVec("opc_collector_points_published_total", "counter", "经过滤（白名单/按变化上报）后发布的点数", "task")
+	metricLastCollect     = newMetricVec("opc_collector_last_collect_timestamp_seconds", "gauge", "最近一次收到数据的时间（Unix 秒）", "task")
+	metricSinkPublished   = newMetricVec("opc_collector_sink_publish_total", "counter", "成功发送到输出端的批数", "sink")
+	metricSinkFailures    = newMetricVec("opc_collector_sink_publish_failures_total", "counter", "发送到输出端失败的批数", "sink")
+	metricSinkBuffered    = newMetricVec("opc_collector_sink_buffered_total", "counter", "写入磁盘缓冲的批数", "sink")
+	metricSseReconnects   = newMetricVec("opc_collector_sse_reconnects_total", "counter", "SSE 重连次数", "source")
+	metricFetchErrors     = newMetricVec("opc_collector_http_fetch_errors_total", "counter", "HTTP 轮询失败次数", "source")
+	metricJsErrors        = newMetricVec("opc_collector_js_transform_errors_total", "counter", "MQTT js_transform 执行失败次数")
+	metricWrites          = newMetricVec("opc_collector_writes_total", "counter", "MQTT 写入命令数（ok / rejected / failed）", "result")
+	metricKeyCollisions   = newMetricVec("opc_collector_key_collisions", "gauge", "当前存在冲突的发布键数", "task")
+	metricFetchDuration   = newHistogramVec("opc_collector_http_fetch_duration_seconds", "HTTP 轮询耗时",
+		[]float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}, "source")
+)
+
+// metricVec 是带标签的计数器 / 仪表
+type metricVec struct {
+	name   string
+	kind   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labelValues []string
+	value       float64
+}
+
+func newMetricVec(name, kind, help string, labels ...string) *metricVec {
+	return &metricVec{name: name, kind: kind, help: help, labels: labels, series: make(map[string]*metricSeries)}
+}
+
+func (v *metricVec) get(labelValues []string) *metricSeries {
+	key := strings.Join(labelValues, "\xff")
+	s := v.series[key]
+	if s == nil {
+		s = &metricSeries{labelValues: append([]string(nil), labelValues...)}
+		v.series[key] = s
+	}
+	return s
+}
+
+func (v *metricVec) Add(delta float64, labelValues ...string) {
+	v.mu.Lock()
+	v.get(labelValues).value += delta
+	v.mu.Unlock()
+}
+
+func (v *metricVec) Inc(labelValues ...string) {
+	v.Add(1, labelValues...)
+}
+
+func (v *metricVec) Set(value float64, labelValues ...string) {
+	v.mu.Lock()
+	v.get(labelValues).value = value
+	v.mu.Unlock()
+}
+
+func (v *metricVec) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	writeMetricHeader(w, v.name, v.kind, v.help)
+	for _, key := range sortedSeriesKeys(v.series) {
+		s := v.series[key]
+		fmt.Fprintf(w, "%s%s %s\n", v.name, formatLabels(v.labels, s.labelValues, "", ""), formatMetricValue(s.value))
+	}
+}
+
+// histogramVec 是带标签的直方图，bucket 为累计计数
+type histogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64
+	count       uint64
+	sum         float64
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogramSeries)}
+}
+
+func (h *histogramVec) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := strings.Join(labelValues, "\xff")
+	s := h.series[key]
+	if s == nil {
+		s = &histogramSeries{labelValues: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeMetricHeader(w, h.name, "histogram", h.help)
+	for _, key := range sortedSeriesKeys(h.series) {
+		s := h.series[key]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, s.labelValues, "le", formatMetricValue(bound)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, s.labelValues, "", ""), formatMetricValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, s.labelValues, "", ""), s.count)
+	}
+}
+
+func sortedSeriesKeys[T any](series map[string]T) []string {
+	keys := make([]string, 0, len(series))
+	for k := range series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeMetricHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+// formatLabels 生成 {a="x",b="y"}，extraName 非空时追加一个标签（直方图的 le）
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	parts := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		parts = append(parts, name+"=\""+escapeLabelValue(value)+"\"")
+	}
+	if extraName != "" {
+		parts = append(parts, extraName+"=\""+extraValue+"\"")
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func escapeLabelValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, "\n", `\n`)
+	return strings.ReplaceAll(v, `"`, `\"`)
+}
+
+func formatMetricValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func boolMetric(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// writeMetrics 输出全部指标；collector 为 nil 时只输出累计类指标
+func writeMetrics(w io.Writer, collector *Collector) {
+	for _, v := range []*metricVec{
+		metricPointsCollected, metricPointsPublished, metricLastCollect,
+		metricSinkPublished, metricSinkFailures, metricSinkBuffered,
+		metricSseReconnects, metricFetchErrors, metricJsErrors,
+		metricWrites, metricKeyCollisions,
+	} {
+		v.write(w)
+	}
+	metricFetchDuration.write(w)
+
+	// 以下为抓取时的现场状态
+	up := newMetricVec("opc_collector_running", "gauge", "采集器是否运行中")
+	connected := newMetricVec("opc_collector_sink_connected", "gauge", "输出端连接状态（1=已连接）", "sink")
+	reconnects := newMetricVec("opc_collector_sink_reconnects_total", "counter", "输出端重连成功次数", "sink")
+	depth := newMetricVec("opc_collector_buffer_depth", "gauge", "磁盘缓冲积压批数", "sink")
+	bytes := newMetricVec("opc_collector_buffer_bytes", "gauge", "磁盘缓冲积压字节数", "sink")
+
+	if collector != nil {
+		current := collector.snapshot()
+		up.Set(boolMetric(current.running))
+		if current.mqttClient != nil {
+			status := current.mqttClient.Status()
+			connected.Set(boolMetric(status.Connected), "mqtt")
+			reconnects.Set(float64(status.Reconnects), "mqtt")
+		}
+		if current.rtdbClient != nil {
+			status := current.rtdbClient.Status()
+			connected.Set(boolMetric(status.Connected), "rtdb")
+			reconnects.Set(float64(status.Reconnects), "rtdb")
+		}
+		if current.mqttBuffer != nil {
+			depth.Set(float64(current.mqttBuffer.Len()), "mqtt")
+			bytes.Set(float64(current.mqttBuffer.Size()), "mqtt")
+		}
+		if current.rtdbBuffer != nil {
+			depth.Set(float64(current.rtdbBuffer.Len()), "rtdb")
+			bytes.Set(float64(current.rtdbBuffer.Size()), "rtdb")
+		}
+	}
+	for _, v := range []*metricVec{up, connected, reconnects, depth, bytes} {
+		v.write(w)
+	}
+}
+
+// handleMetrics 提供 Prometheus 抓取接口
+func (ws *WebServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeMetrics(w, ws.collector)
+}
+
+// observeSince 记录从 start 到现在的耗时（秒）
+func observeSince(h *histogramVec, start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// 运行时状态：记录每个采集任务正在做什么，供 /api/status 与运行状态页展示。
+
+const (
+	RunnerModePolling = "polling"
+	RunnerModeSse     = "sse"
+)
+
+// rateWindow 是计算每秒点数的滑动窗口长度
+const rateWindow = 30 * time.Second
+
+type rateSample struct {
+	at    time.Time
+	total int64
+}
+
+// runnerState 由任务协程写入、Web 接口读取
+type runnerState struct {
+	mu            sync.Mutex
+	running       bool
+	mode          string
+	sseConnected  bool
+	lastCollect   time.Time
+	lastError     string
+	lastErrorTime time.Time
+	pointsTotal   int64
+	publishTotal  int64
+	samples       []rateSample
+}
+
+// TaskStatus 是单个任务的运行状态
+type TaskStatus struct {
+	Name            string  `json:"name"`
+	HttpSource      string  `json:"http_source"`
+	Running         bool    `json:"running"`
+	Mode            string  `json:"mode"`
+	SseConnected    bool    `json:"sse_connected"`
+	LastCollectTime string  `json:"last_collect_time,omitempty"`
+	LastError       string  `json:"last_error,omitempty"`
+	LastErrorTime   string  `json:"last_error_time,omitempty"`
+	PointsTotal     int64   `json:"points_total"`
+	PublishedTotal  int64   `json:"published_total"`
+	PointsPerSecond float64 `json:"points_per_second"`
+}
+
+// BufferStatus 是磁盘缓冲的积压情况
+type BufferStatus struct {
+	Batches int   `json:"batches"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// CollectorStatus 是 /api/status 的返回结构
+type CollectorStatus struct {
+	Running       bool                     `json:"running"`
+	StartTime     string                   `json:"start_time,omitempty"`
+	UptimeSeconds int64                    `json:"uptime_seconds"`
+	Tasks         []TaskStatus             `json:"tasks"`
+	Mqtt          *ConnectionStatus        `json:"mqtt,omitempty"`
+	Rtdb          *ConnectionStatus        `json:"rtdb,omitempty"`
+	Buffers       map[string]*BufferStatus `json:"buffers,omitempty"`
+}
+
+func (s *runnerState) setRunning(running bool, mode string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = running
+	if mode != "" {
+		s.mode = mode
+	}
+	if !running {
+		s.sseConnected = false
+	}
+}
+
+func (s *runnerState) setSseConnected(connected bool) {
+	s.mu.Lock()
+	s.sseConnected = connected
+	s.mu.Unlock()
+}
+
+func (s *runnerState) recordError(err error) {
+	s.mu.Lock()
+	s.lastError = err.Error()
+	s.lastErrorTime = time.Now()
+	s.mu.Unlock()
+}
+
+// recordCollect 记录一次采集：collected 为数据源返回的点数，published 为实际发布的点数
+func (s *runnerState) recordCollect(now time.Time, collected, published int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastCollect = now
+	s.pointsTotal += int64(collected)
+	s.publishTotal += int64(published)
+	s.samples = append(s.samples, rateSample{at: now, total: s.pointsTotal})
+	cutoff := now.Add(-rateWindow)
+	i := 0
+	for i < len(s.samples)-1 && s.samples[i].at.Before(cutoff) {
+		i++
+	}
+	s.samples = s.samples[i:]
+}
+
+func (s *runnerState) snapshot(name string, task *TaskConfig) TaskStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := TaskStatus{
+		Name:           name,
+		HttpSource:     task.HttpSource,
+		Running:        s.running,
+		Mode:           s.mode,
+		SseConnected:   s.sseConnected,
+		LastError:      s.lastError,
+		PointsTotal:    s.pointsTotal,
+		PublishedTotal: s.publishTotal,
+	}
+	if !s.lastCollect.IsZero() {
+		status.LastCollectTime = s.lastCollect.Format(time.RFC3339)
+	}
+	if !s.lastErrorTime.IsZero() {
+		status.LastErrorTime = s.lastErrorTime.Format(time.RFC3339)
+	}
+	// 窗口内首尾样本之差 / 时间跨度；超过一个窗口没有新数据时视为 0
+	if n := len(s.samples); n >= 2 && time.Since(s.samples[n-1].at) < rateWindow {
+		span := s.samples[n-1].at.Sub(s.samples[0].at).Seconds()
+		if span > 0 {
+			status.PointsPerSecond = float64(s.samples[n-1].total-s.samples[0].total) / span
+		}
+	}
+	return status
+}
+
+// Status 汇总采集器当前的运行状态
+func (c *Collector) Status() CollectorStatus {
+	current := c.snapshot()
+	c.mu.Lock()
+	runners := c.runners
+	started := c.startTime
+	c.mu.Unlock()
+
+	status := CollectorStatus{
+		Running: current.running,
+		Tasks:   make([]TaskStatus, 0, len(runners)),
+	}
+	if current.running && !started.IsZero() {
+		status.StartTime = started.Format(time.RFC3339)
+		status.UptimeSeconds = int64(time.Since(started).Seconds())
+	}
+	for _, runner := range runners {
+		status.Tasks = append(status.Tasks, runner.state.snapshot(runner.name, runner.task))
+	}
+	if current.mqttClient != nil {
+		s := current.mqttClient.Status()
+		status.Mqtt = &s
+	}
+	if current.rtdbClient != nil {
+		s := current.rtdbClient.Status()
+		status.Rtdb = &s
+	}
+	if current.mqttBuffer != nil || current.rtdbBuffer != nil {
+		status.Buffers = make(map[string]*BufferStatus)
+		if current.mqttBuffer != nil {
+			status.Buffers["mqtt"] = &BufferStatus{Batches: current.mqttBuffer.Len(), Bytes: current.mqttBuffer.Size()}
+		}
+		if current.rtdbBuffer != nil {
+			status.Buffers["rtdb"] = &BufferStatus{Batches: current.rtdbBuffer.Len(), Bytes: current.rtdbBuffer.Size()}
+		}
+	}
+	return status
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Simulator 内置模拟数据源：按点定义生成正弦、斜坡、随机游走、阶跃、开关量等数据，
+// 可叠加周期性坏质量，输出与 fetchFromHttp 相同的原始数据，供无 OPC 代理时联调 MQTT / RTDB。
+
+const (
+	SimTypeSine       = "sine"
+	SimTypeRamp       = "ramp"
+	SimTypeRandomWalk = "random_walk"
+	SimTypeStep       = "step"
+	SimTypeBool       = "bool"
+)
+
+// SimTag 是一个模拟点的定义
+type SimTag struct {
+	Name string  `json:"name"`
+	Type string  `json:"type"`
+	Min  float64 `json:"min"`
+	Max  float64 `json:"max"`
+	// 周期（秒）：正弦 / 斜坡的周期，阶跃每档的保持时间，开关量每个状态的保持时间；默认 60
+	Period float64 `json:"period,omitempty"`
+	// 随机游走的单次最大步长，默认 (max-min)/50
+	Step float64 `json:"step,omitempty"`
+	// 阶跃的各档取值，未配置时在 min / max 间切换
+	Values []float64 `json:"values,omitempty"`
+	// 小数位，默认 3
+	Precision *int `json:"precision,omitempty"`
+	// 坏质量突发：每 bad_every 秒中有 bad_seconds 秒质量为 Bad(0)，期间保持最后的好值
+	BadEvery   float64 `json:"bad_every,omitempty"`
+	BadSeconds float64 `json:"bad_seconds,omitempty"`
+}
+
+// SimFile 是模拟点定义文件的内容
+type SimFile struct {
+	Seed int64    `json:"seed,omitempty"`
+	Tags []SimTag `json:"tags"`
+}
+
+type Simulator struct {
+	tags  []SimTag
+	start time.Time
+
+	mu   sync.Mutex
+	rand *rand.Rand
+	walk map[string]float64
+	last map[string]interface{}
+}
+
+// defaultSimTags 未指定定义文件时使用的示例点，覆盖全部波形
+func defaultSimTags() []SimTag {
+	return []SimTag{
+		{Name: "Sim.Sine", Type: SimTypeSine, Min: 0, Max: 100, Period: 60},
+		{Name: "Sim.Ramp", Type: SimTypeRamp, Min: 0, Max: 100, Period: 30},
+		{Name: "Sim.RandomWalk", Type: SimTypeRandomWalk, Min: 0, Max: 10, Step: 0.5},
+		{Name: "Sim.Step", Type: SimTypeStep, Values: []float64{0, 50, 100}, Period: 10},
+		{Name: "Sim.Toggle", Type: SimTypeBool, Period: 15},
+		{Name: "Sim.BadBurst", Type: SimTypeSine, Min: 20, Max: 30, Period: 45, BadEvery: 60, BadSeconds: 10},
+	}
+}
+
+// LoadSimulator 从定义文件创建模拟器，path 为空时使用内置示例点
+func LoadSimulator(path string) (*Simulator, error) {
+	file := SimFile{Tags: defaultSimTags()}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		file = SimFile{}
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("解析模拟点定义失败: %v", err)
+		}
+	}
+	return NewSimulator(file, time.Now())
+}
+
+// NewSimulator 校验点定义并创建模拟器，start 为波形的时间零点
+func NewSimulator(file SimFile, start time.Time) (*Simulator, error) {
+	if len(file.Tags) == 0 {
+		return nil, fmt.Errorf("未定义模拟点")
+	}
+	seen := make(map[string]bool, len(file.Tags))
+	tags := make([]SimTag, len(file.Tags))
+	for i, tag := range file.Tags {
+		tag.Type = strings.ToLower(strings.TrimSpace(tag.Type))
+		if tag.Name == "" {
+			return nil, fmt.Errorf("第%d个模拟点缺少 name", i+1)
+		}
+		if seen[tag.Name] {
+			return nil, fmt.Errorf("模拟点 %s 重复定义", tag.Name)
+		}
+		seen[tag.Name] = true
+		switch tag.Type {
+		case SimTypeSine, SimTypeRamp, SimTypeRandomWalk, SimTypeStep, SimTypeBool:
+		default:
+			return nil, fmt.Errorf("模拟点 %s 的类型 %q 无效", tag.Name, tag.Type)
+		}
+		if tag.Max < tag.Min {
+			return nil, fmt.Errorf("模拟点 %s 的 max 小于 min", tag.Name)
+		}
+		if tag.Period <= 0 {
+			tag.Period = 60
+		}
+		if tag.Step <= 0 {
+			tag.Step = (tag.Max - tag.Min) / 50
+		}
+		if tag.BadEvery > 0 && (tag.BadSeconds <= 0 || tag.BadSeconds >= tag.BadEvery) {
+			return nil, fmt.Errorf("模拟点 %s 的 bad_seconds 需大于 0 且小于 bad_every", tag.Name)
+		}
+		tags[i] = tag
+	}
+
+	seed := file.Seed
+	if seed == 0 {
+		seed = start.UnixNano()
+	}
+	return &Simulator{
+		tags:  tags,
+		start: start,
+		rand:  rand.New(rand.NewSource(seed)),
+		walk:  make(map[string]float64),
+		last:  make(map[string]interface{}),
+	}, nil
+}
+
+// TagCount 返回模拟点数量
+func (s *Simulator) TagCount() int {
+	return len(s.tags)
+}
+
+// Sample 生成 now 时刻的一批原始数据，格式同 fetchFromHttp
+func (s *Simulator) Sample(now time.Time) []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elapsed := now.Sub(s.start).Seconds()
+	timestamp := now.Format(time.RFC3339Nano)
+	result := make([]map[string]interface{}, 0, len(s.tags))
+	for _, tag := range s.tags {
+		value := s.value(tag, elapsed)
+		quality := 192
+		if tag.BadEvery > 0 && math.Mod(elapsed, tag.BadEvery) >= tag.BadEvery-tag.BadSeconds {
+			// 坏质量期间代理仍返回最后的值
+			quality = 0
+			if last, ok := s.last[tag.Name]; ok {
+				value = last
+			}
+		} else {
+			s.last[tag.Name] = value
+		}
+
+		dataType := "Double"
+		if tag.Type == SimTypeBool {
+			dataType = "Boolean"
+		}
+		result = append(result, sourceItem(tag.Name, value, map[string]interface{}{
+			"quality":   quality,
+			"timestamp": timestamp,
+			"data_type": dataType,
+		}))
+	}
+	return result
+}
+
+func (s *Simulator) value(tag SimTag, elapsed float64) interface{} {
+	var v float64
+	switch tag.Type {
+	case SimTypeSine:
+		mid, amp := (tag.Max+tag.Min)/2, (tag.Max-tag.Min)/2
+		v = mid + amp*math.Sin(2*math.Pi*elapsed/tag.Period)
+	case SimTypeRamp:
+		v = tag.Min + (tag.Max-tag.Min)*math.Mod(elapsed, tag.Period)/tag.Period
+	case SimTypeRandomWalk:
+		current, ok := s.walk[tag.Name]
+		if !ok {
+			current = (tag.Max + tag.Min) / 2
+		} else {
+			current += (s.rand.Float64()*2 - 1) * tag.Step
+		}
+		v = math.Max(tag.Min, math.Min(tag.Max, current))
+		s.walk[tag.Name] = v
+	case SimTypeStep:
+		levels := tag.Values
+		if len(levels) == 0 {
+			levels = []float64{tag.Min, tag.Max}
+		}
+		v = levels[int(elapsed/tag.Period)%len(levels)]
+	case SimTypeBool:
+		return int(elapsed/tag.Period)%2 == 1
+	}
+
+	precision := 3
+	if tag.Precision != nil {
+		precision = *tag.Precision
+	}
+	scale := math.Pow(10, float64(precision))
+	return math.Round(v*scale) / scale
+}
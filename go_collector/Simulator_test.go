@@ -0,0 +1,156 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func sampleByKey(items []map[string]interface{}) map[string]map[string]interface{} {
+	result := make(map[string]map[string]interface{}, len(items))
+	for _, item := range items {
+		result[item["topic"].(string)] = item
+	}
+	return result
+}
+
+func TestSimulatorWaveforms(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local)
+	sim, err := NewSimulator(SimFile{Seed: 1, Tags: []SimTag{
+		{Name: "sine", Type: SimTypeSine, Min: 0, Max: 100, Period: 40},
+		{Name: "ramp", Type: "Ramp", Min: 0, Max: 100, Period: 40},
+		{Name: "step", Type: SimTypeStep, Values: []float64{1, 2, 3}, Period: 10},
+		{Name: "toggle", Type: SimTypeBool, Period: 10},
+		{Name: "walk", Type: SimTypeRandomWalk, Min: 0, Max: 1, Step: 5},
+	}}, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		offset time.Duration
+		want   map[string]interface{}
+	}{
+		{0, map[string]interface{}{"sine": 50.0, "ramp": 0.0, "step": 1.0, "toggle": false, "walk": 0.5}},
+		{10 * time.Second, map[string]interface{}{"sine": 100.0, "ramp": 25.0, "step": 2.0, "toggle": true}},
+		{30 * time.Second, map[string]interface{}{"sine": 0.0, "ramp": 75.0, "step": 1.0, "toggle": true}},
+	}
+	for _, tc := range cases {
+		items := sampleByKey(sim.Sample(start.Add(tc.offset)))
+		for key, want := range tc.want {
+			if got := items[key]["value"]; got != want {
+				t.Errorf("+%v %s = %v, want %v", tc.offset, key, got, want)
+			}
+		}
+		// 步长远大于范围时，随机游走被限制在 [min, max] 内
+		if walk := items["walk"]["value"].(float64); walk < 0 || walk > 1 {
+			t.Errorf("+%v walk = %v 超出范围", tc.offset, walk)
+		}
+	}
+}
+
+func TestSimulatorSampleShape(t *testing.T) {
+	start := time.Now()
+	sim, err := NewSimulator(SimFile{Tags: []SimTag{
+		{Name: "flow", Type: SimTypeRamp, Min: 0, Max: 60, Period: 60, BadEvery: 30, BadSeconds: 10},
+		{Name: "run", Type: SimTypeBool},
+	}}, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := start.Add(5 * time.Second)
+	items := sampleByKey(sim.Sample(now))
+	flow := items["flow"]
+	if flow["quality"] != 192 || flow["value"] != 5.0 || flow["data_type"] != "Double" {
+		t.Errorf("flow = %v", flow)
+	}
+	if ts, _ := flow["timestamp"].(int64); ts != now.UnixMilli() {
+		t.Errorf("timestamp = %v, want %d", flow["timestamp"], now.UnixMilli())
+	}
+	if items["run"]["data_type"] != "Boolean" {
+		t.Errorf("run = %v", items["run"])
+	}
+
+	// 第 20~30 秒为坏质量，值保持最后的好值
+	sim.Sample(start.Add(19 * time.Second))
+	bad := sampleByKey(sim.Sample(start.Add(25 * time.Second)))["flow"]
+	if bad["quality"] != 0 || bad["value"] != 19.0 {
+		t.Errorf("坏质量期间 flow = %v", bad)
+	}
+	good := sampleByKey(sim.Sample(start.Add(31 * time.Second)))["flow"]
+	if good["quality"] != 192 || good["value"] != 31.0 {
+		t.Errorf("恢复后 flow = %v", good)
+	}
+}
+
+func TestSimulatorValidation(t *testing.T) {
+	cases := []struct {
+		name string
+		tags []SimTag
+	}{
+		{"无模拟点", nil},
+		{"缺少name", []SimTag{{Type: SimTypeSine}}},
+		{"重复name", []SimTag{{Name: "a", Type: SimTypeSine}, {Name: "a", Type: SimTypeRamp}}},
+		{"类型无效", []SimTag{{Name: "a", Type: "square"}}},
+		{"max小于min", []SimTag{{Name: "a", Type: SimTypeSine, Min: 10, Max: 1}}},
+		{"坏质量时长无效", []SimTag{{Name: "a", Type: SimTypeSine, BadEvery: 10, BadSeconds: 10}}},
+	}
+	for _, tc := range cases {
+		if _, err := NewSimulator(SimFile{Tags: tc.tags}, time.Now()); err == nil {
+			t.Errorf("%s: 应返回错误", tc.name)
+		}
+	}
+}
+
+func TestLoadSimulator(t *testing.T) {
+	sim, err := LoadSimulator("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sim.TagCount() != len(defaultSimTags()) {
+		t.Errorf("内置示例点数量 = %d", sim.TagCount())
+	}
+
+	path := filepath.Join(t.TempDir(), "simulate.json")
+	os.WriteFile(path, []byte(`{"tags": [{"name": "T1", "type": "sine", "min": 0, "max": 1}]}`), 0644)
+	if sim, err = LoadSimulator(path); err != nil || sim.TagCount() != 1 {
+		t.Errorf("LoadSimulator = %v, %v", sim, err)
+	}
+	if _, err := LoadSimulator(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("文件不存在时应返回错误")
+	}
+}
+
+func TestCollectorSimulatedSource(t *testing.T) {
+	rtdb := newFakeRtdb(t)
+	dir := t.TempDir()
+	simFile := filepath.Join(dir, "simulate.json")
+	os.WriteFile(simFile, []byte(`{"tags": [{"name": "Sim.Level", "type": "step", "values": [42], "period": 10}]}`), 0644)
+
+	startTestCollector(t, &AppConfig{
+		HttpConfigs: []*HttpConfig{{Name: "sim", Enabled: true, Type: HttpTypeSimulate, SimFile: simFile}},
+		RtdbConfig:  &RtdbConfig{Enabled: true, Host: "127.0.0.1", Port: rtdb.port()},
+		Tasks:       []*TaskConfig{testTask("sim", &TagMapping{OpcTag: "Sim.Level", DbName: "level"})},
+	})
+	rtdb.waitLine(t, "模拟数据", linePrefix("level,42,192,"))
+}
+
+func TestCollectorSimulateFlag(t *testing.T) {
+	rtdb := newFakeRtdb(t)
+	t.Chdir(t.TempDir())
+
+	// --simulate：HTTP 数据源改用模拟数据（未指定 sim_file 时为内置示例点），不访问 URL
+	collector := NewCollector(&AppConfig{
+		HttpConfigs: []*HttpConfig{{Name: "line1", Enabled: true, Url: "http://127.0.0.1:1/api/stream"}},
+		RtdbConfig:  &RtdbConfig{Enabled: true, Host: "127.0.0.1", Port: rtdb.port()},
+		Tasks:       []*TaskConfig{testTask("line1")},
+	})
+	collector.simulate = true
+	if err := collector.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(collector.Stop)
+	rtdb.waitLine(t, "内置示例点", linePrefix("Sim.Step,0,192,"))
+}
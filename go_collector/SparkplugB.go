@@ -0,0 +1,487 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Sparkplug B（spBv1.0）输出：NBIRTH / DBIRTH / DDATA / NDEATH，payload 为 protobuf 编码。
+// 每个数据源对应一个 Device；DBIRTH 中为每个点分配 alias，之后的 DDATA 只携带 alias。
+// bdSeq 在每次发起 MQTT 连接时递增（包括 paho 自动重连），重连前同时更新遗嘱，保证 NDEATH 与随后的 NBIRTH 一致。
+
+const sparkplugNamespace = "spBv1.0"
+
+// Sparkplug B 数据类型
+const (
+	spTypeInt32   = 3
+	spTypeInt64   = 4
+	spTypeUInt64  = 8
+	spTypeFloat   = 9
+	spTypeDouble  = 10
+	spTypeBoolean = 11
+	spTypeString  = 12
+)
+
+const spRebirthMetric = "Node Control/Rebirth"
+
+type sparkplugState struct {
+	groupId    string
+	edgeNodeId string
+
+	// publishMu 保证报文按 seq 顺序发出
+	publishMu sync.Mutex
+
+	mu        sync.Mutex
+	bdSeq     uint64
+	seq       uint64
+	nodeBorn  bool
+	nextAlias uint64
+	devices   map[string]*sparkplugDevice
+}
+
+type sparkplugDevice struct {
+	born    bool
+	metrics map[string]*sparkplugMetricInfo
+}
+
+type sparkplugMetricInfo struct {
+	alias    uint64
+	dataType uint32
+	value    interface{}
+	quality  int
+	ts       int64
+}
+
+type sparkplugMetric struct {
+	name     string
+	alias    uint64
+	ts       int64
+	dataType uint32
+	value    interface{}
+	quality  int
+	hasQual  bool
+}
+
+// bdSeq 在进程内跨 MQTT 客户端递增（热加载会新建客户端）
+var (
+	sparkplugBdSeqMu sync.Mutex
+	sparkplugBdSeq   uint64
+)
+
+func nextSparkplugBdSeq() uint64 {
+	sparkplugBdSeqMu.Lock()
+	defer sparkplugBdSeqMu.Unlock()
+	bdSeq := sparkplugBdSeq
+	sparkplugBdSeq = (sparkplugBdSeq + 1) % 256
+	return bdSeq
+}
+
+func newSparkplugState(config *MqttConfig) *sparkplugState {
+	bdSeq := nextSparkplugBdSeq()
+
+	groupId := config.SparkplugGroupId
+	if groupId == "" {
+		groupId = "opc"
+	}
+	edgeNodeId := config.SparkplugEdgeNodeId
+	if edgeNodeId == "" {
+		edgeNodeId = config.ClientId
+	}
+	if edgeNodeId == "" {
+		edgeNodeId = "opc_collector"
+	}
+	return &sparkplugState{
+		groupId:    groupId,
+		edgeNodeId: edgeNodeId,
+		bdSeq:      bdSeq,
+		devices:    make(map[string]*sparkplugDevice),
+	}
+}
+
+func (s *sparkplugState) nodeTopic(messageType string) string {
+	return fmt.Sprintf("%s/%s/%s/%s", sparkplugNamespace, s.groupId, messageType, s.edgeNodeId)
+}
+
+func (s *sparkplugState) deviceTopic(messageType, device string) string {
+	return fmt.Sprintf("%s/%s/%s/%s/%s", sparkplugNamespace, s.groupId, messageType, s.edgeNodeId, device)
+}
+
+// nextSeqLocked 返回下一条报文的 seq（0~255 循环）
+func (s *sparkplugState) nextSeqLocked() uint64 {
+	seq := s.seq
+	s.seq = (s.seq + 1) % 256
+	return seq
+}
+
+// deathPayload 生成 NDEATH（遗嘱）报文，只携带 bdSeq
+func (s *sparkplugState) deathPayload() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deathPayloadLocked()
+}
+
+func (s *sparkplugState) deathPayloadLocked() []byte {
+	return encodeSparkplugPayload(time.Now().UnixMilli(), nil, []sparkplugMetric{
+		{name: "bdSeq", dataType: spTypeUInt64, value: s.bdSeq, ts: time.Now().UnixMilli()},
+	})
+}
+
+// renewBdSeq 在重新发起连接前换用新的 bdSeq，返回新的遗嘱报文；连接成功后的 NBIRTH 携带同一个 bdSeq
+func (s *sparkplugState) renewBdSeq() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bdSeq = nextSparkplugBdSeq()
+	return s.deathPayloadLocked()
+}
+
+// nodeBirth 生成 NBIRTH，seq 从 0 重新开始，并要求所有设备重新发送 DBIRTH
+func (s *sparkplugState) nodeBirth() mqttMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nodeBirthLocked()
+}
+
+func (s *sparkplugState) nodeBirthLocked() mqttMessage {
+	now := time.Now().UnixMilli()
+	s.seq = 0
+	seq := s.nextSeqLocked()
+	s.nodeBorn = true
+	for _, device := range s.devices {
+		device.born = false
+	}
+	metrics := []sparkplugMetric{
+		{name: "bdSeq", dataType: spTypeUInt64, value: s.bdSeq, ts: now},
+		{name: spRebirthMetric, dataType: spTypeBoolean, value: false, ts: now},
+	}
+	return mqttMessage{
+		Topic:   s.nodeTopic("NBIRTH"),
+		Payload: string(encodeSparkplugPayload(now, &seq, metrics)),
+	}
+}
+
+// reset 在发布失败或重连后调用，下一批数据会重新发送 NBIRTH / DBIRTH
+func (s *sparkplugState) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nodeBorn = false
+	for _, device := range s.devices {
+		device.born = false
+	}
+}
+
+// render 把一批数据渲染为 Sparkplug 报文：必要时先补 NBIRTH / DBIRTH（出现新点或类型变化时重新出生），再发 DDATA
+func (s *sparkplugState) render(values map[string]interface{}, metadata map[string]map[string]interface{}, source string) []mqttMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if source == "" {
+		source = "default"
+	}
+	now := time.Now().UnixMilli()
+	messages := make([]mqttMessage, 0, 2)
+	if !s.nodeBorn {
+		messages = append(messages, s.nodeBirthLocked())
+	}
+
+	device := s.devices[source]
+	if device == nil {
+		device = &sparkplugDevice{metrics: make(map[string]*sparkplugMetricInfo)}
+		s.devices[source] = device
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	rebirth := !device.born
+	data := make([]sparkplugMetric, 0, len(keys))
+	for _, key := range keys {
+		value := values[key]
+		quality := 192
+		ts := now
+		if meta := metadata[key]; meta != nil {
+			if q, ok := meta["quality"].(int); ok {
+				quality = q
+			}
+			if t, ok := meta["timestamp"].(int64); ok {
+				ts = t
+			}
+		}
+
+		info := device.metrics[key]
+		dataType := sparkplugDataType(value)
+		if info == nil {
+			s.nextAlias++
+			info = &sparkplugMetricInfo{alias: s.nextAlias, dataType: dataType}
+			device.metrics[key] = info
+			rebirth = true
+		} else if value != nil && info.dataType != dataType {
+			info.dataType = dataType
+			rebirth = true
+		}
+		info.value, info.quality, info.ts = value, quality, ts
+
+		data = append(data, sparkplugMetric{alias: info.alias, ts: ts, dataType: info.dataType, value: value, quality: quality, hasQual: true})
+	}
+
+	if rebirth {
+		// DBIRTH 携带该设备全部已知点的名称、alias、类型与最新值
+		names := make([]string, 0, len(device.metrics))
+		for name := range device.metrics {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		birth := make([]sparkplugMetric, 0, len(names))
+		for _, name := range names {
+			info := device.metrics[name]
+			birth = append(birth, sparkplugMetric{name: name, alias: info.alias, ts: info.ts, dataType: info.dataType, value: info.value, quality: info.quality, hasQual: true})
+		}
+		seq := s.nextSeqLocked()
+		messages = append(messages, mqttMessage{
+			Topic:   s.deviceTopic("DBIRTH", source),
+			Payload: string(encodeSparkplugPayload(now, &seq, birth)),
+		})
+		device.born = true
+		return messages
+	}
+
+	seq := s.nextSeqLocked()
+	messages = append(messages, mqttMessage{
+		Topic:   s.deviceTopic("DDATA", source),
+		Payload: string(encodeSparkplugPayload(now, &seq, data)),
+	})
+	return messages
+}
+
+// sparkplugDataType 按 Go 值类型推断 Sparkplug 数据类型；JSON 数值默认 Double
+func sparkplugDataType(value interface{}) uint32 {
+	switch value.(type) {
+	case bool:
+		return spTypeBoolean
+	case string:
+		return spTypeString
+	case int, int32, int16, int8:
+		return spTypeInt32
+	case int64:
+		return spTypeInt64
+	case uint64, uint32, uint:
+		return spTypeUInt64
+	case float32:
+		return spTypeFloat
+	default:
+		return spTypeDouble
+	}
+}
+
+// isSparkplugRebirth 解析 NCMD 报文，判断是否为 Node Control/Rebirth=true 请求
+func isSparkplugRebirth(payload []byte) bool {
+	rebirth := false
+	walkProtobuf(payload, func(field int, wire int, v uint64, b []byte) {
+		if field != 2 || wire != 2 {
+			return
+		}
+		var name string
+		var flag bool
+		walkProtobuf(b, func(field int, wire int, v uint64, b []byte) {
+			switch {
+			case field == 1 && wire == 2:
+				name = string(b)
+			case field == 14 && wire == 0:
+				flag = v != 0
+			}
+		})
+		if name == spRebirthMetric && flag {
+			rebirth = true
+		}
+	})
+	return rebirth
+}
+
+// ---- protobuf 编解码（仅覆盖 Sparkplug B Payload 用到的字段） ----
+
+type pbWriter struct {
+	buf []byte
+}
+
+func (w *pbWriter) varint(v uint64) {
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+func (w *pbWriter) key(field int, wire int) {
+	w.varint(uint64(field)<<3 | uint64(wire))
+}
+
+func (w *pbWriter) uintField(field int, v uint64) {
+	w.key(field, 0)
+	w.varint(v)
+}
+
+func (w *pbWriter) boolField(field int, v bool) {
+	var n uint64
+	if v {
+		n = 1
+	}
+	w.uintField(field, n)
+}
+
+func (w *pbWriter) bytesField(field int, b []byte) {
+	w.key(field, 2)
+	w.varint(uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *pbWriter) doubleField(field int, v float64) {
+	w.key(field, 1)
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, math.Float64bits(v))
+}
+
+func (w *pbWriter) floatField(field int, v float32) {
+	w.key(field, 5)
+	w.buf = binary.LittleEndian.AppendUint32(w.buf, math.Float32bits(v))
+}
+
+func encodeSparkplugPayload(timestamp int64, seq *uint64, metrics []sparkplugMetric) []byte {
+	w := &pbWriter{}
+	w.uintField(1, uint64(timestamp))
+	for _, m := range metrics {
+		w.bytesField(2, encodeSparkplugMetric(m))
+	}
+	if seq != nil {
+		w.uintField(3, *seq)
+	}
+	return w.buf
+}
+
+func encodeSparkplugMetric(m sparkplugMetric) []byte {
+	w := &pbWriter{}
+	if m.name != "" {
+		w.bytesField(1, []byte(m.name))
+	}
+	if m.alias != 0 {
+		w.uintField(2, m.alias)
+	}
+	w.uintField(3, uint64(m.ts))
+	w.uintField(4, uint64(m.dataType))
+	if m.hasQual {
+		// 质量码作为属性 Quality(Int32) 携带，与常见 Sparkplug 主站约定一致
+		props := &pbWriter{}
+		props.bytesField(1, []byte("Quality"))
+		pv := &pbWriter{}
+		pv.uintField(1, spTypeInt32)
+		pv.uintField(3, uint64(uint32(int32(m.quality))))
+		props.bytesField(2, pv.buf)
+		w.bytesField(9, props.buf)
+	}
+	if m.value == nil {
+		w.boolField(7, true)
+		return w.buf
+	}
+	switch m.dataType {
+	case spTypeBoolean:
+		b, _ := m.value.(bool)
+		w.boolField(14, b)
+	case spTypeString:
+		w.bytesField(15, []byte(fmt.Sprintf("%v", m.value)))
+	case spTypeInt32:
+		w.uintField(10, uint64(uint32(int32(toFloat(m.value)))))
+	case spTypeInt64:
+		w.uintField(11, uint64(int64(toFloat(m.value))))
+	case spTypeUInt64:
+		switch v := m.value.(type) {
+		case uint64:
+			w.uintField(11, v)
+		default:
+			w.uintField(11, uint64(toFloat(v)))
+		}
+	case spTypeFloat:
+		w.floatField(12, float32(toFloat(m.value)))
+	default:
+		f, ok := m.value.(float64)
+		if !ok {
+			f = toFloat(m.value)
+		}
+		w.doubleField(13, f)
+	}
+	return w.buf
+}
+
+// toFloat 把常见数值类型转为 float64，非数值返回 0
+func toFloat(v interface{}) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case float32:
+		return float64(n)
+	case int:
+		return float64(n)
+	case int8:
+		return float64(n)
+	case int16:
+		return float64(n)
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case uint:
+		return float64(n)
+	case uint32:
+		return float64(n)
+	case uint64:
+		return float64(n)
+	case bool:
+		if n {
+			return 1
+		}
+	}
+	return 0
+}
+
+// walkProtobuf 依次回调每个字段；varint 字段通过 v 传值，长度前缀字段通过 b 传内容
+func walkProtobuf(data []byte, fn func(field int, wire int, v uint64, b []byte)) {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return
+		}
+		data = data[n:]
+		field, wire := int(key>>3), int(key&7)
+		switch wire {
+		case 0:
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				return
+			}
+			data = data[n:]
+			fn(field, wire, v, nil)
+		case 1:
+			if len(data) < 8 {
+				return
+			}
+			fn(field, wire, binary.LittleEndian.Uint64(data), nil)
+			data = data[8:]
+		case 2:
+			l, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < l {
+				return
+			}
+			fn(field, wire, 0, data[n:n+int(l)])
+			data = data[n+int(l):]
+		case 5:
+			if len(data) < 4 {
+				return
+			}
+			fn(field, wire, uint64(binary.LittleEndian.Uint32(data)), nil)
+			data = data[4:]
+		default:
+			log.Printf("Sparkplug报文包含不支持的wire类型 %d", wire)
+			return
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// 单点处理流水线：工程量换算（量程 / 增益偏移 / 限幅 / 精度），
+// 以及按 (任务, 点名) 做变化检测（死区 / 心跳 / 质量变化）。
+
+// scaleValue 按点配置把原始值换算为工程量，依次执行：量程线性换算 → 增益/偏移 → 限幅 → 保留小数位。
+// 非数值（布尔、字符串）原样返回；precision 为任务级默认小数位，点级 precision 优先。
+func scaleValue(tag *TagMapping, precision *int, value interface{}) interface{} {
+	if tag != nil && tag.Precision != nil {
+		precision = tag.Precision
+	}
+	if (tag == nil || !tag.hasScaling()) && precision == nil {
+		return value
+	}
+	v, ok := numericValue(value)
+	if !ok {
+		return value
+	}
+
+	if tag != nil {
+		if len(tag.Scale) == 4 && tag.Scale[1] != tag.Scale[0] {
+			rawMin, rawMax, engMin, engMax := tag.Scale[0], tag.Scale[1], tag.Scale[2], tag.Scale[3]
+			v = engMin + (v-rawMin)*(engMax-engMin)/(rawMax-rawMin)
+		}
+		if tag.Gain != nil {
+			v *= *tag.Gain
+		}
+		v += tag.Offset
+		if len(tag.Clamp) == 2 {
+			v = math.Max(tag.Clamp[0], math.Min(tag.Clamp[1], v))
+		}
+	}
+	if precision != nil && *precision >= 0 {
+		p := math.Pow(10, float64(*precision))
+		v = math.Round(v*p) / p
+	}
+	return v
+}
+
+// unscaleValue 把写入的工程值按 scale / gain / offset 反算为原始值；配置了 clamp 时超出范围的值拒绝写入
+func unscaleValue(tag *TagMapping, value interface{}) (interface{}, error) {
+	if tag == nil || !tag.hasScaling() {
+		return value, nil
+	}
+	v, ok := numericValue(value)
+	if !ok {
+		return nil, fmt.Errorf("点配置了工程量换算，写入值必须为数值")
+	}
+	if len(tag.Clamp) == 2 && (v < tag.Clamp[0] || v > tag.Clamp[1]) {
+		return nil, fmt.Errorf("写入值 %v 超出范围 [%v, %v]", v, tag.Clamp[0], tag.Clamp[1])
+	}
+	v -= tag.Offset
+	if tag.Gain != nil {
+		if *tag.Gain == 0 {
+			return nil, fmt.Errorf("gain 为 0，无法反算原始值")
+		}
+		v /= *tag.Gain
+	}
+	if len(tag.Scale) == 4 && tag.Scale[1] != tag.Scale[0] {
+		rawMin, rawMax, engMin, engMax := tag.Scale[0], tag.Scale[1], tag.Scale[2], tag.Scale[3]
+		if engMax == engMin {
+			return nil, fmt.Errorf("工程量上下限相同，无法反算原始值")
+		}
+		v = rawMin + (v-engMin)*(rawMax-rawMin)/(engMax-engMin)
+	}
+	return v, nil
+}
+
+// hasScaling 是否配置了数值换算
+func (t *TagMapping) hasScaling() bool {
+	return len(t.Scale) == 4 || t.Gain != nil || t.Offset != 0 || len(t.Clamp) == 2
+}
+
+// deadbandRule 是某个点生效的变化上报参数（任务级配置叠加点级覆盖）
+type deadbandRule struct {
+	absolute  float64
+	percent   float64
+	maxSilent time.Duration
+}
+
+type lastReport struct {
+	value   interface{}
+	quality int
+	at      time.Time
+}
+
+// changeDetector 记录每个点最近一次上报的值，用于按变化上报（report by exception）
+type changeDetector struct {
+	mu   sync.Mutex
+	last map[string]lastReport
+}
+
+func newChangeDetector() *changeDetector {
+	return &changeDetector{last: make(map[string]lastReport)}
+}
+
+// deadbandFor 计算某个点的死区参数：点级配置优先，未配置时使用任务级配置
+func deadbandFor(task *TaskConfig, tag *TagMapping) deadbandRule {
+	rule := deadbandRule{
+		absolute:  task.Deadband,
+		percent:   task.DeadbandPercent,
+		maxSilent: time.Duration(task.MaxSilenceSecond) * time.Second,
+	}
+	if tag == nil {
+		return rule
+	}
+	if tag.Deadband != nil {
+		rule.absolute = *tag.Deadband
+	}
+	if tag.DeadbandPercent != nil {
+		rule.percent = *tag.DeadbandPercent
+	}
+	if tag.MaxSilenceSecond != nil {
+		rule.maxSilent = time.Duration(*tag.MaxSilenceSecond) * time.Second
+	}
+	return rule
+}
+
+// shouldPublish 判断该点本次是否需要上报，需要上报时同时记录为最近一次上报值。
+// 首次出现、质量变化、超过心跳间隔、数值变化超出死区（绝对值与百分比同时配置时需同时超出）、非数值发生变化，均会上报。
+func (d *changeDetector) shouldPublish(key string, value interface{}, quality int, rule deadbandRule, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	prev, seen := d.last[key]
+	publish := !seen ||
+		prev.quality != quality ||
+		(rule.maxSilent > 0 && now.Sub(prev.at) >= rule.maxSilent) ||
+		exceedsDeadband(prev.value, value, rule)
+
+	if publish {
+		d.last[key] = lastReport{value: value, quality: quality, at: now}
+	}
+	return publish
+}
+
+func exceedsDeadband(prev, value interface{}, rule deadbandRule) bool {
+	oldNum, oldOk := numericValue(prev)
+	newNum, newOk := numericValue(value)
+	if !oldOk || !newOk {
+		return !reflect.DeepEqual(prev, value)
+	}
+
+	diff := math.Abs(newNum - oldNum)
+	if diff == 0 {
+		return false
+	}
+	if rule.absolute > 0 && diff <= rule.absolute {
+		return false
+	}
+	if rule.percent > 0 && diff <= math.Abs(oldNum)*rule.percent/100 {
+		return false
+	}
+	return true
+}
+
+// numericValue 提取数值（布尔值不参与死区计算）
+func numericValue(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64, float32, int, int8, int16, int32, int64, uint, uint32, uint64:
+		return toFloat(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// changeStep 是变化检测的一个样本：at 为相对起点的秒数，want 为是否应上报
+type changeStep struct {
+	at      int
+	value   interface{}
+	quality int
+	want    bool
+}
+
+func TestChangeDetectorShouldPublish(t *testing.T) {
+	cases := []struct {
+		name  string
+		rule  deadbandRule
+		steps []changeStep
+	}{
+		{
+			name: "无死区",
+			steps: []changeStep{
+				{at: 0, value: 1.0, quality: 192, want: true},
+				{at: 1, value: 1.0, quality: 192, want: false},
+				{at: 2, value: 1.0001, quality: 192, want: true},
+			},
+		},
+		{
+			name: "绝对死区",
+			rule: deadbandRule{absolute: 1},
+			steps: []changeStep{
+				{at: 0, value: 10.0, quality: 192, want: true},
+				{at: 1, value: 10.5, quality: 192, want: false},
+				// 恰好等于死区不上报
+				{at: 2, value: 11.0, quality: 192, want: false},
+				// 与最近一次上报值（10）比较，而不是上一个样本
+				{at: 3, value: 11.25, quality: 192, want: true},
+				{at: 4, value: 10.5, quality: 192, want: false},
+				{at: 5, value: 10, quality: 192, want: true},
+			},
+		},
+		{
+			name: "百分比死区",
+			rule: deadbandRule{percent: 10},
+			steps: []changeStep{
+				{at: 0, value: 100.0, quality: 192, want: true},
+				{at: 1, value: 110.0, quality: 192, want: false},
+				{at: 2, value: 111.0, quality: 192, want: true},
+				// 百分比按最近一次上报值（111）计算
+				{at: 3, value: 100.0, quality: 192, want: false},
+				{at: 4, value: 99.0, quality: 192, want: true},
+			},
+		},
+		{
+			name: "绝对与百分比同时配置",
+			rule: deadbandRule{absolute: 5, percent: 1},
+			steps: []changeStep{
+				{at: 0, value: 1000.0, quality: 192, want: true},
+				// 超出绝对死区但未超出百分比死区
+				{at: 1, value: 1008.0, quality: 192, want: false},
+				{at: 2, value: 1011.0, quality: 192, want: true},
+				// 超出百分比死区但未超出绝对死区
+				{at: 3, value: 10.0, quality: 192, want: true},
+				{at: 4, value: 14.0, quality: 192, want: false},
+			},
+		},
+		{
+			name: "心跳",
+			rule: deadbandRule{absolute: 5, maxSilent: 10 * time.Second},
+			steps: []changeStep{
+				{at: 0, value: 10.0, quality: 192, want: true},
+				{at: 5, value: 10.0, quality: 192, want: false},
+				{at: 10, value: 10.0, quality: 192, want: true},
+				// 心跳从最近一次上报重新计时
+				{at: 19, value: 11.0, quality: 192, want: false},
+				{at: 20, value: 12.0, quality: 192, want: true},
+			},
+		},
+		{
+			name: "质量变化",
+			rule: deadbandRule{absolute: 5},
+			steps: []changeStep{
+				{at: 0, value: 10.0, quality: 192, want: true},
+				{at: 1, value: 10.0, quality: 0, want: true},
+				{at: 2, value: 11.0, quality: 0, want: false},
+				{at: 3, value: 11.0, quality: 192, want: true},
+			},
+		},
+		{
+			name: "非数值",
+			rule: deadbandRule{absolute: 5, percent: 10},
+			steps: []changeStep{
+				{at: 0, value: "on", quality: 192, want: true},
+				{at: 1, value: "on", quality: 192, want: false},
+				{at: 2, value: "off", quality: 192, want: true},
+				{at: 3, value: true, quality: 192, want: true},
+				{at: 4, value: true, quality: 192, want: false},
+				{at: 5, value: false, quality: 192, want: true},
+				// 类型变化也算变化，不套用死区
+				{at: 6, value: 0.0, quality: 192, want: true},
+				{at: 7, value: 1.0, quality: 192, want: false},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d := newChangeDetector()
+			base := time.Now()
+			for i, step := range c.steps {
+				now := base.Add(time.Duration(step.at) * time.Second)
+				if got := d.shouldPublish("task1\x00A", step.value, step.quality, c.rule, now); got != step.want {
+					t.Fatalf("第 %d 步（%ds, %v, quality=%d）: 上报 = %v, want %v", i+1, step.at, step.value, step.quality, got, step.want)
+				}
+			}
+		})
+	}
+}
+
+func TestChangeDetectorKeys(t *testing.T) {
+	d := newChangeDetector()
+	now := time.Now()
+	rule := deadbandRule{absolute: 1}
+	if !d.shouldPublish("task1\x00A", 10.0, 192, rule, now) || !d.shouldPublish("task1\x00B", 10.0, 192, rule, now) {
+		t.Fatal("不同点应各自首次上报")
+	}
+	if !d.shouldPublish("task2\x00A", 10.0, 192, rule, now) {
+		t.Error("不同任务的同名点应分开记录")
+	}
+	if d.shouldPublish("task1\x00A", 10.5, 192, rule, now) {
+		t.Error("死区内的变化不应上报")
+	}
+}
+
+func TestDeadbandFor(t *testing.T) {
+	task := &TaskConfig{Deadband: 1, DeadbandPercent: 2, MaxSilenceSecond: 30}
+	if rule := deadbandFor(task, nil); rule != (deadbandRule{absolute: 1, percent: 2, maxSilent: 30 * time.Second}) {
+		t.Errorf("任务级 = %+v", rule)
+	}
+	// 点级配置覆盖任务级，显式配置为 0 表示关闭
+	tag := &TagMapping{Deadband: floatPtr(0), MaxSilenceSecond: intPtr(5)}
+	if rule := deadbandFor(task, tag); rule != (deadbandRule{absolute: 0, percent: 2, maxSilent: 5 * time.Second}) {
+		t.Errorf("点级覆盖 = %+v", rule)
+	}
+}
+
+func TestScaleValue(t *testing.T) {
+	cases := []struct {
+		name      string
+		tag       *TagMapping
+		precision *int
+		value     interface{}
+		want      interface{}
+	}{
+		{name: "未配置换算原样返回", tag: &TagMapping{}, value: 5, want: 5},
+		{name: "无点配置", tag: nil, value: int64(7), want: int64(7)},
+		{name: "量程换算", tag: &TagMapping{Scale: []float64{0, 27648, 0, 100}}, value: 13824, want: 50.0},
+		{name: "4-20mA 量程", tag: &TagMapping{Scale: []float64{4, 20, 0, 100}}, value: 12.0, want: 50.0},
+		{name: "反向量程", tag: &TagMapping{Scale: []float64{0, 100, 100, 0}}, value: 25.0, want: 75.0},
+		{name: "原始量程上下限相同时不换算", tag: &TagMapping{Scale: []float64{5, 5, 0, 100}}, value: 7.0, want: 7.0},
+		{name: "增益与偏移", tag: &TagMapping{Gain: floatPtr(2), Offset: 10}, value: 5.0, want: 20.0},
+		{name: "先量程后增益偏移", tag: &TagMapping{Scale: []float64{0, 100, 0, 1}, Gain: floatPtr(100), Offset: -5}, value: 50.0, want: 45.0},
+		{name: "限幅上限", tag: &TagMapping{Gain: floatPtr(2), Clamp: []float64{0, 100}}, value: 60.0, want: 100.0},
+		{name: "限幅下限", tag: &TagMapping{Offset: -50, Clamp: []float64{0, 100}}, value: 20.0, want: 0.0},
+		{name: "限幅范围内", tag: &TagMapping{Clamp: []float64{0, 100}}, value: 42.5, want: 42.5},
+		{name: "任务级小数位", tag: nil, precision: intPtr(2), value: 3.14159, want: 3.14},
+		{name: "小数位 0 四舍五入", tag: &TagMapping{}, precision: intPtr(0), value: 2.5, want: 3.0},
+		{name: "换算后取小数位", tag: &TagMapping{Offset: -273.15}, precision: intPtr(2), value: 300.0, want: 26.85},
+		{name: "点级小数位优先", tag: &TagMapping{Precision: intPtr(1)}, precision: intPtr(3), value: 1.23456, want: 1.2},
+		{name: "点级小数位为负不取整", tag: &TagMapping{Precision: intPtr(-1)}, precision: intPtr(2), value: 1.23456, want: 1.23456},
+		{name: "整数按小数位转为浮点", tag: nil, precision: intPtr(2), value: 5, want: 5.0},
+		{name: "字符串原样返回", tag: &TagMapping{Gain: floatPtr(2)}, precision: intPtr(1), value: "abc", want: "abc"},
+		{name: "布尔原样返回", tag: &TagMapping{Scale: []float64{0, 1, 0, 100}}, value: true, want: true},
+	}
+	for _, c := range cases {
+		if got := scaleValue(c.tag, c.precision, c.value); got != c.want {
+			t.Errorf("%s: scaleValue(%v) = %#v, want %#v", c.name, c.value, got, c.want)
+		}
+	}
+}
+
+func TestScaleValueRoundTrip(t *testing.T) {
+	tags := []*TagMapping{
+		{Scale: []float64{0, 27648, 0, 100}},
+		{Scale: []float64{4, 20, -50, 150}},
+		{Scale: []float64{0, 100, 100, 0}},
+		{Gain: floatPtr(0.1), Offset: -273.15},
+		{Gain: floatPtr(-2)},
+		{Scale: []float64{0, 27648, 0, 100}, Gain: floatPtr(2), Offset: 10, Clamp: []float64{10, 210}},
+	}
+	for _, tag := range tags {
+		for _, raw := range []float64{0, 4, 12.5, 20, 13824, 27648} {
+			eng := scaleValue(tag, nil, raw)
+			if len(tag.Clamp) == 2 && (eng.(float64) <= tag.Clamp[0] || eng.(float64) >= tag.Clamp[1]) {
+				// 落在限幅边界上的值可能经过限幅，无法还原
+				continue
+			}
+			back, err := unscaleValue(tag, eng)
+			if err != nil || math.Abs(back.(float64)-raw) > 1e-9 {
+				t.Errorf("%+v: %v → %v → %v, %v", *tag, raw, eng, back, err)
+			}
+		}
+	}
+}
+
+func TestUnscaleValueRejects(t *testing.T) {
+	cases := []struct {
+		name  string
+		tag   *TagMapping
+		value interface{}
+	}{
+		{name: "低于限幅", tag: &TagMapping{Clamp: []float64{0, 100}}, value: -0.1},
+		{name: "高于限幅", tag: &TagMapping{Clamp: []float64{0, 100}}, value: 100.1},
+		{name: "非数值", tag: &TagMapping{Scale: []float64{0, 1, 0, 100}}, value: "50"},
+		{name: "gain 为 0", tag: &TagMapping{Gain: floatPtr(0)}, value: 1.0},
+		{name: "工程量上下限相同", tag: &TagMapping{Scale: []float64{0, 10, 5, 5}}, value: 5.0},
+	}
+	for _, c := range cases {
+		if v, err := unscaleValue(c.tag, c.value); err == nil {
+			t.Errorf("%s: unscaleValue(%v) = %v, 应返回错误", c.name, c.value, v)
+		}
+	}
+
+	// 限幅边界上的值可以写入
+	if v, err := unscaleValue(&TagMapping{Clamp: []float64{0, 100}}, 100); err != nil || v != 100.0 {
+		t.Errorf("限幅边界: %v, %v", v, err)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// 键名转换规则热加载：按修改时间轮询各任务的规则文件（transform.json / transform_<数据源>.json），
+// 文件变化时读取并校验，通过后把同一份规则原子地替换到使用该文件的全部任务（轮询与 SSE 任务相同）。
+// 文件无效时保留原有规则并发出 transform_error 事件；加载成功发出 transform_reloaded，并恢复之前的错误。
+
+// transformWatchInterval 是规则文件的检查间隔
+var transformWatchInterval = 2 * time.Second
+
+// transformFileFor 返回数据源对应的规则文件
+func transformFileFor(source string) string {
+	if source == "" {
+		return "transform.json"
+	}
+	return "transform_" + source + ".json"
+}
+
+// watchedTransform 是一个规则文件及使用它的转换器
+type watchedTransform struct {
+	path         string
+	exists       bool
+	modTime      time.Time
+	size         int64
+	data         []byte // 最近一次成功加载的内容，加载失败后清空
+	transformers []*KeyTransformer
+}
+
+// transformWatcher 只在自己的协程中检查文件，初次加载在创建时同步完成
+type transformWatcher struct {
+	events *EventBus
+	files  []*watchedTransform
+}
+
+// newTransformWatcher 按规则文件对任务分组并完成初次加载
+func newTransformWatcher(events *EventBus, runners []*TaskRunner) *transformWatcher {
+	w := &transformWatcher{events: events}
+	byPath := make(map[string]*watchedTransform)
+	for _, runner := range runners {
+		path := transformFileFor(runner.task.HttpSource)
+		file, ok := byPath[path]
+		if !ok {
+			file = &watchedTransform{path: path}
+			byPath[path] = file
+			w.files = append(w.files, file)
+		}
+		file.transformers = append(file.transformers, runner.transformer)
+	}
+	for _, file := range w.files {
+		w.check(file, true)
+	}
+	return w
+}
+
+func (w *transformWatcher) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, file := range w.files {
+				w.check(file, false)
+			}
+		}
+	}
+}
+
+// check 文件的存在性、修改时间或大小变化时重新加载
+func (w *transformWatcher) check(file *watchedTransform, initial bool) {
+	info, err := os.Stat(file.path)
+	if err != nil && !os.IsNotExist(err) {
+		w.fail(file, err)
+		return
+	}
+	exists := err == nil
+	if !initial && exists == file.exists && (!exists || info.ModTime().Equal(file.modTime) && info.Size() == file.size) {
+		return
+	}
+	file.exists = exists
+	if exists {
+		file.modTime, file.size = info.ModTime(), info.Size()
+	}
+
+	if !exists {
+		if initial {
+			return
+		}
+		// 规则文件被删除，恢复为不转换
+		file.data = nil
+		w.apply(file, &ruleSet{enabled: true, rules: []TransformRule{}}, "规则文件已删除，恢复为不转换")
+		return
+	}
+
+	data, err := os.ReadFile(file.path)
+	if err != nil {
+		w.fail(file, err)
+		return
+	}
+	if !initial && file.data != nil && bytes.Equal(data, file.data) {
+		return
+	}
+	set, err := parseRuleSet(data)
+	if err != nil {
+		w.fail(file, err)
+		return
+	}
+	file.data = data
+	if initial {
+		for _, kt := range file.transformers {
+			kt.swap(set)
+		}
+		fmt.Printf("✓ 键名转换规则 %s 已加载，%d 条规则\n", file.path, len(set.rules))
+		return
+	}
+	w.apply(file, set, fmt.Sprintf("键名转换规则已重新加载，%d 条规则", len(set.rules)))
+}
+
+func (w *transformWatcher) apply(file *watchedTransform, set *ruleSet, message string) {
+	for _, kt := range file.transformers {
+		kt.swap(set)
+	}
+	log.Printf("🔄 %s: %s（%d 个任务）", file.path, message, len(file.transformers))
+	w.events.Info(EventTransformReloaded, file.path, message)
+	w.events.Recover(EventTransformError, file.path, message)
+}
+
+// fail 保留原有规则；清空已加载内容，文件改回原样时也会重新加载并恢复
+func (w *transformWatcher) fail(file *watchedTransform, err error) {
+	file.data = nil
+	log.Printf("⚠️ 键名转换规则 %s 无效，保留原有规则: %v", file.path, err)
+	w.events.Error(EventTransformError, file.path, fmt.Errorf("键名转换规则无效，保留原有规则: %v", err))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTransform 写入规则文件并把修改时间设为当前时间加 age，避免文件系统时间精度导致变化检测不到
+func writeTransform(t *testing.T, path, content string, age time.Duration) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stamp := time.Now().Add(age)
+	os.Chtimes(path, stamp, stamp)
+}
+
+func TestTransformWatcher(t *testing.T) {
+	t.Chdir(t.TempDir())
+	config := &AppConfig{}
+	line1a := newTaskRunner("task1", testTask("line1"), config)
+	line1b := newTaskRunner("task2", testTask("line1"), config)
+	line2 := newTaskRunner("task3", testTask("line2"), config)
+	writeTransform(t, "transform_line1.json", `{"enabled": true, "rules": [{"rule_type": "AddPrefix", "replacement": "p_", "enabled": true}]}`, -time.Minute)
+
+	events := NewEventBus()
+	var got []Event
+	events.Subscribe(func(e Event) { got = append(got, e) })
+
+	w := newTransformWatcher(events, []*TaskRunner{line1a, line1b, line2})
+	if len(w.files) != 2 {
+		t.Fatalf("规则文件数 = %d", len(w.files))
+	}
+	file := w.files[0]
+	if line1a.transformer.Transform("A") != "p_A" || line1b.transformer.Transform("A") != "p_A" || line2.transformer.Transform("A") != "A" {
+		t.Fatal("初次加载结果不正确")
+	}
+	if len(got) != 0 {
+		t.Errorf("初次加载不应发出事件: %+v", got)
+	}
+
+	// 修改时间未变时不重新读取
+	w.check(file, false)
+	if len(got) != 0 {
+		t.Errorf("文件未变化时不应发出事件: %+v", got)
+	}
+
+	// 同一文件的所有任务同时替换
+	writeTransform(t, "transform_line1.json", `{"enabled": true, "rules": [{"rule_type": "AddSuffix", "replacement": "_s", "enabled": true}]}`, 0)
+	w.check(file, false)
+	if line1a.transformer.Transform("A") != "A_s" || line1b.transformer.Transform("A") != "A_s" {
+		t.Error("重新加载后应使用新规则")
+	}
+	if len(got) != 2 || got[0].Type != EventTransformReloaded || got[0].Severity != SeverityInfo || got[1].Severity != SeverityRecovered {
+		t.Errorf("重新加载事件 = %+v", got)
+	}
+
+	// 文件无效时保留原有规则
+	got = nil
+	valid, _ := os.ReadFile("transform_line1.json")
+	writeTransform(t, "transform_line1.json", `{"enabled": true, "rules": [{"rule_type": "RegexReplace", "pattern": "(", "enabled": true}]}`, time.Minute)
+	w.check(file, false)
+	if line1a.transformer.Transform("A") != "A_s" {
+		t.Error("规则无效时应保留原有规则")
+	}
+	if len(got) != 1 || got[0].Type != EventTransformError || got[0].Subject != "transform_line1.json" || !strings.Contains(got[0].Message, "#1") {
+		t.Errorf("无效规则事件 = %+v", got)
+	}
+
+	// 改回原内容后重新加载并恢复
+	got = nil
+	writeTransform(t, "transform_line1.json", string(valid), 2*time.Minute)
+	w.check(file, false)
+	if len(got) != 2 || got[1].Type != EventTransformError || got[1].Severity != SeverityRecovered {
+		t.Errorf("改回后事件 = %+v", got)
+	}
+
+	// 删除规则文件后恢复为不转换
+	os.Remove("transform_line1.json")
+	w.check(file, false)
+	if line1a.transformer.Transform("A") != "A" {
+		t.Error("删除规则文件后应不再转换")
+	}
+}
+
+func TestCollectorTransformHotReloadSse(t *testing.T) {
+	saved := transformWatchInterval
+	transformWatchInterval = 20 * time.Millisecond
+	t.Cleanup(func() { transformWatchInterval = saved })
+
+	agent := newFakeAgent(t)
+	rtdb := newFakeRtdb(t)
+	collector := startTestCollector(t, &AppConfig{
+		HttpConfigs: []*HttpConfig{{Name: "line1", Enabled: true, Url: agent.url("/api/stream")}},
+		RtdbConfig:  &RtdbConfig{Enabled: true, Host: "127.0.0.1", Port: rtdb.port()},
+		Tasks:       []*TaskConfig{testTask("line1")},
+	})
+	reloaded := make(chan Event, 4)
+	collector.events.Subscribe(func(e Event) {
+		if e.Type == EventTransformReloaded {
+			select {
+			case reloaded <- e:
+			default:
+			}
+		}
+	})
+
+	waitFor(t, 5*time.Second, "SSE连接", func() bool { return agent.activeStreams() == 1 })
+	agent.push(point("A", 1))
+	rtdb.waitLine(t, "转换前", linePrefix("A,1,192,"))
+
+	// SSE 任务不经过轮询周期，同样应在规则文件变化后生效
+	writeTransform(t, "transform_line1.json", `{"enabled": true, "rules": [{"rule_type": "AddPrefix", "replacement": "p_", "enabled": true}]}`, 0)
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("规则文件变化后应发出 transform_reloaded 事件")
+	}
+	agent.push(point("A", 2))
+	rtdb.waitLine(t, "转换后", linePrefix("p_A,2,192,"))
+}
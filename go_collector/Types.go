@@ -7,6 +7,8 @@ type AppConfig struct {
 	MqttConfig    *MqttConfig      `json:"mqtt,omitempty"`
 	RtdbConfig    *RtdbConfig      `json:"rtdb,omitempty"`
 	WebhookConfig *WebhookConfig   `json:"webhook,omitempty"`
+	MonitorConfig *MonitorConfig   `json:"monitor,omitempty"`
+	BufferConfig  *BufferConfig    `json:"buffer,omitempty"`
 	Tasks         []*TaskConfig    `json:"tasks,omitempty"`
 }
 
@@ -16,8 +18,17 @@ type HttpConfig struct {
 	Url     string `json:"url" ini:"url"`
 	Method  string `json:"method" ini:"method"`
 	Timeout int    `json:"timeout" ini:"timeout"`
+	// 数据源类型：http（默认，轮询 /api/data 或订阅 /api/stream）/ simulate（内置模拟数据，无需 OPC 代理）
+	Type string `json:"type,omitempty" ini:"type"`
+	// type=simulate 时的模拟点定义文件（JSON），留空使用内置示例点
+	SimFile string `json:"sim_file,omitempty" ini:"sim_file"`
 }
 
+const (
+	HttpTypeHttp     = "http"
+	HttpTypeSimulate = "simulate"
+)
+
 type MqttConfig struct {
 	Enabled    bool   `json:"enabled" ini:"enabled"`
 	Broker     string `json:"broker" ini:"broker"`
@@ -31,6 +42,23 @@ type MqttConfig struct {
 	Format      string `json:"format" ini:"format"`
 	JsTransform  string `json:"js_transform" ini:"js_transform"`
 	Split       bool   `json:"split" ini:"split"`
+	// 连接协议：tcp（默认）/ ssl / ws / wss；broker 也可直接写完整 URL，如 wss://host:443/mqtt
+	Protocol              string `json:"protocol,omitempty" ini:"protocol"`
+	WsPath                string `json:"ws_path,omitempty" ini:"ws_path"`
+	TlsCaFile             string `json:"tls_ca_file,omitempty" ini:"tls_ca_file"`
+	TlsCertFile           string `json:"tls_cert_file,omitempty" ini:"tls_cert_file"`
+	TlsKeyFile            string `json:"tls_key_file,omitempty" ini:"tls_key_file"`
+	TlsInsecureSkipVerify bool   `json:"tls_insecure_skip_verify,omitempty" ini:"tls_insecure_skip_verify"`
+	TlsServerName         string `json:"tls_server_name,omitempty" ini:"tls_server_name"`
+	// format=sparkplug_b 时使用：spBv1.0/{group_id}/NBIRTH/{edge_node_id}
+	SparkplugGroupId    string `json:"sparkplug_group_id,omitempty" ini:"sparkplug_group_id"`
+	SparkplugEdgeNodeId string `json:"sparkplug_edge_node_id,omitempty" ini:"sparkplug_edge_node_id"`
+	// 报警事件（触发 / 解除 / 确认）的发布主题，支持 {source}、{key} 占位符，留空不发布
+	AlarmTopic string `json:"alarm_topic,omitempty" ini:"alarm_topic"`
+	// 写入命令主题，支持 {source}、{key}（各占一级主题），如 cmd/{key}；留空不接收写入命令
+	CommandTopic string `json:"command_topic,omitempty" ini:"command_topic"`
+	// 写入结果回执主题，支持 {source}、{key}，留空为 command_topic 加 /ack
+	CommandAckTopic string `json:"command_ack_topic,omitempty" ini:"command_ack_topic"`
 }
 
 type RtdbConfig struct {
@@ -44,6 +72,47 @@ type WebhookConfig struct {
 	Enabled bool     `json:"enabled" ini:"enabled"`
 	Url     string   `json:"url" ini:"url"`
 	Events  []string `json:"events" ini:"events"`
+	// 同一故障持续存在时重复提醒的间隔（分钟），0 使用默认 10 分钟
+	RepeatMinutes int `json:"repeat_minutes,omitempty" ini:"repeat_minutes"`
+	// 投递失败后的重试次数，未配置时默认 3 次，0 表示不重试
+	Retries *int `json:"retries,omitempty" ini:"retries"`
+}
+
+// MonitorConfig 对应 [monitor] 节，mode=email 时通过 SMTP 发送告警邮件（与 Webhook 可同时启用）
+type MonitorConfig struct {
+	Monitor bool   `json:"monitor" ini:"monitor"`
+	Mode    string `json:"mode" ini:"mode"`
+	// 收件人，多个以逗号分隔
+	Email    string `json:"email" ini:"email"`
+	SmtpHost string `json:"smtp_host,omitempty" ini:"smtp_host"`
+	SmtpPort int    `json:"smtp_port,omitempty" ini:"smtp_port"`
+	// 加密方式：none / starttls / ssl；留空时 465 端口使用 ssl，其余端口在服务器支持时使用 STARTTLS
+	SmtpSecurity string `json:"smtp_security,omitempty" ini:"smtp_security"`
+	SmtpUsername string `json:"smtp_username,omitempty" ini:"smtp_username"`
+	SmtpPassword string `json:"smtp_password,omitempty" ini:"smtp_password"`
+	// 发件人，留空使用 smtp_username
+	SmtpFrom string `json:"smtp_from,omitempty" ini:"smtp_from"`
+	// 邮件标题模板，支持 {title}、{event}、{subject}、{severity}、{message}、{time}
+	Subject string `json:"subject,omitempty" ini:"subject"`
+	// 订阅的事件，规则同 Webhook，留空为全部
+	Events []string `json:"events,omitempty" ini:"events"`
+}
+
+const MonitorModeEmail = "email"
+
+const (
+	SmtpSecurityNone     = "none"
+	SmtpSecurityStartTls = "starttls"
+	SmtpSecuritySsl      = "ssl"
+)
+
+// BufferConfig 磁盘缓冲配置：MQTT / RTDB 不可用时暂存数据，恢复后按时间顺序补发
+type BufferConfig struct {
+	Enabled     bool   `json:"enabled" ini:"enabled"`
+	Dir         string `json:"dir" ini:"dir"`
+	MaxSizeMB   int    `json:"max_size_mb" ini:"max_size_mb"`
+	MaxAgeHours int    `json:"max_age_hours" ini:"max_age_hours"`
+	Overflow    string `json:"overflow" ini:"overflow"` // drop_oldest / drop_newest
 }
 
 type TaskConfig struct {
@@ -51,9 +120,66 @@ type TaskConfig struct {
 	HttpSource        string        `json:"http_source" ini:"http_source"`
 	JobIntervalSecond int           `json:"job_interval_second" ini:"job_interval_second"`
 	Tags              []*TagMapping `json:"tags,omitempty"`
+	// 白名单模式：只发布 Tags 中配置的点，数据源未返回的点以坏质量（quality=0）上报
+	Strict bool `json:"strict,omitempty" ini:"strict"`
+	// 按变化上报：值超出死区、质量变化或超过 max_silence_second 未上报时才发送
+	ReportByException bool    `json:"report_by_exception,omitempty" ini:"report_by_exception"`
+	Deadband          float64 `json:"deadband,omitempty" ini:"deadband"`
+	DeadbandPercent   float64 `json:"deadband_percent,omitempty" ini:"deadband_percent"`
+	MaxSilenceSecond  int     `json:"max_silence_second,omitempty" ini:"max_silence_second"`
+	// 任务内所有数值点的默认小数位，点级 precision 优先
+	TagPrecision *int `json:"tag_precision,omitempty" ini:"tag_precision"`
+	// 点时间戳来源：source（默认，使用数据源提供的 OPC 时间戳，缺失时回退采集时间）/ collector（采集时间）
+	TimestampSource string `json:"timestamp_source,omitempty" ini:"timestamp_source"`
+	// 发布键冲突（多个原始点转换为同一个键）的处理：keep_last（默认）/ keep_first / suffix / reject
+	CollisionPolicy string `json:"collision_policy,omitempty" ini:"collision_policy"`
 }
 
+const (
+	TimestampSourceSource    = "source"
+	TimestampSourceCollector = "collector"
+)
+
+const (
+	CollisionKeepLast  = "keep_last"
+	CollisionKeepFirst = "keep_first"
+	CollisionSuffix    = "suffix"
+	CollisionReject    = "reject"
+)
+
 type TagMapping struct {
 	OpcTag string `json:"opc_tag" ini:"tag_opc"`
 	DbName string `json:"db_name" ini:"tag_dbn"`
+	// 点级死区覆盖，未配置时沿用任务级设置
+	Deadband         *float64 `json:"deadband,omitempty" ini:"tag_deadband"`
+	DeadbandPercent  *float64 `json:"deadband_percent,omitempty" ini:"tag_deadband_pct"`
+	MaxSilenceSecond *int     `json:"max_silence_second,omitempty" ini:"tag_max_silence"`
+	// 工程量换算：scale=[原始下限, 原始上限, 工程下限, 工程上限]，之后依次做 gain/offset、clamp=[下限, 上限]、precision 位小数
+	Scale     []float64 `json:"scale,omitempty" ini:"tag_scale"`
+	Gain      *float64  `json:"gain,omitempty" ini:"tag_gain"`
+	Offset    float64   `json:"offset,omitempty" ini:"tag_offset"`
+	Clamp     []float64 `json:"clamp,omitempty" ini:"tag_clamp"`
+	Precision *int      `json:"precision,omitempty" ini:"tag_precision"`
+	Unit      string    `json:"unit,omitempty" ini:"tag_unit"`
+	// 点级报警规则，按换算后的工程值判断
+	Alarm *TagAlarm `json:"alarm,omitempty"`
+	// 允许通过 MQTT 写入命令回写到 OPC（白名单，默认禁止）
+	Writable bool `json:"writable,omitempty" ini:"tag_writable"`
+}
+
+// TagAlarm 点级报警规则。限值报警越限后需回到 限值∓deadband 才解除（回差），
+// 除僵值外的条件需持续 on_delay_second 秒才触发。
+type TagAlarm struct {
+	HiHi *float64 `json:"hihi,omitempty" ini:"tag_alarm_hihi"`
+	Hi   *float64 `json:"hi,omitempty" ini:"tag_alarm_hi"`
+	Lo   *float64 `json:"lo,omitempty" ini:"tag_alarm_lo"`
+	LoLo *float64 `json:"lolo,omitempty" ini:"tag_alarm_lolo"`
+	// 变化率上限（工程单位/秒）
+	RateOfChange *float64 `json:"rate_of_change,omitempty" ini:"tag_alarm_roc"`
+	// 质量码非 Good 时报警
+	BadQuality bool `json:"bad_quality,omitempty" ini:"tag_alarm_bad_quality"`
+	// 超过该秒数值和时间戳都没有变化视为僵值
+	StaleSecond   int     `json:"stale_second,omitempty" ini:"tag_alarm_stale"`
+	Deadband      float64 `json:"deadband,omitempty" ini:"tag_alarm_deadband"`
+	OnDelaySecond int     `json:"on_delay_second,omitempty" ini:"tag_alarm_on_delay"`
 }
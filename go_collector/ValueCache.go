@@ -0,0 +1,143 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LastValue 是某个点最近一次发布的值
+type LastValue struct {
+	Key         string      `json:"key"`
+	OrigKey     string      `json:"orig_key"`
+	Task        string      `json:"task"`
+	Source      string      `json:"source"`
+	Value       interface{} `json:"value"`
+	Quality     int         `json:"quality"`
+	Timestamp   int64       `json:"timestamp"`
+	Unit        string      `json:"unit,omitempty"`
+	PublishTime string      `json:"publish_time"`
+}
+
+// ValueFilter 是最新值查询条件，空字段表示不过滤
+type ValueFilter struct {
+	Task   string
+	Source string
+	Prefix string
+	Search string
+	Offset int
+	Limit  int
+}
+
+// ValuePage 是分页查询结果
+type ValuePage struct {
+	Total  int          `json:"total"`
+	Offset int          `json:"offset"`
+	Limit  int          `json:"limit"`
+	Items  []*LastValue `json:"items"`
+}
+
+// ValueCache 保存每个任务每个点最近一次发布的值，采集器热加载后仍保留
+type ValueCache struct {
+	mu      sync.RWMutex
+	entries map[string]*LastValue
+}
+
+func NewValueCache() *ValueCache {
+	return &ValueCache{entries: make(map[string]*LastValue)}
+}
+
+// Update 记录一批已发布的数据；origKeys 为发布键到原始点名的映射
+func (vc *ValueCache) Update(task, source string, message map[string]interface{}, origKeys map[string]string) {
+	values, _ := message["values"].(map[string]interface{})
+	metadata := messageMetadata(message)
+	publishTime := time.Now().Format(time.RFC3339)
+
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	for key, value := range values {
+		entry := &LastValue{
+			Key:         key,
+			OrigKey:     origKeys[key],
+			Task:        task,
+			Source:      source,
+			Value:       value,
+			PublishTime: publishTime,
+		}
+		if meta := metadata[key]; meta != nil {
+			entry.Quality, _ = meta["quality"].(int)
+			entry.Timestamp, _ = meta["timestamp"].(int64)
+			entry.Unit, _ = meta["unit"].(string)
+		}
+		vc.entries[task+"\x00"+key] = entry
+	}
+}
+
+// Find 返回发布键为 key 的全部最新值（不同任务可能发布同名键），按任务名排序
+func (vc *ValueCache) Find(key string) []*LastValue {
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+	var result []*LastValue
+	for _, entry := range vc.entries {
+		if entry.Key == key {
+			copied := *entry
+			result = append(result, &copied)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Task < result[j].Task })
+	return result
+}
+
+// Query 按任务 / 数据源 / 键前缀 / 关键字过滤，结果按键名排序后分页
+func (vc *ValueCache) Query(filter ValueFilter) ValuePage {
+	search := strings.ToLower(filter.Search)
+
+	vc.mu.RLock()
+	matched := make([]*LastValue, 0)
+	for _, entry := range vc.entries {
+		if filter.Task != "" && entry.Task != filter.Task {
+			continue
+		}
+		if filter.Source != "" && entry.Source != filter.Source {
+			continue
+		}
+		if filter.Prefix != "" && !strings.HasPrefix(entry.Key, filter.Prefix) && !strings.HasPrefix(entry.OrigKey, filter.Prefix) {
+			continue
+		}
+		if search != "" && !strings.Contains(strings.ToLower(entry.Key), search) && !strings.Contains(strings.ToLower(entry.OrigKey), search) {
+			continue
+		}
+		copied := *entry
+		matched = append(matched, &copied)
+	}
+	vc.mu.RUnlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].Key != matched[j].Key {
+			return matched[i].Key < matched[j].Key
+		}
+		return matched[i].Task < matched[j].Task
+	})
+
+	page := ValuePage{Total: len(matched), Offset: filter.Offset, Limit: filter.Limit}
+	if page.Offset < 0 {
+		page.Offset = 0
+	}
+	if page.Limit <= 0 {
+		page.Limit = 100
+	}
+	if page.Limit > 1000 {
+		page.Limit = 1000
+	}
+	if page.Offset >= len(matched) {
+		page.Items = []*LastValue{}
+		return page
+	}
+	end := page.Offset + page.Limit
+	if end > len(matched) {
+		end = len(matched)
+	}
+	page.Items = matched[page.Offset:end]
+	return page
+}
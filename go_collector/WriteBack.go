@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// 写入回路：订阅 MQTT 写入命令主题（如 cmd/{key}），把发布键反查为 OPC 点
+// （先找点映射的 db_name，其次最新值缓存中记录的原始点名；可写的点都有映射，不按键名转换规则反查），校验可写白名单并把工程值反算为原始值，
+// 经该点所属数据源的 OPC 代理 POST /api/write 写入，最后向回执主题发布带关联 ID 的结果。
+
+// WriteResult 是写入回执
+type WriteResult struct {
+	Id        string      `json:"id,omitempty"`
+	Key       string      `json:"key"`
+	Source    string      `json:"source,omitempty"`
+	OpcTag    string      `json:"opc_tag,omitempty"`
+	Value     interface{} `json:"value"`
+	RawValue  interface{} `json:"raw_value,omitempty"`
+	Success   bool        `json:"success"`
+	Message   string      `json:"message"`
+	Timestamp string      `json:"timestamp"`
+}
+
+// writeTarget 是写入命令解析出的目标点
+type writeTarget struct {
+	source string
+	opcTag string
+	tag    *TagMapping
+}
+
+// commandFilter 把命令主题模板转换为订阅过滤器，占位符替换为单级通配符 +
+func commandFilter(template string) string {
+	return strings.NewReplacer("{key}", "+", "{source}", "+").Replace(template)
+}
+
+// commandAckTemplate 返回回执主题模板，未配置时为命令主题加 /ack
+func commandAckTemplate(config *MqttConfig) string {
+	if config.CommandAckTopic != "" {
+		return config.CommandAckTopic
+	}
+	return config.CommandTopic + "/ack"
+}
+
+// validateCommandTopic 校验命令主题：{key} 必须独占一级，不能含通配符，回执主题不能落入命令订阅范围
+func validateCommandTopic(config *MqttConfig) error {
+	template := config.CommandTopic
+	if strings.ContainsAny(template, "+#") {
+		return fmt.Errorf("command_topic 不能包含通配符 + 或 #")
+	}
+	hasKey := false
+	for _, level := range strings.Split(template, "/") {
+		if level == "{key}" {
+			hasKey = true
+		} else if strings.Contains(level, "{key}") || (strings.Contains(level, "{source}") && level != "{source}") {
+			return fmt.Errorf("command_topic 中的 {key}、{source} 必须独占一级主题")
+		}
+	}
+	if !hasKey {
+		return fmt.Errorf("command_topic 必须包含 {key}")
+	}
+	if mqttTopicMatch(commandFilter(template), renderTopic(commandAckTemplate(config), "source", "key")) {
+		return fmt.Errorf("回执主题 %s 与命令主题重叠，会收到自己的回执", commandAckTemplate(config))
+	}
+	return nil
+}
+
+// parseCommandTopic 按模板从实际主题中取出 source 与 key
+func parseCommandTopic(template, topic string) (source, key string, ok bool) {
+	levels, parts := strings.Split(template, "/"), strings.Split(topic, "/")
+	if len(levels) != len(parts) {
+		return "", "", false
+	}
+	for i, level := range levels {
+		switch level {
+		case "{key}":
+			key = parts[i]
+		case "{source}":
+			source = parts[i]
+		default:
+			if level != parts[i] {
+				return "", "", false
+			}
+		}
+	}
+	return source, key, key != ""
+}
+
+// mqttTopicMatch 判断主题是否匹配订阅过滤器（支持 + 与 #）
+func mqttTopicMatch(filter, topic string) bool {
+	fp, tp := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, f := range fp {
+		if f == "#" {
+			return true
+		}
+		if i >= len(tp) || (f != "+" && f != tp[i]) {
+			return false
+		}
+	}
+	return len(fp) == len(tp)
+}
+
+// parseWriteCommand 解析命令报文：{"value": 12.5, "id": "abc"}（id 也可写作 correlation_id），
+// 或直接是 JSON 标量 / 纯文本值（无关联 ID）
+func parseWriteCommand(payload []byte) (value interface{}, id string, err error) {
+	var body interface{}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		text := strings.TrimSpace(string(payload))
+		if text == "" {
+			return nil, "", fmt.Errorf("命令报文为空")
+		}
+		return text, "", nil
+	}
+
+	if object, ok := body.(map[string]interface{}); ok {
+		for _, name := range []string{"id", "correlation_id"} {
+			if v, ok := object[name]; ok && v != nil {
+				id = fmt.Sprintf("%v", v)
+				break
+			}
+		}
+		v, ok := object["value"]
+		if !ok {
+			return nil, id, fmt.Errorf("命令报文缺少 value")
+		}
+		body = v
+	}
+	switch body.(type) {
+	case float64, bool, string:
+		return body, id, nil
+	}
+	return nil, id, fmt.Errorf("value 必须为数值、布尔或字符串")
+}
+
+// resolveWriteTarget 把发布键反查为 OPC 点：先找 db_name 相同的点映射，再查最新值缓存中的原始点名；
+// 只有点映射标记了 writable 才允许写入。可写的点都有映射，因此不需要按转换规则反查
+func (c *Collector) resolveWriteTarget(config *AppConfig, source, key string) (*writeTarget, error) {
+	var candidates []*writeTarget
+	for _, task := range config.Tasks {
+		if !task.Enabled || (source != "" && task.HttpSource != source) {
+			continue
+		}
+		for _, tag := range task.Tags {
+			if tag.DbName == key {
+				candidates = append(candidates, &writeTarget{source: task.HttpSource, opcTag: tag.OpcTag, tag: tag})
+			}
+		}
+	}
+
+	if len(candidates) == 0 {
+		for _, entry := range c.values.Find(key) {
+			if source != "" && entry.Source != source {
+				continue
+			}
+			target := &writeTarget{source: entry.Source, opcTag: entry.OrigKey}
+			if task := taskByName(config, entry.Task); task != nil {
+				for _, tag := range task.Tags {
+					if tag.OpcTag == entry.OrigKey {
+						target.tag = tag
+						break
+					}
+				}
+			}
+			candidates = append(candidates, target)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("未找到点 %s", key)
+	}
+	for _, other := range candidates[1:] {
+		if other.source != candidates[0].source || other.opcTag != candidates[0].opcTag {
+			return nil, fmt.Errorf("点 %s 对应多个OPC点，请在命令主题中使用 {source} 指定数据源", key)
+		}
+	}
+	target := candidates[0]
+	if target.tag == nil || !target.tag.Writable {
+		return nil, fmt.Errorf("点 %s 不在可写白名单中", key)
+	}
+	return target, nil
+}
+
+// hasWritableTag 是否有启用任务中的点标记为可写
+func hasWritableTag(config *AppConfig) bool {
+	for _, task := range config.Tasks {
+		if !task.Enabled {
+			continue
+		}
+		for _, tag := range task.Tags {
+			if tag.Writable {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// taskByName 按运行时任务名（task1、task2…）查找任务配置
+func taskByName(config *AppConfig, name string) *TaskConfig {
+	for i, task := range config.Tasks {
+		if fmt.Sprintf("task%d", i+1) == name {
+			return task
+		}
+	}
+	return nil
+}
+
+// agentWriteURL 由数据源地址（/api/data 或 /api/stream）得到同一代理的 /api/write 地址
+func agentWriteURL(dataURL string) (string, error) {
+	u, err := url.Parse(dataURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("数据源地址无效: %s", dataURL)
+	}
+	u.Path, u.RawQuery = "/api/write", ""
+	return u.String(), nil
+}
+
+// writeToAgent 把原始值写到数据源所在的 OPC 代理
+func (c *Collector) writeToAgent(sourceName, opcTag string, value interface{}) error {
+	var client *HttpClient
+	for _, candidate := range c.httpClients {
+		if candidate.config.Name == sourceName || (sourceName == "" && len(c.httpClients) == 1) {
+			client = candidate
+			break
+		}
+	}
+	if client == nil {
+		return fmt.Errorf("数据源 %s 未启用", sourceName)
+	}
+	if client.simulator != nil {
+		return fmt.Errorf("模拟数据源不支持写入")
+	}
+
+	writeURL, err := agentWriteURL(client.config.Url)
+	if err != nil {
+		return err
+	}
+	body, _ := json.Marshal(map[string]interface{}{"node_id": opcTag, "value": value})
+	timeout := time.Duration(client.config.Timeout) * time.Millisecond
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	resp, err := (&http.Client{Timeout: timeout}).Post(writeURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("请求OPC代理失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("OPC代理不支持写入接口 /api/write，请升级代理")
+	}
+
+	data, _ := io.ReadAll(resp.Body)
+	var apiResp struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(data, &apiResp); err != nil {
+		return fmt.Errorf("OPC代理返回状态码 %d", resp.StatusCode)
+	}
+	if !apiResp.Success {
+		return fmt.Errorf("OPC代理写入失败: %s", apiResp.Message)
+	}
+	return nil
+}
+
+// startCommands 订阅写入命令主题；命令按到达顺序逐条执行，避免对同一点的写入乱序
+func (c *Collector) startCommands(ctx context.Context) {
+	config := c.config.MqttConfig
+	if c.mqttClient == nil || config.CommandTopic == "" {
+		return
+	}
+	if err := validateCommandTopic(config); err != nil {
+		log.Printf("⚠️ 写入命令未启用: %v", err)
+		return
+	}
+
+	queue := make(chan mqtt.Message, 64)
+	c.spawn(func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg := <-queue:
+				c.handleWriteCommand(msg.Topic(), msg.Payload())
+			}
+		}
+	})
+
+	filter := commandFilter(config.CommandTopic)
+	err := c.mqttClient.Subscribe(filter, 1, func(_ mqtt.Client, msg mqtt.Message) {
+		// 保留消息会在每次重连时重新下发，不能当作新的写入命令
+		if msg.Retained() {
+			log.Printf("⚠️ 忽略保留的写入命令 topic=%s", msg.Topic())
+			return
+		}
+		select {
+		case queue <- msg:
+		default:
+			log.Printf("⚠️ 写入命令队列已满，丢弃 topic=%s", msg.Topic())
+		}
+	})
+	if err != nil {
+		log.Printf("⚠️ %v", err)
+		return
+	}
+	fmt.Printf("✓ 已订阅写入命令主题 %s\n", filter)
+}
+
+// handleWriteCommand 执行一条写入命令并发布回执
+func (c *Collector) handleWriteCommand(topic string, payload []byte) {
+	config := c.config
+	source, key, ok := parseCommandTopic(config.MqttConfig.CommandTopic, topic)
+	if !ok {
+		return
+	}
+
+	result := WriteResult{Key: key, Source: source}
+	value, id, err := parseWriteCommand(payload)
+	result.Id, result.Value = id, value
+
+	var target *writeTarget
+	outcome := "rejected"
+	if err == nil {
+		target, err = c.resolveWriteTarget(config, source, key)
+	}
+	if err == nil {
+		result.Source, result.OpcTag = target.source, target.opcTag
+		result.RawValue, err = unscaleValue(target.tag, value)
+	}
+	if err == nil {
+		outcome = "failed"
+		err = c.writeToAgent(target.source, target.opcTag, result.RawValue)
+	}
+
+	if err != nil {
+		result.Message = err.Error()
+		log.Printf("⚠️ 写入命令失败 %s = %v: %v", key, value, err)
+	} else {
+		outcome = "ok"
+		result.Success, result.Message = true, "写入成功"
+		log.Printf("✍️ 已写入 %s (%s) = %v", key, target.opcTag, result.RawValue)
+	}
+	metricWrites.Inc(outcome)
+	result.Timestamp = time.Now().Format(time.RFC3339)
+
+	mqttClient := c.mqttClient
+	if mqttClient == nil {
+		return
+	}
+	data, _ := json.Marshal(result)
+	ackTopic := renderTopic(commandAckTemplate(config.MqttConfig), result.Source, key)
+	if err := mqttClient.PublishRaw(ackTopic, data); err != nil {
+		log.Printf("⚠️ 写入回执发布失败 topic=%s: %v", ackTopic, err)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandTopic(t *testing.T) {
+	valid := []*MqttConfig{
+		{CommandTopic: "cmd/{key}"},
+		{CommandTopic: "cmd/{source}/{key}", CommandAckTopic: "ack/{source}/{key}"},
+	}
+	for _, config := range valid {
+		if err := validateCommandTopic(config); err != nil {
+			t.Errorf("%s: %v", config.CommandTopic, err)
+		}
+	}
+
+	invalid := []*MqttConfig{
+		{CommandTopic: "cmd/all"},
+		{CommandTopic: "cmd/+/{key}"},
+		{CommandTopic: "cmd/tag-{key}"},
+		{CommandTopic: "cmd/{source}-x/{key}"},
+		// 回执主题会被命令订阅收到
+		{CommandTopic: "cmd/{source}/{key}", CommandAckTopic: "cmd/ack/{key}"},
+	}
+	for _, config := range invalid {
+		if err := validateCommandTopic(config); err == nil {
+			t.Errorf("%s (ack=%s): 应返回错误", config.CommandTopic, config.CommandAckTopic)
+		}
+	}
+
+	if got := commandFilter("cmd/{source}/{key}"); got != "cmd/+/+" {
+		t.Errorf("commandFilter = %s", got)
+	}
+	cases := []struct {
+		topic, source, key string
+		ok                 bool
+	}{
+		{"cmd/line1/t1", "line1", "t1", true},
+		{"cmd/line1/t1/ack", "", "", false},
+		{"other/line1/t1", "", "", false},
+		{"cmd/line1/", "", "", false},
+	}
+	for _, tc := range cases {
+		source, key, ok := parseCommandTopic("cmd/{source}/{key}", tc.topic)
+		if ok != tc.ok || (ok && (source != tc.source || key != tc.key)) {
+			t.Errorf("parseCommandTopic(%s) = %s, %s, %v", tc.topic, source, key, ok)
+		}
+	}
+}
+
+func TestParseWriteCommand(t *testing.T) {
+	cases := []struct {
+		payload string
+		value   interface{}
+		id      string
+		fail    bool
+	}{
+		{`{"value": 12.5, "id": "abc"}`, 12.5, "abc", false},
+		{`{"value": true, "correlation_id": 7}`, true, "7", false},
+		{`{"value": "AUTO"}`, "AUTO", "", false},
+		{`42`, 42.0, "", false},
+		{`start`, "start", "", false},
+		{`{"id": "x"}`, nil, "x", true},
+		{`{"value": {"a": 1}}`, nil, "", true},
+		{`[1, 2]`, nil, "", true},
+		{`  `, nil, "", true},
+	}
+	for _, tc := range cases {
+		value, id, err := parseWriteCommand([]byte(tc.payload))
+		if (err != nil) != tc.fail || value != tc.value || id != tc.id {
+			t.Errorf("parseWriteCommand(%s) = %v, %q, %v", tc.payload, value, id, err)
+		}
+	}
+}
+
+func TestUnscaleValue(t *testing.T) {
+	tag := &TagMapping{Scale: []float64{0, 27648, 0, 100}, Gain: floatPtr(2), Offset: 10, Clamp: []float64{10, 210}}
+	for _, raw := range []float64{0, 13824, 27648} {
+		eng := scaleValue(tag, nil, raw)
+		back, err := unscaleValue(tag, eng)
+		if err != nil || math.Abs(back.(float64)-raw) > 1e-9 {
+			t.Errorf("raw %v → %v → %v, %v", raw, eng, back, err)
+		}
+	}
+
+	if _, err := unscaleValue(tag, 300.0); err == nil {
+		t.Error("超出 clamp 范围应拒绝")
+	}
+	if _, err := unscaleValue(tag, "high"); err == nil {
+		t.Error("配置换算时非数值应拒绝")
+	}
+	if _, err := unscaleValue(&TagMapping{Gain: floatPtr(0)}, 1.0); err == nil {
+		t.Error("gain 为 0 应返回错误")
+	}
+	if v, err := unscaleValue(&TagMapping{}, true); err != nil || v != true {
+		t.Errorf("无换算时应原样写入: %v, %v", v, err)
+	}
+}
+
+func TestResolveWriteTarget(t *testing.T) {
+	task := testTask("line1", &TagMapping{OpcTag: "Channel2.SP", DbName: "sp", Writable: true})
+	other := testTask("line2", &TagMapping{OpcTag: "Channel3.SP", DbName: "sp", Writable: true})
+	config := &AppConfig{Tasks: []*TaskConfig{task, other}}
+	collector := NewCollector(config)
+
+	if target, err := collector.resolveWriteTarget(config, "line1", "sp"); err != nil || target.opcTag != "Channel2.SP" {
+		t.Errorf("sp = %+v, %v", target, err)
+	}
+	if _, err := collector.resolveWriteTarget(config, "", "sp"); err == nil || !strings.Contains(err.Error(), "多个") {
+		t.Errorf("多个数据源时应拒绝: %v", err)
+	}
+
+	// 未映射的点只能从最新值缓存反查，且不在可写白名单中
+	if _, err := collector.resolveWriteTarget(config, "", "PV"); err == nil || !strings.Contains(err.Error(), "未找到") {
+		t.Errorf("未采集到的点应返回未找到: %v", err)
+	}
+	collector.values.Update("task1", "line1", map[string]interface{}{"values": map[string]interface{}{"PV": 1.0}}, map[string]string{"PV": "Channel2.PV"})
+	if _, err := collector.resolveWriteTarget(config, "", "PV"); err == nil || !strings.Contains(err.Error(), "白名单") {
+		t.Errorf("未映射的点应拒绝: %v", err)
+	}
+}
+
+func TestCollectorWriteBack(t *testing.T) {
+	agent := newFakeAgent(t)
+	broker := newFakeBroker(t)
+	rtdb := newFakeRtdb(t)
+	agent.setPoints(point("Channel1.T1", 50), point("Channel1.T2", 1), point("Channel1.T3", 3))
+
+	startTestCollector(t, &AppConfig{
+		HttpConfigs: []*HttpConfig{{Name: "line1", Enabled: true, Url: agent.url("/api/data"), Timeout: 2000}},
+		MqttConfig: &MqttConfig{
+			Enabled: true, Broker: "127.0.0.1", Port: broker.port(), Topic: "plant/{source}", ClientId: "test-write",
+			CommandTopic: "cmd/{key}",
+		},
+		RtdbConfig: &RtdbConfig{Enabled: true, Host: "127.0.0.1", Port: rtdb.port()},
+		Tasks: []*TaskConfig{testTask("line1",
+			&TagMapping{OpcTag: "Channel1.T1", DbName: "sp", Scale: []float64{0, 1000, 0, 100}, Writable: true},
+			&TagMapping{OpcTag: "Channel1.T2", DbName: "pv"},
+		)},
+	})
+	waitFor(t, 10*time.Second, "订阅命令主题", func() bool { return broker.subscribed("cmd/+") })
+	// 等待首轮采集写入最新值缓存，未映射的点才能按原始点名反查
+	rtdb.waitLine(t, "Channel1.T3", linePrefix("Channel1.T3,3,192,"))
+
+	ack := func(id string) WriteResult {
+		msg := broker.waitMessage(t, "cmd/+/ack", func(m brokerMessage) bool {
+			return strings.Contains(m.Payload, `"id":"`+id+`"`)
+		})
+		var result WriteResult
+		if err := json.Unmarshal([]byte(msg.Payload), &result); err != nil {
+			t.Fatalf("回执不是JSON: %s", msg.Payload)
+		}
+		return result
+	}
+
+	// 可写点：工程值 25 按量程反算为原始值 250 写入
+	broker.publish("cmd/sp", `{"value": 25, "id": "c1"}`)
+	result := ack("c1")
+	if !result.Success || result.OpcTag != "Channel1.T1" || result.RawValue != 250.0 || result.Source != "line1" {
+		t.Errorf("回执 = %+v", result)
+	}
+	if writes := agent.written(); !reflect.DeepEqual(writes, []agentWrite{{NodeId: "Channel1.T1", Value: 250.0}}) {
+		t.Errorf("代理收到的写入 = %+v", writes)
+	}
+
+	// 未标记 writable 的点、未映射的点、不存在的点均拒绝，不会转发给代理
+	rejected := map[string]string{"c2": "pv", "c3": "Channel1.T3", "c4": "missing"}
+	for id, key := range rejected {
+		broker.publish("cmd/"+key, `{"value": 1, "id": "`+id+`"}`)
+	}
+	for id, key := range rejected {
+		if result := ack(id); result.Success || result.Key != key || result.Message == "" {
+			t.Errorf("%s 应被拒绝: %+v", key, result)
+		}
+	}
+	if writes := agent.written(); len(writes) != 1 {
+		t.Errorf("被拒绝的命令不应写入代理: %+v", writes)
+	}
+
+	// 代理写入失败时回执带上失败原因
+	agent.setFailWrite("OPC写入失败: 0xC0040007")
+	broker.publish("cmd/sp", `{"value": 30, "id": "c5"}`)
+	if result := ack("c5"); result.Success || !strings.Contains(result.Message, "0xC0040007") {
+		t.Errorf("代理失败回执 = %+v", result)
+	}
+}
@@ -29,7 +29,23 @@ go build -o collector_linux ^
     collector_main.go ^
     ConfigManager.go ^
     collector_web.go ^
-    KeyTransformer.go
+    KeyTransformer.go ^
+    Types.go ^
+    DiskBuffer.go ^
+    SparkplugB.go ^
+    TagPipeline.go ^
+    Metrics.go ^
+    RuntimeStatus.go ^
+    ValueCache.go ^
+    LiveHub.go ^
+    Alerting.go ^
+    Alarms.go ^
+    EmailChannel.go ^
+    Simulator.go ^
+    KeyReverse.go ^
+    WriteBack.go ^
+    KeyCollision.go ^
+    TransformWatcher.go
 
 if %ERRORLEVEL% EQU 0 (
     echo.
@@ -22,7 +22,23 @@ go build -o collector \
     collector_main.go \
     ConfigManager.go \
     collector_web.go \
-    KeyTransformer.go
+    KeyTransformer.go \
+    Types.go \
+    DiskBuffer.go \
+    SparkplugB.go \
+    TagPipeline.go \
+    Metrics.go \
+    RuntimeStatus.go \
+    ValueCache.go \
+    LiveHub.go \
+    Alerting.go \
+    Alarms.go \
+    EmailChannel.go \
+    Simulator.go \
+    KeyReverse.go \
+    WriteBack.go \
+    KeyCollision.go \
+    TransformWatcher.go
 
 if [ $? -eq 0 ]; then
     echo "✅ 编译成功!"
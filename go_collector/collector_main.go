@@ -3,6 +3,8 @@ package main
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -10,7 +12,9 @@ import (
 	"net"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
@@ -32,6 +36,7 @@ func main() {
 	webPort := flag.Int("web-port", 9090, "Web服务器端口")
 	showHelp := flag.Bool("help", false, "显示帮助信息")
 	showVersion := flag.Bool("version", false, "显示版本信息")
+	simulate := flag.Bool("simulate", false, "所有数据源改用内置模拟数据（无需OPC代理）")
 	flag.Parse()
 
 	if *showHelp {
@@ -71,6 +76,10 @@ func main() {
 	os.Stdout.Sync()
 
 	collector := NewCollector(config)
+	if *simulate {
+		collector.simulate = true
+		fmt.Println("⚠️ 模拟模式：数据源使用内置模拟数据，不连接OPC代理")
+	}
 
 	if *webPort > 0 {
 		go func() {
@@ -115,6 +124,7 @@ func showHelpInfo() {
 	fmt.Println("选项:")
 	fmt.Println("  --config <path>      配置文件路径 (默认: collector.ini)")
 	fmt.Println("  --web-port <port>    Web服务器端口 (默认: 9090, 0=禁用)")
+	fmt.Println("  --simulate           所有数据源改用内置模拟数据（sim_file 指定点定义）")
 	fmt.Println("  --help               显示此帮助信息")
 	fmt.Println("  --version            显示版本信息")
 	fmt.Println()
@@ -122,6 +132,7 @@ func showHelpInfo() {
 	fmt.Println("  collector")
 	fmt.Println("  collector --config my_config.ini")
 	fmt.Println("  collector --web-port 8080")
+	fmt.Println("  collector --simulate")
 	fmt.Println()
 	fmt.Println("Web界面:")
 	fmt.Println("  http://localhost:9090/")
@@ -133,54 +144,203 @@ func waitForShutdown() {
 	<-sigChan
 }
 
+// Collector 的 config、数据源、输出端与缓冲只在 Start 中（持 mu）赋值。Start 启动的协程（任务、补发、
+// 写入命令等）由 wg 跟踪，Stop 等它们全部退出后才会替换这些字段，因此这些协程可以直接读取；
+// 其他协程（Web 接口、指标抓取）通过 snapshot 读取。
 type Collector struct {
 	config      *AppConfig
 	httpClients []*HttpClient
 	mqttClient  *MqttClient
 	rtdbClient  *RtdbClient
+	mqttBuffer  *DiskBuffer
+	rtdbBuffer  *DiskBuffer
 	running     bool
 	cancelFunc  context.CancelFunc
+	// simulate 为 true 时所有数据源使用内置模拟数据（--simulate）
+	simulate bool
+
+	// lifecycle 串行化 Start / Stop / Reload
+	lifecycle sync.Mutex
+	wg        sync.WaitGroup
+
+	mu        sync.Mutex
+	runners   []*TaskRunner
+	startTime time.Time
+
+	values     *ValueCache
+	live       *LiveHub
+	events     *EventBus
+	alarms     *AlarmEngine
+	stopAlerts func()
+	// alarmQueue 把报警报文交给独立协程发布到 MQTT，避免 Broker 阻塞时拖慢采集
+	alarmQueue chan alarmPublish
+}
+
+// alarmQueueSize 是待发布报警报文的上限，队列满时丢弃新报文（告警通道的通知不受影响）
+const alarmQueueSize = 256
+
+type alarmPublish struct {
+	topic   string
+	payload []byte
 }
 
 type TaskRunner struct {
+	name        string
 	task        *TaskConfig
 	transformer *KeyTransformer
 	config      *AppConfig
+	tagIndex    map[string]*TagMapping
+	detector    *changeDetector
+	collisions  *collisionResolver
+	state       runnerState
+
+	// SSE 白名单模式下各点最近一次收到更新的时间与是否已按超时上报坏质量，仅在任务协程中使用
+	lastSeen map[string]time.Time
+	stale    map[string]bool
+}
+
+// sseStaleIntervals SSE 白名单模式下，点超过该倍数的任务周期未收到更新时以坏质量上报
+const sseStaleIntervals = 3
+
+func newTaskRunner(name string, task *TaskConfig, config *AppConfig) *TaskRunner {
+	tagIndex := make(map[string]*TagMapping, len(task.Tags))
+	for _, tag := range task.Tags {
+		if _, exists := tagIndex[tag.OpcTag]; !exists {
+			tagIndex[tag.OpcTag] = tag
+		}
+	}
+	return &TaskRunner{
+		name:        name,
+		task:        task,
+		config:      config,
+		transformer: NewKeyTransformer(),
+		tagIndex:    tagIndex,
+		detector:    newChangeDetector(),
+		collisions:  newCollisionResolver(),
+	}
+}
+
+// runnersFor 返回使用指定数据源的运行中任务，source 为空时返回全部
+func (c *Collector) runnersFor(source string) []*TaskRunner {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var result []*TaskRunner
+	for _, runner := range c.runners {
+		if source == "" || runner.task.HttpSource == source {
+			result = append(result, runner)
+		}
+	}
+	return result
 }
 
 func NewCollector(config *AppConfig) *Collector {
-	return &Collector{
+	c := &Collector{
 		config: config,
+		values: NewValueCache(),
+		live:   NewLiveHub(),
+		events: NewEventBus(),
+
+		alarmQueue: make(chan alarmPublish, alarmQueueSize),
+	}
+	c.alarms = NewAlarmEngine(c.onAlarm)
+	return c
+}
+
+// collectorSnapshot 是 Collector 当前配置与输出端的一致快照
+type collectorSnapshot struct {
+	config     *AppConfig
+	running    bool
+	mqttClient *MqttClient
+	rtdbClient *RtdbClient
+	mqttBuffer *DiskBuffer
+	rtdbBuffer *DiskBuffer
+}
+
+// snapshot 供 Start 启动的协程以外的调用方读取当前配置与输出端
+func (c *Collector) snapshot() collectorSnapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return collectorSnapshot{
+		config:     c.config,
+		running:    c.running,
+		mqttClient: c.mqttClient,
+		rtdbClient: c.rtdbClient,
+		mqttBuffer: c.mqttBuffer,
+		rtdbBuffer: c.rtdbBuffer,
 	}
 }
 
+// spawn 启动一个由 Stop 等待退出的协程
+func (c *Collector) spawn(fn func()) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		fn()
+	}()
+}
+
 func (c *Collector) Start() error {
+	c.lifecycle.Lock()
+	defer c.lifecycle.Unlock()
+	return c.start()
+}
+
+func (c *Collector) start() error {
 	ctx, cancel := context.WithCancel(context.Background())
-	c.cancelFunc = cancel
-	c.running = true
+	c.mu.Lock()
+	config := c.config
+	c.mu.Unlock()
+
+	c.startAlerts(config)
 
-	c.httpClients = make([]*HttpClient, 0)
-	for _, httpConfig := range c.config.HttpConfigs {
+	// 先在局部变量中创建数据源与输出端，最后一次性替换，Web 接口不会读到半初始化的状态
+	var mqttClient *MqttClient
+	var rtdbClient *RtdbClient
+	httpClients := make([]*HttpClient, 0)
+	for _, httpConfig := range config.HttpConfigs {
 		if httpConfig.Enabled {
 			client := NewHttpClient(httpConfig)
-			c.httpClients = append(c.httpClients, client)
-			fmt.Printf("✓ HTTP数据源[%s]配置完成\n", httpConfig.Name)
+			if c.simulate || httpConfig.Type == HttpTypeSimulate {
+				simulator, err := LoadSimulator(httpConfig.SimFile)
+				if err != nil {
+					log.Printf("⚠️ 模拟数据源[%s]加载失败: %v", httpConfig.Name, err)
+					continue
+				}
+				client.simulator = simulator
+				fmt.Printf("✓ 模拟数据源[%s]配置完成，%d 个点\n", httpConfig.Name, simulator.TagCount())
+			} else {
+				fmt.Printf("✓ HTTP数据源[%s]配置完成\n", httpConfig.Name)
+			}
+			httpClients = append(httpClients, client)
 		}
 	}
-
-	if c.config.MqttConfig != nil && c.config.MqttConfig.Enabled {
-		c.mqttClient = NewMqttClient(c.config.MqttConfig)
-		if err := c.mqttClient.Connect(); err != nil {
-			return fmt.Errorf("MQTT连接失败: %v", err)
+	// 模拟模式下没有可用数据源时补一个内置示例源，供 http_source 为空的任务使用
+	if c.simulate && len(httpClients) == 0 {
+		client := NewHttpClient(&HttpConfig{Name: "simulator", Enabled: true, Type: HttpTypeSimulate})
+		client.simulator, _ = LoadSimulator("")
+		httpClients = append(httpClients, client)
+		fmt.Println("✓ 模拟数据源[simulator]配置完成（内置示例点）")
+	}
+
+	if config.MqttConfig != nil && config.MqttConfig.Enabled {
+		mqttClient = NewMqttClient(config.MqttConfig)
+		mqttClient.OnStateChange(c.onMqttStateChange)
+		if err := mqttClient.Connect(); err != nil {
+			log.Printf("⚠️ MQTT连接失败: %v", err)
+			c.events.Error(EventMqttError, "mqtt", err)
+		} else if mqttClient.IsConnected() {
+			fmt.Println("✓ MQTT连接成功")
+		} else {
+			c.events.Error(EventMqttError, "mqtt", fmt.Errorf("MQTT暂未连接到 %s", mqttClient.brokerURL()))
 		}
-		fmt.Println("✓ MQTT连接成功")
 	}
 
-	if c.config.RtdbConfig != nil && c.config.RtdbConfig.Enabled {
-		if c.config.RtdbConfig.Host != "" && c.config.RtdbConfig.Port > 0 {
-			c.rtdbClient = NewRtdbClient(c.config.RtdbConfig)
-			if err := c.rtdbClient.Connect(); err != nil {
-				log.Printf("⚠️ RTDB连接失败: %v", err)
+	if config.RtdbConfig != nil && config.RtdbConfig.Enabled {
+		if config.RtdbConfig.Host != "" && config.RtdbConfig.Port > 0 {
+			rtdbClient = NewRtdbClient(config.RtdbConfig)
+			rtdbClient.OnStateChange(c.onRtdbStateChange)
+			if err := rtdbClient.Connect(); err != nil {
+				log.Printf("⚠️ RTDB连接失败，将在后台重连: %v", err)
 			} else {
 				fmt.Println("✓ RTDB连接成功")
 			}
@@ -189,29 +349,255 @@ func (c *Collector) Start() error {
 		}
 	}
 
-	for _, task := range c.config.Tasks {
+	var mqttBuffer, rtdbBuffer *DiskBuffer
+	buffered := config.BufferConfig != nil && config.BufferConfig.Enabled
+	if buffered {
+		if mqttClient != nil {
+			mqttBuffer = openBuffer(config.BufferConfig, "mqtt")
+		}
+		if rtdbClient != nil {
+			rtdbBuffer = openBuffer(config.BufferConfig, "rtdb")
+		}
+	}
+
+	runners := make([]*TaskRunner, 0, len(config.Tasks))
+	for i, task := range config.Tasks {
 		if task.Enabled {
-			runner := &TaskRunner{
-				task:        task,
-				config:      c.config,
-				transformer: NewKeyTransformer(),
-			}
-			transformFile := "transform.json"
-			if task.HttpSource != "" {
-				transformFile = "transform_" + task.HttpSource + ".json"
+			if task.Strict && len(task.Tags) == 0 {
+				log.Printf("⚠️ 任务[%s]启用了白名单模式但未配置标签，将不会发布任何数据", task.HttpSource)
 			}
-			runner.transformer.LoadFromFile(transformFile)
-			go runner.run(ctx, c)
+			runners = append(runners, newTaskRunner(fmt.Sprintf("task%d", i+1), task, config))
 		}
 	}
+	// 先加载键名转换规则再启动任务，之后由监视器在规则文件变化时替换
+	watcher := newTransformWatcher(c.events, runners)
+
+	c.mu.Lock()
+	c.cancelFunc = cancel
+	c.running = true
+	c.httpClients = httpClients
+	c.mqttClient, c.rtdbClient = mqttClient, rtdbClient
+	c.mqttBuffer, c.rtdbBuffer = mqttBuffer, rtdbBuffer
+	c.runners = runners
+	c.startTime = time.Now()
+	c.mu.Unlock()
+
+	// 以下协程在字段赋值之后启动，运行期间可直接读取
+	c.startCommands(ctx)
+	if rtdbClient != nil {
+		c.spawn(func() { rtdbClient.Run(ctx) })
+	}
+	if buffered {
+		c.spawn(func() { c.runBufferReplay(ctx) })
+	}
+	c.alarms.Configure(alarmBindings(config))
+	c.spawn(func() { c.alarms.Run(ctx) })
+	if mqttClient != nil {
+		c.spawn(func() { c.runAlarmPublisher(ctx, mqttClient) })
+	}
+	c.spawn(func() { watcher.run(ctx, transformWatchInterval) })
+	for _, runner := range runners {
+		runner := runner
+		c.spawn(func() { runner.run(ctx, c) })
+	}
 
 	return nil
 }
 
+func (c *Collector) onMqttStateChange(connected bool, err error) {
+	if connected {
+		log.Println("📡 MQTT连接状态: 已连接")
+		c.events.Recover(EventMqttError, "mqtt", "MQTT已重新连接")
+		return
+	}
+	log.Printf("📡 MQTT连接状态: 已断开 (%v)", err)
+	c.events.Error(EventMqttError, "mqtt", err)
+}
+
+func (c *Collector) onRtdbStateChange(connected bool, err error) {
+	if connected {
+		c.events.Recover(EventRtdbError, "rtdb", "RTDB已重新连接")
+		return
+	}
+	c.events.Error(EventRtdbError, "rtdb", err)
+}
+
+// onAlarm 把报警状态变化送往告警通道与 MQTT 报警主题；确认只发布到 MQTT
+func (c *Collector) onAlarm(alarm Alarm, transition string) {
+	switch transition {
+	case AlarmRaised:
+		log.Printf("🚨 %s", alarm.Message)
+		c.events.publish(Event{Type: EventAlarm, Subject: alarm.Id, Severity: SeverityError, Message: alarm.Message})
+	case AlarmCleared:
+		log.Printf("✅ 报警解除: %s", alarm.Message)
+		c.events.Recover(EventAlarm, alarm.Id, "已解除: "+alarm.Message)
+	}
+
+	// 报警确认来自 Web 接口，不在 Start 启动的协程中，需通过快照读取
+	current := c.snapshot()
+	mqttClient := current.mqttClient
+	if mqttClient == nil || current.config.MqttConfig.AlarmTopic == "" {
+		return
+	}
+	payload, err := json.Marshal(struct {
+		Event string `json:"event"`
+		Alarm
+	}{transition, alarm})
+	if err != nil {
+		return
+	}
+	topic := renderTopic(current.config.MqttConfig.AlarmTopic, alarm.Source, alarm.Key)
+	select {
+	case c.alarmQueue <- alarmPublish{topic: topic, payload: payload}:
+	default:
+		log.Printf("⚠️ 报警发布队列已满，丢弃报文 topic=%s", topic)
+	}
+}
+
+// runAlarmPublisher 按顺序发布报警报文，每条最多等待 mqttPublishTimeout
+func (c *Collector) runAlarmPublisher(ctx context.Context, client *MqttClient) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case p := <-c.alarmQueue:
+			if err := client.PublishRaw(p.topic, p.payload); err != nil {
+				log.Printf("⚠️ 报警发布到MQTT失败 topic=%s: %v", p.topic, err)
+			}
+		}
+	}
+}
+
+// startAlerts 按当前配置创建告警通道（Webhook、邮件）并订阅事件总线
+func (c *Collector) startAlerts(config *AppConfig) {
+	var channels []AlertChannel
+	repeat, retries := 10*time.Minute, 3
+	webhook := config.WebhookConfig
+	if webhook != nil && webhook.Enabled && webhook.Url != "" {
+		channels = append(channels, NewWebhookChannel(webhook))
+		if webhook.RepeatMinutes > 0 {
+			repeat = time.Duration(webhook.RepeatMinutes) * time.Minute
+		}
+		if webhook.Retries != nil && *webhook.Retries >= 0 {
+			retries = *webhook.Retries
+		}
+	}
+	monitor := config.MonitorConfig
+	if monitor != nil && monitor.Monitor && monitor.Mode == MonitorModeEmail {
+		if email, err := NewEmailChannel(monitor, config.Title); err != nil {
+			log.Printf("⚠️ 邮件告警未启用: %v", err)
+		} else {
+			channels = append(channels, email)
+		}
+	}
+	if len(channels) == 0 {
+		return
+	}
+	c.stopAlerts = NewAlertDispatcher(channels, repeat, retries).Start(c.events)
+}
+
+func openBuffer(config *BufferConfig, name string) *DiskBuffer {
+	buffer, err := NewDiskBuffer(config, name)
+	if err != nil {
+		log.Printf("⚠️ %s磁盘缓冲初始化失败，故障期间数据将被丢弃: %v", name, err)
+		return nil
+	}
+	fmt.Printf("✓ %s磁盘缓冲已启用: %s\n", name, buffer.dir)
+	return buffer
+}
+
+// runBufferReplay 定期检查输出端是否恢复，恢复后把积压数据按时间顺序补发
+func (c *Collector) runBufferReplay(ctx context.Context) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if c.mqttBuffer != nil && c.mqttBuffer.Len() > 0 && c.mqttClient.IsConnected() {
+			n, err := c.mqttBuffer.Replay(c.mqttClient.Publish)
+			c.logReplay("MQTT", n, err, c.mqttBuffer)
+		}
+		if c.rtdbBuffer != nil && c.rtdbBuffer.Len() > 0 && c.rtdbClient.IsConnected() {
+			n, err := c.rtdbBuffer.Replay(c.rtdbClient.Send)
+			c.logReplay("RTDB", n, err, c.rtdbBuffer)
+		}
+	}
+}
+
+func (c *Collector) logReplay(sink string, n int, err error, buffer *DiskBuffer) {
+	metricSinkPublished.Add(float64(n), strings.ToLower(sink))
+	if err != nil {
+		metricSinkFailures.Inc(strings.ToLower(sink))
+	}
+	if n > 0 {
+		log.Printf("📦 %s补发积压 %d 批，剩余 %d 批", sink, n, buffer.Len())
+	}
+	if err != nil {
+		log.Printf("%s补发中断: %v", sink, err)
+	}
+}
+
+// deliver 发送一批数据到指定输出端；未连接或发送失败时写入磁盘缓冲。
+// 缓冲区仍有积压时新数据直接入队，由补发协程按时间顺序送出，避免乱序。
+func (c *Collector) deliver(sink string, buffer *DiskBuffer, connected bool, send func(map[string]interface{}, string) error, msg map[string]interface{}, source string) {
+	if buffer != nil && buffer.Len() > 0 {
+		c.bufferMessage(sink, buffer, msg, source)
+		return
+	}
+	if !connected {
+		c.bufferMessage(sink, buffer, msg, source)
+		return
+	}
+	if err := send(msg, source); err != nil {
+		log.Printf("%s发送失败: %v", sink, err)
+		metricSinkFailures.Inc(strings.ToLower(sink))
+		c.events.Error(strings.ToLower(sink)+"_error", strings.ToLower(sink), fmt.Errorf("%s发送失败: %v", sink, err))
+		// 部分送出时只缓冲剩余的点，避免补发重复
+		c.bufferMessage(sink, buffer, unsentMessage(msg, err), source)
+		return
+	}
+	metricSinkPublished.Inc(strings.ToLower(sink))
+	// 连接一直保持时不会经过连接状态回调，发送成功即视为发送故障已恢复
+	c.events.Recover(strings.ToLower(sink)+"_error", strings.ToLower(sink), sink+"发送已恢复")
+}
+
+func (c *Collector) bufferMessage(sink string, buffer *DiskBuffer, msg map[string]interface{}, source string) {
+	if buffer == nil {
+		return
+	}
+	if err := buffer.Push(msg, source); err != nil {
+		log.Printf("⚠️ %s缓冲写入失败: %v", sink, err)
+		return
+	}
+	metricSinkBuffered.Inc(strings.ToLower(sink))
+}
+
 func (c *Collector) Stop() {
+	c.lifecycle.Lock()
+	defer c.lifecycle.Unlock()
+	c.stop()
+}
+
+// stop 通知并等待 Start 启动的协程全部退出，再断开输出端
+func (c *Collector) stop() {
+	c.mu.Lock()
 	c.running = false
-	if c.cancelFunc != nil {
-		c.cancelFunc()
+	cancel := c.cancelFunc
+	c.cancelFunc = nil
+	c.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	c.wg.Wait()
+
+	if c.stopAlerts != nil {
+		c.stopAlerts()
+		c.stopAlerts = nil
 	}
 
 	if c.mqttClient != nil {
@@ -226,9 +612,13 @@ func (c *Collector) Stop() {
 }
 
 func (c *Collector) Reload(newConfig *AppConfig) {
-	c.Stop()
+	c.lifecycle.Lock()
+	defer c.lifecycle.Unlock()
+	c.stop()
+	c.mu.Lock()
 	c.config = newConfig
-	c.Start()
+	c.mu.Unlock()
+	c.start()
 	log.Println("✅ 配置已热加载")
 }
 
@@ -236,18 +626,19 @@ func (tr *TaskRunner) run(ctx context.Context, collector *Collector) {
 	// 数据源 URL 含 /api/stream 时走 SSE 订阅推送，否则保持原有定时轮询
 	if tr.task.HttpSource != "" {
 		for _, client := range collector.httpClients {
-			if client.config.Name == tr.task.HttpSource && strings.Contains(client.config.Url, "/api/stream") {
+			if client.config.Name == tr.task.HttpSource && client.simulator == nil && strings.Contains(client.config.Url, "/api/stream") {
+				tr.state.setRunning(true, RunnerModeSse)
+				defer tr.state.setRunning(false, "")
 				tr.runSse(ctx, collector, client)
 				return
 			}
 		}
 	}
 
-	interval := time.Duration(tr.task.JobIntervalSecond) * time.Second
-	if interval <= 0 {
-		interval = time.Second
-	}
-	ticker := time.NewTicker(interval)
+	tr.state.setRunning(true, RunnerModePolling)
+	defer tr.state.setRunning(false, "")
+
+	ticker := time.NewTicker(tr.interval())
 	defer ticker.Stop()
 
 	for {
@@ -260,63 +651,167 @@ func (tr *TaskRunner) run(ctx context.Context, collector *Collector) {
 	}
 }
 
+// interval 返回任务周期：轮询间隔，SSE 模式下作为点更新的预期间隔
+func (tr *TaskRunner) interval() time.Duration {
+	interval := time.Duration(tr.task.JobIntervalSecond) * time.Second
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return interval
+}
+
 func (tr *TaskRunner) runSse(ctx context.Context, collector *Collector, client *HttpClient) {
 	backoff := time.Second
-	for {
+	for attempt := 0; ; attempt++ {
 		select {
 		case <-ctx.Done():
 			return
 		default:
 		}
+		if attempt > 0 {
+			metricSseReconnects.Inc(client.config.Name)
+		}
 
 		streamURL := client.config.Url
 		log.Printf("SSE 连接 %s", streamURL)
-		req, err := http.NewRequest("GET", streamURL, nil)
+		// 请求绑定 ctx，停止 / 热加载时立即断开旧的订阅连接
+		req, err := http.NewRequestWithContext(ctx, "GET", streamURL, nil)
 		if err != nil {
 			log.Printf("SSE 请求创建失败: %v", err)
-			time.Sleep(backoff)
+			// 退避期间响应停止 / 热加载，避免 Stop 等待整个退避间隔
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
 			continue
 		}
 		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
 			log.Printf("SSE 连接失败: %v", err)
-			time.Sleep(backoff)
+			tr.state.recordError(fmt.Errorf("SSE 连接失败: %v", err))
+			collector.events.Error(EventSseError, client.config.Name, fmt.Errorf("SSE 连接失败: %v", err))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
 			backoff = minDuration(backoff*2, 30*time.Second)
 			continue
 		}
 		if resp.StatusCode != 200 {
 			resp.Body.Close()
 			log.Printf("SSE 返回状态码 %d", resp.StatusCode)
-			time.Sleep(backoff)
+			tr.state.recordError(fmt.Errorf("SSE 返回状态码 %d", resp.StatusCode))
+			collector.events.Error(EventSseError, client.config.Name, fmt.Errorf("SSE 返回状态码 %d", resp.StatusCode))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
 			backoff = minDuration(backoff*2, 30*time.Second)
 			continue
 		}
 		backoff = time.Second
+		tr.state.setSseConnected(true)
+		collector.events.Recover(EventSseError, client.config.Name, "SSE 已重新连接")
+
+		err = tr.readSse(ctx, collector, resp.Body)
+		resp.Body.Close()
+		tr.state.setSseConnected(false)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("SSE 连接断开: %v", err)
+		disconnectErr := fmt.Errorf("SSE 连接被数据源关闭")
+		if err != nil {
+			disconnectErr = fmt.Errorf("SSE 连接断开: %v", err)
+		}
+		tr.state.recordError(disconnectErr)
+		collector.events.Error(EventSseError, client.config.Name, disconnectErr)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = minDuration(backoff*2, 30*time.Second)
+	}
+}
 
-		scanner := bufio.NewScanner(resp.Body)
+// readSse 处理一次 SSE 连接直到断开，返回读取错误（数据源正常关闭时为 nil）。
+// 白名单模式下同时按任务周期检查超时未更新的点。
+func (tr *TaskRunner) readSse(ctx context.Context, collector *Collector, body io.Reader) error {
+	lines := make(chan string)
+	var scanErr error
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(body)
 		scanner.Buffer(make([]byte, 1024*1024), 8*1024*1024)
 		for scanner.Scan() {
 			select {
+			case lines <- scanner.Text():
 			case <-ctx.Done():
-				resp.Body.Close()
 				return
-			default:
 			}
-			line := scanner.Text()
+		}
+		scanErr = scanner.Err()
+	}()
+
+	var staleTick <-chan time.Time
+	if tr.task.Strict {
+		tr.resetStale(time.Now())
+		ticker := time.NewTicker(tr.interval())
+		defer ticker.Stop()
+		staleTick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case line, ok := <-lines:
+			if !ok {
+				return scanErr
+			}
 			if strings.HasPrefix(line, "data:") {
 				payload := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
 				if payload != "" {
 					tr.handleSsePayload(collector, payload)
 				}
 			}
+		case now := <-staleTick:
+			tr.checkStale(collector, now)
 		}
-		log.Printf("SSE 连接断开: %v", scanner.Err())
-		resp.Body.Close()
-		time.Sleep(backoff)
-		backoff = minDuration(backoff*2, 30*time.Second)
 	}
 }
 
+// resetStale 在 SSE 连接建立时重新计时，尚未收到的点从此刻起算超时
+func (tr *TaskRunner) resetStale(now time.Time) {
+	tr.lastSeen = make(map[string]time.Time, len(tr.tagIndex))
+	tr.stale = make(map[string]bool)
+	for opcTag := range tr.tagIndex {
+		tr.lastSeen[opcTag] = now
+	}
+}
+
+// checkStale 把超过 sseStaleIntervals 个任务周期未收到更新的白名单点以坏质量上报，每次超时只上报一次
+func (tr *TaskRunner) checkStale(collector *Collector, now time.Time) {
+	timeout := sseStaleIntervals * tr.interval()
+	var pending pendingPoints
+	for _, tag := range tr.task.Tags {
+		if tr.tagIndex[tag.OpcTag] != tag || tr.stale[tag.OpcTag] || now.Sub(tr.lastSeen[tag.OpcTag]) < timeout {
+			continue
+		}
+		tr.stale[tag.OpcTag] = true
+		pending.add(tag.DbName, tag.OpcTag, tag, nil, 0, nil)
+	}
+	if len(pending.points) == 0 {
+		return
+	}
+	log.Printf("⚠️ 任务[%s] %d 个点超过 %v 未收到更新，以坏质量上报", tr.name, len(pending.points), timeout)
+	tr.publish(collector, &pending, now)
+}
+
 func (tr *TaskRunner) handleSsePayload(collector *Collector, payload string) {
 	var envelope struct {
 		Ts     string                   `json:"ts"`
@@ -324,28 +819,110 @@ func (tr *TaskRunner) handleSsePayload(collector *Collector, payload string) {
 	}
 	if err := json.Unmarshal([]byte(payload), &envelope); err != nil {
 		log.Printf("SSE 报文解析失败: %v", err)
+		tr.state.recordError(fmt.Errorf("SSE 报文解析失败: %v", err))
+		collector.events.Error(EventCollectError, tr.name, fmt.Errorf("SSE 报文解析失败: %v", err))
 		return
 	}
 	if len(envelope.Values) == 0 {
 		return
 	}
 
+	// 点级 timestamp 缺失时使用报文头 ts
+	envelopeTs, hasEnvelopeTs := parseSourceTime(envelope.Ts)
+
 	rawData := make([]map[string]interface{}, 0, len(envelope.Values))
 	for _, v := range envelope.Values {
-		rawData = append(rawData, map[string]interface{}{
-			"topic":   v["key"],
-			"value":   v["value"],
-			"quality": qualityToInt(v["quality"]),
-		})
+		key := v["key"]
+		if key == nil {
+			key = v["node_id"]
+		}
+		item := sourceItem(key, v["value"], v)
+		if _, ok := item["timestamp"]; !ok && hasEnvelopeTs {
+			item["timestamp"] = envelopeTs
+		}
+		rawData = append(rawData, item)
+	}
+	tr.processAndPublish(collector, rawData, false)
+}
+
+// sourceItem 组装一条原始数据：meta 为数据源提供的点级信息（quality / status / timestamp / data_type），可为 nil。
+// 未提供质量码时视为 Good(192)；timestamp 仅在能解析时写入，由 processAndPublish 决定是否采用。
+func sourceItem(key, value interface{}, meta map[string]interface{}) map[string]interface{} {
+	item := map[string]interface{}{
+		"topic":   key,
+		"value":   value,
+		"quality": 192,
+	}
+	if meta == nil {
+		return item
 	}
-	tr.processAndPublish(collector, rawData)
+	if q, ok := meta["quality"]; ok && q != nil {
+		item["quality"] = qualityToInt(q)
+	} else if st, ok := meta["status"]; ok && st != nil {
+		item["quality"] = qualityToInt(st)
+	}
+	if ts, ok := parseSourceTime(meta["timestamp"]); ok {
+		item["timestamp"] = ts
+	}
+	if dt, ok := meta["data_type"].(string); ok && dt != "" {
+		item["data_type"] = dt
+	}
+	return item
 }
 
+// sourceTimeLayouts 覆盖 C# DateTime 经 Newtonsoft 序列化的常见形式（带/不带时区、7 位小数）
+var sourceTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006/01/02 15:04:05",
+}
+
+// parseSourceTime 把数据源时间解析为毫秒时间戳：支持 ISO 8601 字符串、/Date(ms)/ 以及数值毫秒；
+// 不带时区的时间按本地时区解释（与 C# DateTimeKind.Local/Unspecified 一致）。
+func parseSourceTime(v interface{}) (int64, bool) {
+	switch t := v.(type) {
+	case float64:
+		if t > 0 {
+			return int64(t), true
+		}
+	case int64:
+		if t > 0 {
+			return t, true
+		}
+	case string:
+		t = strings.TrimSpace(t)
+		if t == "" || strings.HasPrefix(t, "0001-01-01") {
+			return 0, false
+		}
+		if strings.HasPrefix(t, "/Date(") {
+			var ms int64
+			if _, err := fmt.Sscanf(strings.TrimPrefix(t, "/Date("), "%d", &ms); err == nil {
+				return ms, true
+			}
+			return 0, false
+		}
+		for _, layout := range sourceTimeLayouts {
+			if parsed, err := time.ParseInLocation(layout, t, time.Local); err == nil {
+				return parsed.UnixMilli(), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// qualityToInt 把 OPC 质量转为 OPC DA 质量码：Good=192、Uncertain=64、Bad=0，数值原样返回
 func qualityToInt(q interface{}) int {
 	switch v := q.(type) {
 	case string:
-		if v == "Good" {
+		switch {
+		case strings.HasPrefix(v, "Good"):
 			return 192
+		case strings.HasPrefix(v, "Uncertain"):
+			return 64
+		}
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
 		}
 		return 0
 	case float64:
@@ -368,12 +945,6 @@ func minDuration(a, b time.Duration) time.Duration {
 }
 
 func (tr *TaskRunner) collectData(collector *Collector) {
-	transformFile := "transform.json"
-	if tr.task.HttpSource != "" {
-		transformFile = "transform_" + tr.task.HttpSource + ".json"
-	}
-	tr.transformer.LoadFromFile(transformFile)
-
 	var rawData []map[string]interface{}
 
 	if tr.task.HttpSource != "" {
@@ -382,8 +953,11 @@ func (tr *TaskRunner) collectData(collector *Collector) {
 				fetched, err := collector.fetchFromHttp(client)
 				if err != nil {
 					log.Printf("HTTP[%s]获取数据失败: %v", tr.task.HttpSource, err)
+					tr.state.recordError(err)
+					collector.events.Error(EventHttpError, client.config.Name, err)
 					return
 				}
+				collector.events.Recover(EventHttpError, client.config.Name, "HTTP数据源已恢复")
 				rawData = fetched
 				break
 			}
@@ -393,8 +967,11 @@ func (tr *TaskRunner) collectData(collector *Collector) {
 			fetched, err := collector.fetchFromHttp(client)
 			if err != nil {
 				log.Printf("HTTP[%s]获取数据失败: %v", client.config.Name, err)
+				tr.state.recordError(err)
+				collector.events.Error(EventHttpError, client.config.Name, err)
 				continue
 			}
+			collector.events.Recover(EventHttpError, client.config.Name, "HTTP数据源已恢复")
 			rawData = append(rawData, fetched...)
 		}
 	}
@@ -403,35 +980,117 @@ func (tr *TaskRunner) collectData(collector *Collector) {
 		return
 	}
 
-	tr.processAndPublish(collector, rawData)
+	tr.processAndPublish(collector, rawData, true)
 }
 
-func (tr *TaskRunner) processAndPublish(collector *Collector, rawData []map[string]interface{}) {
-	values := make(map[string]interface{})
-	metadata := make(map[string]map[string]interface{})
+// processAndPublish 处理一批原始数据。snapshot 表示这批数据是数据源的全量（轮询结果），
+// 只有全量数据才能说明白名单中的点缺失；SSE 推送的是变化量，缺失的点由 checkStale 按超时判断。
+func (tr *TaskRunner) processAndPublish(collector *Collector, rawData []map[string]interface{}, snapshot bool) {
+	now := time.Now()
+	metricPointsCollected.Add(float64(len(rawData)), tr.name)
+	metricLastCollect.Set(float64(now.Unix()), tr.name)
 
+	var seen map[string]bool
+	if tr.task.Strict {
+		seen = make(map[string]bool, len(tr.tagIndex))
+	}
+
+	var pending pendingPoints
 	for _, item := range rawData {
 		origKey, _ := item["topic"].(string)
 		val := item["value"]
 		quality, _ := item["quality"].(int)
 
-		newKey := tr.transformer.Transform(origKey)
+		tag := tr.tagIndex[origKey]
+		if tr.task.Strict {
+			// 白名单模式：只发布任务中配置的点
+			if tag == nil {
+				continue
+			}
+			seen[origKey] = true
+			if tr.lastSeen != nil {
+				tr.lastSeen[origKey] = now
+				delete(tr.stale, origKey)
+			}
+		}
+
+		// 映射的点以 db_name 发布，不经过转换规则，也不进入反向转换的观测索引
+		var newKey string
+		if tag != nil {
+			newKey = tag.DbName
+		} else {
+			newKey = tr.transformer.Transform(origKey)
+		}
 
-		if len(tr.task.Tags) > 0 {
-			for _, tag := range tr.task.Tags {
-				if tag.OpcTag == origKey {
-					newKey = tag.DbName
-					break
-				}
+		pending.add(newKey, origKey, tag, val, quality, item)
+	}
+
+	// 白名单中本次数据源未返回的点，以坏质量上报
+	if tr.task.Strict && snapshot {
+		for _, tag := range tr.task.Tags {
+			if !seen[tag.OpcTag] && tr.tagIndex[tag.OpcTag] == tag {
+				pending.add(tag.DbName, tag.OpcTag, tag, nil, 0, nil)
 			}
 		}
+	}
+
+	published := tr.publish(collector, &pending, now)
+	tr.state.recordCollect(now, len(rawData), published)
+	collector.events.Recover(EventCollectError, tr.name, "数据处理已恢复")
+}
+
+// publish 按冲突策略处理待发布的点并送往各输出端，返回发布的点数
+func (tr *TaskRunner) publish(collector *Collector, pending *pendingPoints, now time.Time) int {
+	values := make(map[string]interface{})
+	metadata := make(map[string]map[string]interface{})
+
+	useSourceTime := tr.task.TimestampSource != TimestampSourceCollector
+	origKeys := make(map[string]string)
+	emit := func(key, origKey string, tag *TagMapping, val interface{}, quality int, item map[string]interface{}) {
+		val = scaleValue(tag, tr.task.TagPrecision, val)
+
+		// 报警判断在按变化上报之前，保证每个样本都参与（僵值、on_delay 计时依赖完整的样本序列）
+		if tag != nil && tag.Alarm != nil {
+			sourceTs, _ := item["timestamp"].(int64)
+			collector.alarms.Evaluate(tr.name, key, val, quality, sourceTs, now)
+		}
+
+		if tr.task.ReportByException && !tr.detector.shouldPublish(key, val, quality, deadbandFor(tr.task, tag), now) {
+			return
+		}
+
+		timestamp := now.UnixMilli()
+		if ts, ok := item["timestamp"].(int64); ok && useSourceTime {
+			timestamp = ts
+		}
 
-		values[newKey] = val
-		metadata[newKey] = map[string]interface{}{
+		values[key] = val
+		origKeys[key] = origKey
+		metadata[key] = map[string]interface{}{
 			"quality":   quality,
-			"timestamp": time.Now().UnixMilli(),
+			"timestamp": timestamp,
 		}
+		if dataType, ok := item["data_type"].(string); ok {
+			metadata[key]["data_type"] = dataType
+		}
+		if tag != nil && tag.Unit != "" {
+			metadata[key]["unit"] = tag.Unit
+		}
+	}
+
+	// 多个原始点得到同一发布键时按冲突策略处理，被丢弃的点不发布
+	resolved, collisions := tr.collisions.resolve(tr.task.CollisionPolicy, pending.keys, pending.origKeys)
+	tr.reportCollisions(collector, collisions)
+	for i, p := range pending.points {
+		if resolved[i] != "" {
+			emit(resolved[i], pending.origKeys[i], p.tag, p.val, p.quality, p.item)
+		}
+	}
+
+	if len(values) == 0 {
+		return 0
 	}
+	metricPointsPublished.Add(float64(len(values)), tr.name)
 
 	msg := map[string]interface{}{
 		"timestamp": time.Now().Format(time.RFC3339),
@@ -439,28 +1098,65 @@ func (tr *TaskRunner) processAndPublish(collector *Collector, rawData []map[stri
 		"metadata":  metadata,
 	}
 
-	if collector.mqttClient != nil && collector.mqttClient.IsConnected() {
-		if err := collector.mqttClient.Publish(msg, tr.task.HttpSource); err != nil {
-			log.Printf("MQTT发送失败: %v", err)
-		}
+	collector.values.Update(tr.name, tr.task.HttpSource, msg, origKeys)
+	collector.live.Publish(tr.name, tr.task.HttpSource, msg)
+
+	if collector.mqttClient != nil {
+		collector.deliver("MQTT", collector.mqttBuffer, collector.mqttClient.IsConnected(), collector.mqttClient.Publish, msg, tr.task.HttpSource)
 	}
 
-	if collector.rtdbClient != nil && collector.rtdbClient.IsConnected() {
-		if err := collector.rtdbClient.Send(msg, tr.task.HttpSource); err != nil {
-			log.Printf("RTDB发送失败: %v", err)
-		}
+	if collector.rtdbClient != nil {
+		collector.deliver("RTDB", collector.rtdbBuffer, collector.rtdbClient.IsConnected(), collector.rtdbClient.Send, msg, tr.task.HttpSource)
 	}
+	return len(values)
+}
+
+// ConnectionStatus 记录输出端连接的健康状态，供 Web 接口展示
+type ConnectionStatus struct {
+	Connected          bool   `json:"connected"`
+	Address            string `json:"address"`
+	LastError          string `json:"last_error,omitempty"`
+	LastErrorTime      string `json:"last_error_time,omitempty"`
+	LastConnectTime    string `json:"last_connect_time,omitempty"`
+	LastDisconnectTime string `json:"last_disconnect_time,omitempty"`
+	Reconnects         int    `json:"reconnects"`
 }
 
 type RtdbClient struct {
 	config    *RtdbConfig
+	mu        sync.Mutex
 	connected bool
 	conn      net.Conn
+	broken    chan struct{}
+	status    ConnectionStatus
+
+	onStateChange func(connected bool, err error)
 }
 
 func NewRtdbClient(config *RtdbConfig) *RtdbClient {
 	return &RtdbClient{
 		config: config,
+		broken: make(chan struct{}, 1),
+	}
+}
+
+func (c *RtdbClient) address() string {
+	return net.JoinHostPort(c.config.Host, strconv.Itoa(c.config.Port))
+}
+
+// OnStateChange 注册连接状态回调（连接建立 / 连接失败 / 断开），用于事件上报
+func (c *RtdbClient) OnStateChange(fn func(connected bool, err error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onStateChange = fn
+}
+
+func (c *RtdbClient) notify(connected bool, err error) {
+	c.mu.Lock()
+	fn := c.onStateChange
+	c.mu.Unlock()
+	if fn != nil {
+		fn(connected, err)
 	}
 }
 
@@ -469,32 +1165,130 @@ func (c *RtdbClient) Connect() error {
 		return fmt.Errorf("RTDB地址或端口未配置")
 	}
 
-	addr := fmt.Sprintf("%s:%d", c.config.Host, c.config.Port)
+	addr := c.address()
 	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
 	if err != nil {
-		return fmt.Errorf("连接RTDB失败: %v", err)
+		err = fmt.Errorf("连接RTDB失败: %v", err)
+		c.recordError(err)
+		c.notify(false, err)
+		return err
 	}
 
+	c.mu.Lock()
+	if c.status.LastConnectTime != "" {
+		c.status.Reconnects++
+	}
 	c.conn = conn
 	c.connected = true
+	c.status.LastConnectTime = time.Now().Format(time.RFC3339)
+	c.mu.Unlock()
+
+	// RTDB 不回写数据，读端只用于尽早发现对端关闭（EOF / RST）
+	go c.watch(conn)
+
 	log.Printf("✅ RTDB已连接到 %s", addr)
+	c.notify(true, nil)
 	return nil
 }
 
-func (c *RtdbClient) Disconnect() {
-	if c.conn != nil {
-		c.conn.Close()
+// Run 守护 RTDB 连接：连接断开后按指数退避重连（1s 起，最长 30s），直到 ctx 结束。
+func (c *RtdbClient) Run(ctx context.Context) {
+	backoff := time.Second
+	for {
+		if !c.IsConnected() {
+			if err := c.Connect(); err != nil {
+				log.Printf("RTDB重连失败，%v 后重试: %v", backoff, err)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+				backoff = minDuration(backoff*2, 30*time.Second)
+				continue
+			}
+			backoff = time.Second
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.broken:
+		}
+	}
+}
+
+func (c *RtdbClient) watch(conn net.Conn) {
+	_, err := io.Copy(io.Discard, conn)
+	if err == nil {
+		err = io.EOF
+	}
+	c.markBroken(conn, err)
+}
+
+// markBroken 把连接标记为已断开并通知守护协程重连；conn 已被替换时忽略过期通知
+func (c *RtdbClient) markBroken(conn net.Conn, err error) {
+	c.mu.Lock()
+	if c.conn != conn || !c.connected {
+		c.mu.Unlock()
+		return
+	}
+	c.connected = false
+	c.conn = nil
+	c.status.LastDisconnectTime = time.Now().Format(time.RFC3339)
+	c.mu.Unlock()
+
+	conn.Close()
+	c.recordError(err)
+	log.Printf("⚠️ RTDB连接断开: %v", err)
+	c.notify(false, err)
+
+	select {
+	case c.broken <- struct{}{}:
+	default:
 	}
+}
+
+func (c *RtdbClient) recordError(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.LastError = err.Error()
+	c.status.LastErrorTime = time.Now().Format(time.RFC3339)
+}
+
+// Status 返回连接健康状态快照
+func (c *RtdbClient) Status() ConnectionStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := c.status
+	status.Connected = c.connected
+	status.Address = c.address()
+	return status
+}
+
+func (c *RtdbClient) Disconnect() {
+	c.mu.Lock()
+	conn := c.conn
+	c.conn = nil
 	c.connected = false
+	c.mu.Unlock()
+
+	if conn != nil {
+		conn.Close()
+	}
 	log.Println("📴 RTDB已断开")
 }
 
 func (c *RtdbClient) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.connected
 }
 
 func (c *RtdbClient) Send(message map[string]interface{}, source string) error {
-	if !c.IsConnected() {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
 		return fmt.Errorf("RTDB未连接")
 	}
 
@@ -505,11 +1299,23 @@ func (c *RtdbClient) Send(message map[string]interface{}, source string) error {
 
 	metadata, _ := message["metadata"].(map[string]map[string]interface{})
 
-	for key, value := range values {
-		line := c.formatLine(key, value, metadata[key])
-		_, err := c.conn.Write([]byte(line + "\n"))
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for i, key := range keys {
+		line := c.formatLine(key, values[key], metadata[key])
+		conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		_, err := conn.Write([]byte(line + "\n"))
 		if err != nil {
-			return fmt.Errorf("发送数据失败: %v", err)
+			c.markBroken(conn, err)
+			err = fmt.Errorf("发送数据失败: %v", err)
+			if i > 0 {
+				// 已写出的行不再重发
+				return &partialSendError{err: err, remaining: keys[i:]}
+			}
+			return err
 		}
 		log.Printf("RTDB发送 [数据源:%s]: %s", source, line)
 	}
@@ -518,6 +1324,14 @@ func (c *RtdbClient) Send(message map[string]interface{}, source string) error {
 	return nil
 }
 
+// formatValue 把点值格式化为文本，缺失的点（nil）输出为空
+func formatValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", value)
+}
+
 func (c *RtdbClient) formatLine(key string, value interface{}, meta map[string]interface{}) string {
 	format := c.config.Format
 	if format == "" {
@@ -537,34 +1351,131 @@ func (c *RtdbClient) formatLine(key string, value interface{}, meta map[string]i
 
 	result := format
 	result = strings.ReplaceAll(result, "{key}", key)
-	result = strings.ReplaceAll(result, "{value}", fmt.Sprintf("%v", value))
+	result = strings.ReplaceAll(result, "{value}", formatValue(value))
 	result = strings.ReplaceAll(result, "{quality}", fmt.Sprintf("%d", quality))
 	result = strings.ReplaceAll(result, "{timestamp}", fmt.Sprintf("%d", timestamp))
 
 	return result
 }
 
+// mqttPublishTimeout 是单条报文等待 Broker 确认的上限，Broker 卡住时不阻塞采集与停止
+const mqttPublishTimeout = 10 * time.Second
+
 type MqttClient struct {
 	config    *MqttConfig
 	client    mqtt.Client
 	vm        *otto.Otto
+	jsMu      sync.Mutex
 	connected bool
+
+	mu            sync.Mutex
+	status        ConnectionStatus
+	subscriptions map[string]mqttSubscription
+	onStateChange func(connected bool, err error)
+
+	sparkplug *sparkplugState
+}
+
+type mqttSubscription struct {
+	qos     byte
+	handler mqtt.MessageHandler
 }
 
 func NewMqttClient(config *MqttConfig) *MqttClient {
 	c := &MqttClient{
-		config: config,
+		config:        config,
+		subscriptions: make(map[string]mqttSubscription),
 	}
 	// 预创建 JS 引擎（仅在配置了 js_transform 时），避免每条消息重复创建
 	if config != nil && config.JsTransform != "" {
 		c.vm = otto.New()
 	}
+	if config != nil && config.Format == "sparkplug_b" {
+		c.sparkplug = newSparkplugState(config)
+	}
 	return c
 }
 
+func (c *MqttClient) brokerURL() string {
+	return mqttBrokerURL(c.config)
+}
+
+// mqttBrokerURL 拼出 paho 使用的 broker 地址；broker 已是完整 URL 时原样使用
+func mqttBrokerURL(config *MqttConfig) string {
+	if strings.Contains(config.Broker, "://") {
+		return config.Broker
+	}
+	scheme := strings.ToLower(config.Protocol)
+	if scheme == "" {
+		scheme = "tcp"
+	}
+	addr := net.JoinHostPort(config.Broker, strconv.Itoa(config.Port))
+	if scheme == "ws" || scheme == "wss" {
+		path := config.WsPath
+		if path == "" {
+			path = "/mqtt"
+		}
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		return scheme + "://" + addr + path
+	}
+	return scheme + "://" + addr
+}
+
+// mqttTlsConfig 按配置构造 TLS 参数（私有 CA、双向认证客户端证书、SNI）。
+// 非加密连接且未配置任何 TLS 选项时返回 nil。
+func mqttTlsConfig(config *MqttConfig) (*tls.Config, error) {
+	broker := strings.ToLower(mqttBrokerURL(config))
+	secure := strings.HasPrefix(broker, "ssl://") || strings.HasPrefix(broker, "tls://") ||
+		strings.HasPrefix(broker, "mqtts://") || strings.HasPrefix(broker, "wss://")
+	if !secure && config.TlsCaFile == "" && config.TlsCertFile == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.TlsInsecureSkipVerify,
+		ServerName:         config.TlsServerName,
+	}
+
+	if config.TlsCaFile != "" {
+		pem, err := os.ReadFile(config.TlsCaFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取CA证书失败: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA证书格式无效: %s", config.TlsCaFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.TlsCertFile != "" || config.TlsKeyFile != "" {
+		if config.TlsCertFile == "" || config.TlsKeyFile == "" {
+			return nil, fmt.Errorf("客户端证书和私钥需同时配置")
+		}
+		cert, err := tls.LoadX509KeyPair(config.TlsCertFile, config.TlsKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载客户端证书失败: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// OnStateChange 注册连接状态回调（连接建立 / 断开），用于日志和事件上报
+func (c *MqttClient) OnStateChange(fn func(connected bool, err error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onStateChange = fn
+}
+
+// Connect 建立 MQTT 连接。Broker 不可达时不会返回错误，而是由 paho 在后台持续重试，
+// 连接成功后自动恢复订阅；运行中断线同样由 paho 自动重连。
 func (c *MqttClient) Connect() error {
 	opts := mqtt.NewClientOptions()
-	broker := fmt.Sprintf("tcp://%s:%d", c.config.Broker, c.config.Port)
+	broker := c.brokerURL()
 	opts.AddBroker(broker)
 	opts.SetClientID(c.config.ClientId)
 
@@ -576,23 +1487,148 @@ func (c *MqttClient) Connect() error {
 		opts.SetPassword(c.config.Password)
 	}
 
+	tlsConfig, err := mqttTlsConfig(c.config)
+	if err != nil {
+		return fmt.Errorf("MQTT TLS配置错误: %v", err)
+	}
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
+	}
+
 	// 设置 QoS 和 Retain
 	opts.SetCleanSession(true)
 
+	// 断线重连：首次连接失败也持续重试，重连间隔最长 30s
+	opts.SetAutoReconnect(true)
+	opts.SetConnectRetry(true)
+	opts.SetConnectRetryInterval(5 * time.Second)
+	opts.SetMaxReconnectInterval(30 * time.Second)
+	opts.SetConnectTimeout(10 * time.Second)
+	opts.SetKeepAlive(30 * time.Second)
+	opts.SetOnConnectHandler(c.handleConnect)
+	opts.SetConnectionLostHandler(c.handleConnectionLost)
+	opts.SetReconnectingHandler(func(_ mqtt.Client, options *mqtt.ClientOptions) {
+		log.Printf("MQTT正在重连 %s ...", broker)
+		// paho 每次重连尝试前调用，此时修改的遗嘱会用于本次 CONNECT
+		if c.sparkplug != nil {
+			options.WillPayload = c.sparkplug.renewBdSeq()
+		}
+	})
+
+	// Sparkplug B：NDEATH 作为遗嘱，订阅 NCMD 以响应主站的 Rebirth 请求
+	if c.sparkplug != nil {
+		opts.SetBinaryWill(c.sparkplug.nodeTopic("NDEATH"), c.sparkplug.deathPayload(), 1, false)
+		c.Subscribe(c.sparkplug.nodeTopic("NCMD"), 1, func(client mqtt.Client, msg mqtt.Message) {
+			if isSparkplugRebirth(msg.Payload()) {
+				log.Println("Sparkplug收到Rebirth请求，重新发送NBIRTH")
+				// 消息回调运行在 paho 的路由协程中，在这里等待发布完成会阻塞后续消息
+				go c.publishSparkplugBirth()
+			}
+		})
+	}
+
 	// 创建客户端
 	c.client = mqtt.NewClient(opts)
 
-	// 连接
+	// 连接：开启 ConnectRetry 后 token 只在连接成功时完成，这里最多等待 5s
 	token := c.client.Connect()
-	if token.Wait() && token.Error() != nil {
+	if !token.WaitTimeout(5 * time.Second) {
+		log.Printf("⚠️ MQTT暂未连接到 %s，将在后台重试", broker)
+		return nil
+	}
+	if token.Error() != nil {
 		return fmt.Errorf("MQTT连接失败: %v", token.Error())
 	}
+	return nil
+}
 
+func (c *MqttClient) handleConnect(client mqtt.Client) {
+	c.mu.Lock()
+	if c.status.LastConnectTime != "" {
+		c.status.Reconnects++
+	}
 	c.connected = true
-	log.Printf("✅ MQTT已连接到 %s", broker)
+	c.status.LastConnectTime = time.Now().Format(time.RFC3339)
+	subs := make(map[string]mqttSubscription, len(c.subscriptions))
+	for topic, sub := range c.subscriptions {
+		subs[topic] = sub
+	}
+	notify := c.onStateChange
+	c.mu.Unlock()
+
+	log.Printf("✅ MQTT已连接到 %s", c.brokerURL())
+
+	// CleanSession 下重连后服务端不保留订阅，需要逐一恢复
+	for topic, sub := range subs {
+		token := client.Subscribe(topic, sub.qos, sub.handler)
+		if token.WaitTimeout(5*time.Second) && token.Error() != nil {
+			log.Printf("MQTT恢复订阅失败 %s: %v", topic, token.Error())
+		}
+	}
+
+	if c.sparkplug != nil {
+		c.publishSparkplugBirth()
+	}
+
+	if notify != nil {
+		notify(true, nil)
+	}
+}
+
+// publishSparkplugBirth 发布 NBIRTH；各设备的 DBIRTH 随下一批数据补发
+func (c *MqttClient) publishSparkplugBirth() {
+	c.sparkplug.publishMu.Lock()
+	defer c.sparkplug.publishMu.Unlock()
+
+	birth := c.sparkplug.nodeBirth()
+	token := c.client.Publish(birth.Topic, 0, false, birth.Payload)
+	if token.WaitTimeout(5*time.Second) && token.Error() != nil {
+		log.Printf("Sparkplug NBIRTH发布失败: %v", token.Error())
+		c.sparkplug.reset()
+	}
+}
+
+func (c *MqttClient) handleConnectionLost(client mqtt.Client, err error) {
+	c.mu.Lock()
+	c.connected = false
+	c.status.LastError = err.Error()
+	c.status.LastErrorTime = time.Now().Format(time.RFC3339)
+	c.status.LastDisconnectTime = c.status.LastErrorTime
+	notify := c.onStateChange
+	c.mu.Unlock()
+
+	log.Printf("⚠️ MQTT连接断开，自动重连中: %v", err)
+	if notify != nil {
+		notify(false, err)
+	}
+}
+
+// Subscribe 订阅主题并登记，断线重连后自动恢复
+func (c *MqttClient) Subscribe(topic string, qos byte, handler mqtt.MessageHandler) error {
+	c.mu.Lock()
+	c.subscriptions[topic] = mqttSubscription{qos: qos, handler: handler}
+	c.mu.Unlock()
+
+	if !c.IsConnected() {
+		return nil
+	}
+	token := c.client.Subscribe(topic, qos, handler)
+	if token.WaitTimeout(5*time.Second) && token.Error() != nil {
+		return fmt.Errorf("MQTT订阅失败: %v", token.Error())
+	}
 	return nil
 }
 
+// Status 返回连接健康状态快照
+func (c *MqttClient) Status() ConnectionStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := c.status
+	status.Connected = c.client != nil && c.client.IsConnected()
+	status.Address = c.brokerURL()
+	return status
+}
+
 func (c *MqttClient) IsConnected() bool {
 	if c.client == nil {
 		return false
@@ -600,51 +1636,72 @@ func (c *MqttClient) IsConnected() bool {
 	return c.client.IsConnected()
 }
 
+// mqttMessage 是一条待发布的报文及其目标主题；Keys 为报文包含的点，整批报文为 nil
+type mqttMessage struct {
+	Topic   string
+	Payload string
+	Keys    []string
+}
+
 // renderPayloads 依据 format / js_transform / split 配置，把一批数据渲染成若干条待发布报文。
-func (c *MqttClient) renderPayloads(message map[string]interface{}) ([]string, error) {
+// 主题支持 {source}、{key} 占位符；含 {key} 时每点单独一条报文，便于按点订阅和按点保留最新值。
+func (c *MqttClient) renderPayloads(message map[string]interface{}, source string) ([]mqttMessage, error) {
 	format := c.config.Format
+	perKey := strings.Contains(c.config.Topic, "{key}")
+	values, _ := message["values"].(map[string]interface{})
+	metadata := messageMetadata(message)
 
-	// full（或空）：整包 JSON，保持原有行为不变
-	if format == "" || format == "full" {
-		b, err := json.Marshal(message)
-		if err != nil {
-			return nil, fmt.Errorf("JSON序列化失败: %v", err)
-		}
-		return []string{string(b)}, nil
+	// sparkplug_b：主题由 Sparkplug 命名空间决定，不使用 topic 配置
+	if format == "sparkplug_b" && c.sparkplug != nil {
+		return c.sparkplug.render(values, metadata, source), nil
+	}
+
+	// 按 key 排序，保证输出顺序确定
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
 	}
+	sort.Strings(keys)
 
-	// flat：仅 values 映射
-	if format == "flat" {
-		if values, ok := message["values"].(map[string]interface{}); ok {
-			b, err := json.Marshal(values)
+	// full（或空）/ flat：整包 JSON，主题按数据源渲染；主题含 {key} 时拆成每点一包
+	if format == "" || format == "full" || format == "flat" {
+		if !perKey {
+			body := interface{}(message)
+			if format == "flat" && values != nil {
+				body = values
+			}
+			b, err := json.Marshal(body)
 			if err != nil {
 				return nil, fmt.Errorf("JSON序列化失败: %v", err)
 			}
-			return []string{string(b)}, nil
+			return []mqttMessage{{Topic: renderTopic(c.config.Topic, source, ""), Payload: string(b)}}, nil
 		}
-		b, err := json.Marshal(message)
-		if err != nil {
-			return nil, fmt.Errorf("JSON序列化失败: %v", err)
+
+		messages := make([]mqttMessage, 0, len(keys))
+		for _, key := range keys {
+			var body interface{} = map[string]interface{}{key: values[key]}
+			if format != "flat" {
+				body = map[string]interface{}{
+					"timestamp": message["timestamp"],
+					"values":    map[string]interface{}{key: values[key]},
+					"metadata":  map[string]map[string]interface{}{key: metadata[key]},
+				}
+			}
+			b, err := json.Marshal(body)
+			if err != nil {
+				return nil, fmt.Errorf("JSON序列化失败: %v", err)
+			}
+			messages = append(messages, mqttMessage{Topic: renderTopic(c.config.Topic, source, key), Payload: string(b), Keys: []string{key}})
 		}
-		return []string{string(b)}, nil
+		return messages, nil
 	}
 
 	// 自定义模板 / js_transform：逐点渲染
-	values, _ := message["values"].(map[string]interface{})
-	metadata, _ := message["metadata"].(map[string]interface{})
-
-	// 按 key 排序，保证输出顺序确定
-	keys := make([]string, 0, len(values))
-	for k := range values {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-
-	payloads := make([]string, 0, len(keys))
+	payloads := make([]mqttMessage, 0, len(keys))
 	for _, key := range keys {
 		quality := 192
 		timestamp := time.Now().UnixMilli()
-		if meta, ok := metadata[key].(map[string]interface{}); ok {
+		if meta := metadata[key]; meta != nil {
 			if q, ok := meta["quality"].(int); ok {
 				quality = q
 			}
@@ -661,23 +1718,57 @@ func (c *MqttClient) renderPayloads(message map[string]interface{}) ([]string, e
 			s = renderTemplate(format, key, values[key], quality, timestamp)
 		}
 		if err != nil {
+			if c.config.JsTransform != "" {
+				metricJsErrors.Inc()
+			}
 			return nil, err
 		}
-		payloads = append(payloads, s)
+		payloads = append(payloads, mqttMessage{Topic: renderTopic(c.config.Topic, source, key), Payload: s, Keys: []string{key}})
 	}
 
-	// 扇出：split=true 时每点一条报文；否则合并为一包（默认）
-	if c.config.Split {
+	// 扇出：split=true 或主题按点区分时每点一条报文；否则合并为一包（默认）
+	if c.config.Split || perKey {
 		return payloads, nil
 	}
-	return []string{strings.Join(payloads, "\n")}, nil
+	lines := make([]string, len(payloads))
+	for i, p := range payloads {
+		lines[i] = p.Payload
+	}
+	return []mqttMessage{{Topic: renderTopic(c.config.Topic, source, ""), Payload: strings.Join(lines, "\n")}}, nil
+}
+
+// messageMetadata 取出报文中的 metadata（兼容 map[string]map[string]interface{} 与 JSON 解码后的 map[string]interface{}）
+func messageMetadata(message map[string]interface{}) map[string]map[string]interface{} {
+	switch m := message["metadata"].(type) {
+	case map[string]map[string]interface{}:
+		return m
+	case map[string]interface{}:
+		result := make(map[string]map[string]interface{}, len(m))
+		for k, v := range m {
+			if meta, ok := v.(map[string]interface{}); ok {
+				result[k] = meta
+			}
+		}
+		return result
+	}
+	return map[string]map[string]interface{}{}
+}
+
+// renderTopic 渲染主题模板；占位符中的 MQTT 通配符（+ #）替换为下划线，数据源为空时使用 default
+func renderTopic(template, source, key string) string {
+	if source == "" {
+		source = "default"
+	}
+	sanitize := strings.NewReplacer("+", "_", "#", "_")
+	result := strings.ReplaceAll(template, "{source}", sanitize.Replace(source))
+	return strings.ReplaceAll(result, "{key}", sanitize.Replace(key))
 }
 
 // renderTemplate 按占位符替换渲染单行（与 RTDB 的 formatLine 保持同一套占位符）
 func renderTemplate(format, key string, value interface{}, quality int, timestamp int64) string {
 	result := format
 	result = strings.ReplaceAll(result, "{key}", key)
-	result = strings.ReplaceAll(result, "{value}", fmt.Sprintf("%v", value))
+	result = strings.ReplaceAll(result, "{value}", formatValue(value))
 	result = strings.ReplaceAll(result, "{quality}", fmt.Sprintf("%d", quality))
 	result = strings.ReplaceAll(result, "{timestamp}", fmt.Sprintf("%d", timestamp))
 	return result
@@ -689,6 +1780,9 @@ func (c *MqttClient) applyJsTransform(key string, value interface{}, quality int
 	if c.vm == nil {
 		return "", fmt.Errorf("js_transform 需要引入 github.com/robertkrimen/otto 依赖（当前构建未包含）")
 	}
+	// otto 虚拟机不是并发安全的，多个任务与缓冲补发可能同时发布
+	c.jsMu.Lock()
+	defer c.jsMu.Unlock()
 	input := map[string]interface{}{
 		"key":       key,
 		"value":     value,
@@ -723,35 +1817,78 @@ func (c *MqttClient) Publish(message map[string]interface{}, source string) erro
 		return fmt.Errorf("MQTT未连接")
 	}
 
-	payloads, err := c.renderPayloads(message)
+	qos, retain := byte(c.config.Qos), c.config.Retain
+	if c.sparkplug != nil {
+		// Sparkplug 要求数据报文 QoS 0 且不保留；持锁保证 seq 顺序与发布顺序一致
+		qos, retain = 0, false
+		c.sparkplug.publishMu.Lock()
+		defer c.sparkplug.publishMu.Unlock()
+	}
+
+	payloads, err := c.renderPayloads(message, source)
 	if err != nil {
 		return err
 	}
 
-	qos := byte(c.config.Qos)
-	for _, payload := range payloads {
-		token := c.client.Publish(c.config.Topic, qos, c.config.Retain, payload)
-		if token.Wait() && token.Error() != nil {
-			log.Printf("MQTT发布失败 [数据源:%s]: %v", source, token.Error())
-			return token.Error()
+	for i, payload := range payloads {
+		token := c.client.Publish(payload.Topic, qos, retain, payload.Payload)
+		if err := waitToken(token); err != nil {
+			log.Printf("MQTT发布失败 [数据源:%s]: %v", source, err)
+			if c.sparkplug != nil {
+				c.sparkplug.reset()
+			}
+			return unsentPayloads(payloads, i, err)
 		}
 	}
 
-	log.Printf("📤 MQTT发布成功 [数据源:%s] topic=%s 条数=%d", source, c.config.Topic, len(payloads))
+	if len(payloads) == 0 {
+		return nil
+	}
+	// 按点拆分或 Sparkplug 出生报文时有多条报文，只记录第一条的主题
+	topic := payloads[0].Topic
+	if len(payloads) > 1 {
+		topic = fmt.Sprintf("%s 等 %d 条报文", topic, len(payloads))
+	}
+	log.Printf("📤 MQTT发布成功 [数据源:%s] topic=%s", source, topic)
 	return nil
 }
 
+// waitToken 等待发布确认，超时按失败处理
+func waitToken(token mqtt.Token) error {
+	if !token.WaitTimeout(mqttPublishTimeout) {
+		return fmt.Errorf("MQTT发布超时 (%v)", mqttPublishTimeout)
+	}
+	return token.Error()
+}
+
+// PublishRaw 以配置的 QoS 发布一条不保留的报文（报警等非采集数据）
+func (c *MqttClient) PublishRaw(topic string, payload []byte) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("MQTT未连接")
+	}
+	return waitToken(c.client.Publish(topic, byte(c.config.Qos), false, payload))
+}
+
 func (c *MqttClient) Disconnect() {
-	if c.client != nil && c.client.IsConnected() {
+	// 未连接时同样需要 Disconnect，以终止后台的连接重试
+	if c.client != nil {
+		if c.sparkplug != nil && c.client.IsConnected() {
+			// 正常退出时主动发布 NDEATH（遗嘱只在异常断线时由 Broker 代发）
+			token := c.client.Publish(c.sparkplug.nodeTopic("NDEATH"), 1, false, string(c.sparkplug.deathPayload()))
+			token.WaitTimeout(2 * time.Second)
+		}
 		c.client.Disconnect(250)
+		c.mu.Lock()
 		c.connected = false
+		c.mu.Unlock()
 		log.Println("📴 MQTT已断开连接")
 	}
 }
 
-// HttpClient HTTP客户端
+// HttpClient HTTP客户端；simulator 非空时为模拟数据源，不发起请求
 type HttpClient struct {
-	config *HttpConfig
+	config    *HttpConfig
+	simulator *Simulator
 }
 
 func NewHttpClient(config *HttpConfig) *HttpClient {
@@ -793,11 +1930,23 @@ func (c *HttpClient) Send(message map[string]interface{}) {
 	log.Printf("HTTP发送成功: %s (状态码: %d)", c.config.Url, resp.StatusCode)
 }
 
-func (c *Collector) fetchFromHttp(client *HttpClient) ([]map[string]interface{}, error) {
+func (c *Collector) fetchFromHttp(client *HttpClient) (result []map[string]interface{}, err error) {
 	if client.config == nil || !client.config.Enabled {
 		return nil, fmt.Errorf("HTTP未启用")
 	}
 
+	start := time.Now()
+	defer func() {
+		observeSince(metricFetchDuration, start, client.config.Name)
+		if err != nil {
+			metricFetchErrors.Inc(client.config.Name)
+		}
+	}()
+
+	if client.simulator != nil {
+		return client.simulator.Sample(time.Now()), nil
+	}
+
 	httpClient := &http.Client{
 		Timeout: time.Duration(client.config.Timeout) * time.Millisecond,
 	}
@@ -814,9 +1963,10 @@ func (c *Collector) fetchFromHttp(client *HttpClient) ([]map[string]interface{},
 	}
 
 	var apiResp struct {
-		Success bool                   `json:"success"`
-		Data    map[string]interface{} `json:"data"`
-		Message string                 `json:"message"`
+		Success  bool                              `json:"success"`
+		Data     interface{}                       `json:"data"`
+		Metadata map[string]map[string]interface{} `json:"metadata"`
+		Message  string                            `json:"message"`
 	}
 	if err := json.Unmarshal(body, &apiResp); err != nil {
 		return nil, fmt.Errorf("解析JSON失败: %v", err)
@@ -826,15 +1976,54 @@ func (c *Collector) fetchFromHttp(client *HttpClient) ([]map[string]interface{},
 		return nil, fmt.Errorf("API返回错误: %s", apiResp.Message)
 	}
 
+	return parseSourceData(apiResp.Data, apiResp.Metadata), nil
+}
+
+// parseSourceData 解析 /api/data 的 data 字段，兼容三种形式：
+//   - {key: value}，点级信息可放在同级 metadata 中
+//   - 批量键值对 {batch_id, timestamp, data: {key: value}, metadata: {key: {quality, timestamp, data_type}}}
+//   - 点列表 [{key, value, quality, timestamp, data_type}]（或 {data: [...]} 批量形式）
+func parseSourceData(data interface{}, metadata map[string]map[string]interface{}) []map[string]interface{} {
 	var result []map[string]interface{}
-	for key, value := range apiResp.Data {
-		result = append(result, map[string]interface{}{
-			"topic":     key,
-			"value":     value,
-			"quality":   192,
-			"errorCode": 0,
-		})
+	switch d := data.(type) {
+	case []interface{}:
+		for _, entry := range d {
+			v, ok := entry.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			key := v["key"]
+			if key == nil {
+				key = v["node_id"]
+			}
+			result = append(result, sourceItem(key, v["value"], v))
+		}
+	case map[string]interface{}:
+		_, isBatch := d["batch_id"]
+		if inner, ok := d["data"]; ok && (isBatch || d["metadata"] != nil) {
+			innerMeta := metadata
+			if m, ok := d["metadata"].(map[string]interface{}); ok {
+				innerMeta = make(map[string]map[string]interface{}, len(m))
+				for k, v := range m {
+					if meta, ok := v.(map[string]interface{}); ok {
+						innerMeta[k] = meta
+					}
+				}
+			}
+			items := parseSourceData(inner, innerMeta)
+			// 点级 timestamp 缺失时使用批次 timestamp（与 SSE 报文头 ts 一致）
+			if batchTs, ok := parseSourceTime(d["timestamp"]); ok {
+				for _, item := range items {
+					if _, ok := item["timestamp"]; !ok {
+						item["timestamp"] = batchTs
+					}
+				}
+			}
+			return items
+		}
+		for key, value := range d {
+			result = append(result, sourceItem(key, value, metadata[key]))
+		}
 	}
-
-	return result, nil
+	return result
 }
@@ -0,0 +1,610 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testMessage 构造与 processAndPublish 输出一致的一批数据
+func testMessage() map[string]interface{} {
+	return map[string]interface{}{
+		"timestamp": "2026-01-02T03:04:05+08:00",
+		"values":    map[string]interface{}{"b": "off", "a": 1.5},
+		"metadata": map[string]map[string]interface{}{
+			"a": {"quality": 192, "timestamp": int64(1700000000000)},
+			"b": {"quality": 0, "timestamp": int64(1700000001000)},
+		},
+	}
+}
+
+func topicsOf(messages []mqttMessage) []string {
+	topics := make([]string, len(messages))
+	for i, m := range messages {
+		topics[i] = m.Topic
+	}
+	return topics
+}
+
+func TestRenderPayloads(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   MqttConfig
+		source   string
+		topics   []string
+		payloads []string
+	}{
+		{
+			name:     "full",
+			config:   MqttConfig{Topic: "plant/{source}"},
+			source:   "line1",
+			topics:   []string{"plant/line1"},
+			payloads: []string{`{"metadata":{"a":{"quality":192,"timestamp":1700000000000},"b":{"quality":0,"timestamp":1700000001000}},"timestamp":"2026-01-02T03:04:05+08:00","values":{"a":1.5,"b":"off"}}`},
+		},
+		{
+			name:     "flat",
+			config:   MqttConfig{Topic: "plant/{source}", Format: "flat"},
+			source:   "",
+			topics:   []string{"plant/default"},
+			payloads: []string{`{"a":1.5,"b":"off"}`},
+		},
+		{
+			name:     "flat按key拆分",
+			config:   MqttConfig{Topic: "plant/{source}/{key}", Format: "flat"},
+			source:   "line#1",
+			topics:   []string{"plant/line_1/a", "plant/line_1/b"},
+			payloads: []string{`{"a":1.5}`, `{"b":"off"}`},
+		},
+		{
+			name:   "full按key拆分",
+			config: MqttConfig{Topic: "plant/{key}"},
+			source: "line1",
+			topics: []string{"plant/a", "plant/b"},
+			payloads: []string{
+				`{"metadata":{"a":{"quality":192,"timestamp":1700000000000}},"timestamp":"2026-01-02T03:04:05+08:00","values":{"a":1.5}}`,
+				`{"metadata":{"b":{"quality":0,"timestamp":1700000001000}},"timestamp":"2026-01-02T03:04:05+08:00","values":{"b":"off"}}`,
+			},
+		},
+		{
+			name:     "自定义模板合并",
+			config:   MqttConfig{Topic: "plant/{source}", Format: "{key}={value}@{quality}/{timestamp}"},
+			source:   "line1",
+			topics:   []string{"plant/line1"},
+			payloads: []string{"a=1.5@192/1700000000000\nb=off@0/1700000001000"},
+		},
+		{
+			name:     "自定义模板split",
+			config:   MqttConfig{Topic: "plant/{source}", Format: "{key},{value}", Split: true},
+			source:   "line1",
+			topics:   []string{"plant/line1", "plant/line1"},
+			payloads: []string{"a,1.5", "b,off"},
+		},
+		{
+			name:     "js_transform",
+			config:   MqttConfig{Topic: "js/{key}", Format: "js", JsTransform: "({k: point.key, v: point.value, q: point.quality})"},
+			source:   "line1",
+			topics:   []string{"js/a", "js/b"},
+			payloads: []string{`{"k":"a","q":192,"v":1.5}`, `{"k":"b","q":0,"v":"off"}`},
+		},
+		{
+			name:     "js_transform返回字符串",
+			config:   MqttConfig{Topic: "js/{source}", Format: "js", JsTransform: "point.key + '|' + point.quality"},
+			source:   "line1",
+			topics:   []string{"js/line1"},
+			payloads: []string{"a|192\nb|0"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := NewMqttClient(&tc.config)
+			messages, err := client.renderPayloads(testMessage(), tc.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := topicsOf(messages); !reflect.DeepEqual(got, tc.topics) {
+				t.Errorf("主题 = %v, want %v", got, tc.topics)
+			}
+			for i := range messages {
+				if i < len(tc.payloads) && messages[i].Payload != tc.payloads[i] {
+					t.Errorf("报文[%d] = %s, want %s", i, messages[i].Payload, tc.payloads[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRenderPayloadsJsError(t *testing.T) {
+	client := NewMqttClient(&MqttConfig{Topic: "t", Format: "js", JsTransform: "point.missing.field"})
+	if _, err := client.renderPayloads(testMessage(), "line1"); err == nil {
+		t.Error("脚本出错时应返回错误")
+	}
+}
+
+func TestRenderPayloadsSparkplug(t *testing.T) {
+	client := NewMqttClient(&MqttConfig{Format: "sparkplug_b", SparkplugGroupId: "g1", SparkplugEdgeNodeId: "n1"})
+
+	first, err := client.renderPayloads(testMessage(), "line1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"spBv1.0/g1/NBIRTH/n1", "spBv1.0/g1/DBIRTH/n1/line1"}
+	if got := topicsOf(first); !reflect.DeepEqual(got, want) {
+		t.Errorf("首批主题 = %v, want %v", got, want)
+	}
+
+	second, _ := client.renderPayloads(testMessage(), "line1")
+	if got := topicsOf(second); !reflect.DeepEqual(got, []string{"spBv1.0/g1/DDATA/n1/line1"}) {
+		t.Errorf("第二批主题 = %v", got)
+	}
+
+	// 出现新点时设备重新出生
+	message := testMessage()
+	message["values"].(map[string]interface{})["c"] = 3.0
+	third, _ := client.renderPayloads(message, "line1")
+	if got := topicsOf(third); !reflect.DeepEqual(got, []string{"spBv1.0/g1/DBIRTH/n1/line1"}) {
+		t.Errorf("新增点后主题 = %v", got)
+	}
+}
+
+func TestSparkplugRenewBdSeq(t *testing.T) {
+	state := newSparkplugState(&MqttConfig{})
+	first := state.bdSeq
+	if will := state.renewBdSeq(); len(will) == 0 {
+		t.Fatal("遗嘱报文为空")
+	}
+	// 重连后的 NBIRTH 与新遗嘱使用同一个 bdSeq
+	if state.bdSeq == first {
+		t.Errorf("重连后 bdSeq 应递增，仍为 %d", first)
+	}
+	if next := newSparkplugState(&MqttConfig{}).bdSeq; next != (state.bdSeq+1)%256 {
+		t.Errorf("新客户端 bdSeq = %d，应接着 %d 递增", next, state.bdSeq)
+	}
+}
+
+func TestRtdbFormatLine(t *testing.T) {
+	meta := map[string]interface{}{"quality": 64, "timestamp": int64(1700000000000)}
+	cases := []struct {
+		name   string
+		format string
+		value  interface{}
+		meta   map[string]interface{}
+		want   string
+	}{
+		{"默认格式", "", 12.5, meta, "k1,12.5,64,1700000000000"},
+		{"自定义格式", "{key}={value};q={quality}", true, meta, "k1=true;q=64"},
+		{"缺失值输出为空", "", nil, map[string]interface{}{"quality": 0, "timestamp": int64(1)}, "k1,,0,1"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := NewRtdbClient(&RtdbConfig{Format: tc.format})
+			if got := client.formatLine("k1", tc.value, tc.meta); got != tc.want {
+				t.Errorf("formatLine = %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	// 没有元数据时质量默认 192，时间戳取当前时间
+	before := time.Now().UnixMilli()
+	line := NewRtdbClient(&RtdbConfig{}).formatLine("k1", 1, nil)
+	var ts int64
+	if _, err := fmt.Sscanf(line, "k1,1,192,%d", &ts); err != nil || ts < before {
+		t.Errorf("formatLine 默认值 = %q", line)
+	}
+}
+
+// startTestCollector 在临时目录中启动采集器（transform*.json 按相对路径读取），测试结束时停止
+func startTestCollector(t *testing.T, config *AppConfig) *Collector {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	collector := NewCollector(config)
+	if err := collector.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { collector.Stop() })
+	return collector
+}
+
+func testTask(source string, tags ...*TagMapping) *TaskConfig {
+	return &TaskConfig{Enabled: true, HttpSource: source, JobIntervalSecond: 1, Tags: tags}
+}
+
+func linePrefix(prefix string) func(string) bool {
+	return func(line string) bool { return strings.HasPrefix(line, prefix) }
+}
+
+func TestDeliverRecoversSinkError(t *testing.T) {
+	collector := NewCollector(&AppConfig{})
+	var events []Event
+	collector.events.Subscribe(func(e Event) {
+		if e.Type == EventRtdbError {
+			events = append(events, e)
+		}
+	})
+
+	failed := func(map[string]interface{}, string) error { return fmt.Errorf("写入超时") }
+	sent := func(map[string]interface{}, string) error { return nil }
+	collector.deliver("RTDB", nil, true, failed, testMessage(), "line1")
+	collector.deliver("RTDB", nil, true, sent, testMessage(), "line1")
+	if len(events) != 2 || events[0].Severity != SeverityError || events[1].Severity != SeverityRecovered || events[1].Subject != events[0].Subject {
+		t.Errorf("发送事件 = %+v", events)
+	}
+}
+
+func TestAlarmPublishQueue(t *testing.T) {
+	broker := newFakeBroker(t)
+	collector := startTestCollector(t, &AppConfig{
+		MqttConfig: &MqttConfig{Enabled: true, Broker: "127.0.0.1", Port: broker.port(), Topic: "plant/{source}", ClientId: "test-alarm", AlarmTopic: "alarm/{source}/{key}"},
+	})
+	waitFor(t, 5*time.Second, "MQTT连接", func() bool { return collector.snapshot().mqttClient.IsConnected() })
+
+	// 报警报文由独立协程发布，onAlarm 只负责入队
+	collector.onAlarm(Alarm{Id: "a1", Source: "line1", Key: "a", Message: "a 高报"}, AlarmRaised)
+	m := broker.waitMessage(t, "alarm/line1/a", nil)
+	if !strings.Contains(m.Payload, `"event":"raised"`) {
+		t.Errorf("报警报文 = %s", m.Payload)
+	}
+
+	// 队列满时丢弃新报文而不阻塞调用方
+	mqttConfig := &MqttConfig{AlarmTopic: "alarm"}
+	stopped := NewCollector(&AppConfig{MqttConfig: mqttConfig})
+	for i := 0; i < alarmQueueSize; i++ {
+		stopped.alarmQueue <- alarmPublish{}
+	}
+	stopped.mqttClient = NewMqttClient(mqttConfig)
+	stopped.onAlarm(Alarm{Id: "a2"}, AlarmRaised)
+	if len(stopped.alarmQueue) != alarmQueueSize {
+		t.Errorf("队列长度 = %d", len(stopped.alarmQueue))
+	}
+}
+
+func TestStrictMissingTags(t *testing.T) {
+	task := testTask("line1", &TagMapping{OpcTag: "A", DbName: "a"}, &TagMapping{OpcTag: "B", DbName: "b"})
+	task.Strict = true
+	config := &AppConfig{Tasks: []*TaskConfig{task}}
+	item := func(key string, value interface{}) map[string]interface{} {
+		return map[string]interface{}{"topic": key, "value": value, "quality": 192}
+	}
+	quality := func(collector *Collector, key string) int {
+		found := collector.values.Find(key)
+		if len(found) != 1 {
+			return -1
+		}
+		return found[0].Quality
+	}
+
+	// 轮询结果是全量数据，缺失的点以坏质量上报
+	polling := NewCollector(config)
+	newTaskRunner("task1", task, config).processAndPublish(polling, []map[string]interface{}{item("A", 1)}, true)
+	if quality(polling, "a") != 192 || quality(polling, "b") != 0 {
+		t.Errorf("轮询 quality a=%d b=%d", quality(polling, "a"), quality(polling, "b"))
+	}
+
+	// SSE 只推送变化量，缺失的点不立即上报
+	collector := NewCollector(config)
+	runner := newTaskRunner("task1", task, config)
+	runner.resetStale(time.Now().Add(-time.Minute))
+	runner.processAndPublish(collector, []map[string]interface{}{item("A", 1)}, false)
+	if quality(collector, "b") != -1 {
+		t.Errorf("SSE 变化量中缺失的点不应上报，得到 quality=%d", quality(collector, "b"))
+	}
+
+	// 超时未更新的点以坏质量上报一次
+	runner.checkStale(collector, time.Now())
+	if quality(collector, "a") != 192 || quality(collector, "b") != 0 || !runner.stale["B"] {
+		t.Errorf("超时后 quality a=%d b=%d", quality(collector, "a"), quality(collector, "b"))
+	}
+	runner.checkStale(collector, time.Now().Add(time.Minute))
+	if !runner.stale["A"] || quality(collector, "a") != 0 {
+		t.Errorf("A 超时后 quality=%d", quality(collector, "a"))
+	}
+
+	// 重新收到更新后恢复
+	runner.processAndPublish(collector, []map[string]interface{}{item("B", 2)}, false)
+	if quality(collector, "b") != 192 || runner.stale["B"] {
+		t.Errorf("恢复后 quality b=%d", quality(collector, "b"))
+	}
+}
+
+func TestCollectorPollingToMqttAndRtdb(t *testing.T) {
+	agent := newFakeAgent(t)
+	broker := newFakeBroker(t)
+	rtdb := newFakeRtdb(t)
+	agent.setPoints(point("Channel1.T1", 21.5), point("Channel1.T2", 7))
+
+	startTestCollector(t, &AppConfig{
+		HttpConfigs: []*HttpConfig{{Name: "line1", Enabled: true, Url: agent.url("/api/data"), Timeout: 2000}},
+		MqttConfig:  &MqttConfig{Enabled: true, Broker: "127.0.0.1", Port: broker.port(), Topic: "plant/{source}", ClientId: "test-polling"},
+		RtdbConfig:  &RtdbConfig{Enabled: true, Host: "127.0.0.1", Port: rtdb.port()},
+		Tasks:       []*TaskConfig{testTask("line1", &TagMapping{OpcTag: "Channel1.T1", DbName: "t1"})},
+	})
+
+	msg := broker.waitMessage(t, "plant/line1", nil)
+	var body struct {
+		Values map[string]interface{} `json:"values"`
+	}
+	if err := json.Unmarshal([]byte(msg.Payload), &body); err != nil {
+		t.Fatalf("MQTT报文不是JSON: %s", msg.Payload)
+	}
+	// 映射的点使用 db_name，未映射的点保留原始 key
+	want := map[string]interface{}{"t1": 21.5, "Channel1.T2": 7.0}
+	if !reflect.DeepEqual(body.Values, want) {
+		t.Errorf("MQTT values = %v, want %v", body.Values, want)
+	}
+
+	rtdb.waitLine(t, "t1", linePrefix("t1,21.5,192,"))
+	rtdb.waitLine(t, "Channel1.T2", linePrefix("Channel1.T2,7,192,"))
+}
+
+func TestCollectorPollingSourceError(t *testing.T) {
+	agent := newFakeAgent(t)
+	rtdb := newFakeRtdb(t)
+	agent.setFailData(true)
+
+	collector := startTestCollector(t, &AppConfig{
+		HttpConfigs: []*HttpConfig{{Name: "line1", Enabled: true, Url: agent.url("/api/data"), Timeout: 2000}},
+		RtdbConfig:  &RtdbConfig{Enabled: true, Host: "127.0.0.1", Port: rtdb.port()},
+		Tasks:       []*TaskConfig{testTask("line1")},
+	})
+
+	events := make(chan Event, 16)
+	collector.events.Subscribe(func(e Event) {
+		if e.Type == EventHttpError {
+			select {
+			case events <- e:
+			default:
+			}
+		}
+	})
+
+	select {
+	case e := <-events:
+		if e.Severity != SeverityError || e.Subject != "line1" {
+			t.Errorf("事件 = %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("数据源报错时应发出 http_error 事件")
+	}
+
+	agent.setFailData(false)
+	agent.setPoints(point("A", 1))
+	rtdb.waitLine(t, "A", linePrefix("A,1,192,"))
+}
+
+func TestCollectorSseReconnect(t *testing.T) {
+	agent := newFakeAgent(t)
+	rtdb := newFakeRtdb(t)
+
+	startTestCollector(t, &AppConfig{
+		HttpConfigs: []*HttpConfig{{Name: "line1", Enabled: true, Url: agent.url("/api/stream")}},
+		RtdbConfig:  &RtdbConfig{Enabled: true, Host: "127.0.0.1", Port: rtdb.port()},
+		Tasks:       []*TaskConfig{testTask("line1", &TagMapping{OpcTag: "A", DbName: "a"})},
+	})
+
+	waitFor(t, 5*time.Second, "SSE连接", func() bool { return agent.activeStreams() == 1 })
+	agent.push(point("A", 1))
+	rtdb.waitLine(t, "首次推送", linePrefix("a,1,192,"))
+
+	// 代理关闭连接后，采集器应按退避重连并继续处理推送
+	agent.dropStreams()
+	waitFor(t, 10*time.Second, "SSE重连", func() bool { return agent.connects() == 2 && agent.activeStreams() == 1 })
+	agent.push(point("A", 2))
+	rtdb.waitLine(t, "重连后推送", linePrefix("a,2,192,"))
+}
+
+func TestCollectorReload(t *testing.T) {
+	agent := newFakeAgent(t)
+	rtdb := newFakeRtdb(t)
+	config := func(dbName string) *AppConfig {
+		return &AppConfig{
+			HttpConfigs: []*HttpConfig{{Name: "line1", Enabled: true, Url: agent.url("/api/stream")}},
+			RtdbConfig:  &RtdbConfig{Enabled: true, Host: "127.0.0.1", Port: rtdb.port()},
+			Tasks:       []*TaskConfig{testTask("line1", &TagMapping{OpcTag: "A", DbName: dbName})},
+		}
+	}
+	collector := startTestCollector(t, config("a1"))
+
+	waitFor(t, 5*time.Second, "SSE连接", func() bool { return agent.activeStreams() == 1 })
+	agent.push(point("A", 1))
+	rtdb.waitLine(t, "热加载前", linePrefix("a1,1,"))
+
+	collector.Reload(config("a2"))
+
+	// 旧的订阅连接必须断开，只剩新任务的一条连接
+	waitFor(t, 5*time.Second, "热加载后重新订阅", func() bool { return agent.connects() == 2 && agent.activeStreams() == 1 })
+	waitFor(t, 5*time.Second, "RTDB重新连接", func() bool {
+		rtdb.mu.Lock()
+		defer rtdb.mu.Unlock()
+		return rtdb.accepts >= 2
+	})
+	agent.push(point("A", 2))
+	rtdb.waitLine(t, "热加载后", linePrefix("a2,2,"))
+
+	for _, line := range rtdb.received() {
+		if strings.HasPrefix(line, "a1,2,") {
+			t.Errorf("热加载后仍按旧映射输出: %s", line)
+		}
+	}
+	collector.mu.Lock()
+	runners := collector.runners
+	collector.mu.Unlock()
+	if len(runners) != 1 || runners[0].task.Tags[0].DbName != "a2" {
+		t.Errorf("任务未按新配置重建")
+	}
+}
+
+func TestCollectorReloadDuringSseBackoff(t *testing.T) {
+	var attempts atomic.Int32
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(down.Close)
+
+	config := &AppConfig{
+		HttpConfigs: []*HttpConfig{{Name: "line1", Enabled: true, Url: down.URL + "/api/stream"}},
+		Tasks:       []*TaskConfig{testTask("line1")},
+	}
+	collector := startTestCollector(t, config)
+
+	// 第三次失败后进入 4s 的退避
+	waitFor(t, 10*time.Second, "SSE重试", func() bool { return attempts.Load() >= 3 })
+	start := time.Now()
+	collector.Reload(config)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("数据源不可用时热加载耗时 %v", elapsed)
+	}
+}
+
+func TestParseSourceTime(t *testing.T) {
+	local := func(year int, month time.Month, day, hour, min, sec, nsec int) int64 {
+		return time.Date(year, month, day, hour, min, sec, nsec, time.Local).UnixMilli()
+	}
+	cases := []struct {
+		name  string
+		value interface{}
+		want  int64
+		ok    bool
+	}{
+		{name: "数值毫秒", value: float64(1700000000000), want: 1700000000000, ok: true},
+		{name: "int64 毫秒", value: int64(1700000000123), want: 1700000000123, ok: true},
+		{name: "数值 0", value: float64(0), ok: false},
+		{name: "/Date(ms)/", value: "/Date(1700000000000)/", want: 1700000000000, ok: true},
+		{name: "/Date(ms+时区)/", value: "/Date(1700000000000+0800)/", want: 1700000000000, ok: true},
+		{name: "/Date 无法解析", value: "/Date(abc)/", ok: false},
+		{name: "RFC3339 UTC", value: "2024-01-02T03:04:05Z", want: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).UnixMilli(), ok: true},
+		{name: "RFC3339 7 位小数带时区", value: "2024-01-02T11:04:05.1234567+08:00", want: time.Date(2024, 1, 2, 3, 4, 5, 123000000, time.UTC).UnixMilli(), ok: true},
+		{name: "不带时区按本地时间", value: "2024-01-02T03:04:05.1234567", want: local(2024, 1, 2, 3, 4, 5, 123000000), ok: true},
+		{name: "空格分隔不带时区", value: " 2024-01-02 03:04:05 ", want: local(2024, 1, 2, 3, 4, 5, 0), ok: true},
+		{name: "斜杠日期", value: "2024/01/02 03:04:05", want: local(2024, 1, 2, 3, 4, 5, 0), ok: true},
+		{name: "DateTime.MinValue", value: "0001-01-01T00:00:00", ok: false},
+		{name: "空字符串", value: "", ok: false},
+		{name: "无法解析", value: "yesterday", ok: false},
+		{name: "nil", value: nil, ok: false},
+	}
+	for _, c := range cases {
+		got, ok := parseSourceTime(c.value)
+		if ok != c.ok || got != c.want {
+			t.Errorf("%s: parseSourceTime(%#v) = %d, %v; want %d, %v", c.name, c.value, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestParseSourceData(t *testing.T) {
+	batchTs := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).UnixMilli()
+	cases := []struct {
+		name     string
+		data     string
+		metadata map[string]map[string]interface{}
+		want     []map[string]interface{}
+	}{
+		{
+			name: "键值对与同级 metadata",
+			data: `{"A": 1.5, "B": "on"}`,
+			metadata: map[string]map[string]interface{}{
+				"A": {"quality": "Bad", "timestamp": "/Date(1700000000000)/", "data_type": "Double"},
+			},
+			want: []map[string]interface{}{
+				{"topic": "A", "value": 1.5, "quality": 0, "timestamp": int64(1700000000000), "data_type": "Double"},
+				{"topic": "B", "value": "on", "quality": 192},
+			},
+		},
+		{
+			name: "批量键值对：批次 timestamp 补齐缺失的点级时间",
+			data: `{"batch_id": "b1", "timestamp": "2024-01-02T03:04:05Z", "data": {"A": 1, "B": 2},
+				"metadata": {"A": {"quality": 64, "timestamp": 1700000000000}, "B": {"status": "Good"}}}`,
+			want: []map[string]interface{}{
+				{"topic": "A", "value": 1.0, "quality": 64, "timestamp": int64(1700000000000)},
+				{"topic": "B", "value": 2.0, "quality": 192, "timestamp": batchTs},
+			},
+		},
+		{
+			name: "批量键值对：批次 metadata 优先于同级 metadata",
+			data: `{"batch_id": "b1", "data": {"A": 1}, "metadata": {"A": {"quality": "Uncertain"}}}`,
+			metadata: map[string]map[string]interface{}{
+				"A": {"quality": "Good", "timestamp": 1700000000000.0},
+			},
+			want: []map[string]interface{}{
+				{"topic": "A", "value": 1.0, "quality": 64},
+			},
+		},
+		{
+			name: "点列表",
+			data: `[{"key": "A", "value": 1, "quality": "Good", "timestamp": "2024-01-02T03:04:05Z", "data_type": "Int32"},
+				{"node_id": "B", "value": true, "status": "Uncertain"}, "无效"]`,
+			want: []map[string]interface{}{
+				{"topic": "A", "value": 1.0, "quality": 192, "timestamp": batchTs, "data_type": "Int32"},
+				{"topic": "B", "value": true, "quality": 64},
+			},
+		},
+		{
+			name: "批量点列表",
+			data: `{"batch_id": 7, "timestamp": "/Date(1700000000000)/", "data": [{"key": "A", "value": 1}, {"key": "B", "value": 2, "timestamp": 1700000005000}]}`,
+			want: []map[string]interface{}{
+				{"topic": "A", "value": 1.0, "quality": 192, "timestamp": int64(1700000000000)},
+				{"topic": "B", "value": 2.0, "quality": 192, "timestamp": int64(1700000005000)},
+			},
+		},
+		{
+			name: "没有 batch_id 与 metadata 的 data 视为点名",
+			data: `{"data": 1, "timestamp": "2024-01-02T03:04:05Z"}`,
+			want: []map[string]interface{}{
+				{"topic": "data", "value": 1.0, "quality": 192},
+				{"topic": "timestamp", "value": "2024-01-02T03:04:05Z", "quality": 192},
+			},
+		},
+	}
+	for _, c := range cases {
+		var data interface{}
+		if err := json.Unmarshal([]byte(c.data), &data); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		got := parseSourceData(data, c.metadata)
+		sort.Slice(got, func(i, j int) bool { return fmt.Sprint(got[i]["topic"]) < fmt.Sprint(got[j]["topic"]) })
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s:\n got  %v\n want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestSourceTimestampFallback(t *testing.T) {
+	for _, source := range []string{"", TimestampSourceSource, TimestampSourceCollector} {
+		task := testTask("line1", &TagMapping{OpcTag: "A", DbName: "a"}, &TagMapping{OpcTag: "B", DbName: "b"})
+		task.TimestampSource = source
+		config := &AppConfig{Tasks: []*TaskConfig{task}}
+		collector := NewCollector(config)
+
+		before := time.Now().UnixMilli()
+		newTaskRunner("task1", task, config).processAndPublish(collector, []map[string]interface{}{
+			{"topic": "A", "value": 1, "quality": 192, "timestamp": int64(1700000000000)},
+			{"topic": "B", "value": 2, "quality": 192},
+		}, true)
+		after := time.Now().UnixMilli()
+
+		timestamp := func(key string) int64 {
+			found := collector.values.Find(key)
+			if len(found) != 1 {
+				t.Fatalf("timestamp_source=%q: 未发布 %s", source, key)
+			}
+			return found[0].Timestamp
+		}
+		// 默认使用数据源时间，collector 时统一使用采集时间；未提供时间戳的点回退为采集时间
+		a := timestamp("a")
+		if source == TimestampSourceCollector {
+			if a < before || a > after {
+				t.Errorf("timestamp_source=%q: a = %d, want [%d, %d]", source, a, before, after)
+			}
+		} else if a != 1700000000000 {
+			t.Errorf("timestamp_source=%q: a = %d", source, a)
+		}
+		if b := timestamp("b"); b < before || b > after {
+			t.Errorf("timestamp_source=%q: b = %d, want [%d, %d]", source, b, before, after)
+		}
+	}
+}
@@ -6,9 +6,12 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/eclipse/paho.mqtt.golang/packets"
 	"github.com/gorilla/mux"
 )
 
@@ -43,19 +46,32 @@ func (ws *WebServer) Start(port int) error {
 	r.HandleFunc("/web/rtdb", ws.handleRtdbPage).Methods("GET")
 	r.HandleFunc("/web/transform", ws.handleTransformPage).Methods("GET")
 	r.HandleFunc("/web/tasks", ws.handleTasksPage).Methods("GET")
+	r.HandleFunc("/web/status", ws.handleStatusPage).Methods("GET")
+	r.HandleFunc("/web/values", ws.handleValuesPage).Methods("GET")
+	r.HandleFunc("/web/alarms", ws.handleAlarmsPage).Methods("GET")
 
 	// API接口
 	r.HandleFunc("/api/config", ws.handleGetConfig).Methods("GET")
 	r.HandleFunc("/api/config", ws.handleUpdateConfig).Methods("POST")
 	r.HandleFunc("/api/config/validate", ws.handleValidateConfig).Methods("POST")
 	r.HandleFunc("/api/mqtt/test", ws.handleMqttTest).Methods("POST")
+	r.HandleFunc("/api/mqtt/status", ws.handleMqttStatus).Methods("GET")
 	r.HandleFunc("/api/rtdb/test", ws.handleRtdbTest).Methods("POST")
+	r.HandleFunc("/api/rtdb/status", ws.handleRtdbStatus).Methods("GET")
 	r.HandleFunc("/api/http/test", ws.handleHttpTest).Methods("POST")
 	r.HandleFunc("/api/transform/preview", ws.handleTransformPreview).Methods("POST")
 	r.HandleFunc("/api/transform/rules", ws.handleGetTransformRules).Methods("GET")
 	r.HandleFunc("/api/transform/rules", ws.handleUpdateTransformRules).Methods("POST")
 	r.HandleFunc("/api/transform/debug", ws.handleTransformDebug).Methods("GET")
+	r.HandleFunc("/api/transform/reverse", ws.handleTransformReverse).Methods("POST")
 	r.HandleFunc("/api/webhook/test", ws.handleWebhookTest).Methods("POST")
+	r.HandleFunc("/api/email/test", ws.handleEmailTest).Methods("POST")
+	r.HandleFunc("/api/status", ws.handleStatus).Methods("GET")
+	r.HandleFunc("/api/values", ws.handleValues).Methods("GET")
+	r.HandleFunc("/api/live", ws.handleLive).Methods("GET")
+	r.HandleFunc("/api/alarms", ws.handleAlarms).Methods("GET")
+	r.HandleFunc("/api/alarms/ack", ws.handleAlarmAck).Methods("POST")
+	r.HandleFunc("/metrics", ws.handleMetrics).Methods("GET")
 
 	addr := fmt.Sprintf(":%d", port)
 	fmt.Printf("Web服务器启动在 http://localhost%s\n", addr)
@@ -111,7 +127,19 @@ func (ws *WebServer) handleHome(w http.ResponseWriter, r *http.Request) {
             </a>
             <a href="/web/monitor" class="menu-item">
                 <h3>🔔 监控配置</h3>
-                <p>配置Webhook预警</p>
+                <p>配置Webhook/邮件预警</p>
+            </a>
+            <a href="/web/status" class="menu-item">
+                <h3>📊 运行状态</h3>
+                <p>查看任务与输出端实时状态</p>
+            </a>
+            <a href="/web/values" class="menu-item">
+                <h3>🔍 最新值</h3>
+                <p>查询各点最近一次发布的值</p>
+            </a>
+            <a href="/web/alarms" class="menu-item">
+                <h3>🚨 报警</h3>
+                <p>查看与确认点位报警</p>
             </a>
         </div>
 
@@ -131,6 +159,365 @@ func (ws *WebServer) handleHome(w http.ResponseWriter, r *http.Request) {
 	ws.renderHTML(w, tmpl)
 }
 
+func (ws *WebServer) handleStatusPage(w http.ResponseWriter, r *http.Request) {
+	tmpl := `
+<!DOCTYPE html>
+<html>
+<head>
+    <title>运行状态 - OPC DA Collector</title>
+    <meta charset="UTF-8">
+    <style>
+        body { font-family: Arial, sans-serif; margin: 20px; background: #f5f5f5; }
+        .container { max-width: 1200px; margin: 0 auto; background: white; padding: 20px; border-radius: 8px; }
+        h1 { color: #333; }
+        h2 { color: #555; font-size: 18px; margin-top: 25px; }
+        table { width: 100%; border-collapse: collapse; font-size: 14px; }
+        th, td { border: 1px solid #ddd; padding: 8px; text-align: left; }
+        th { background: #f0f0f0; }
+        .back { background: #666; border: 2px solid #333; color: white; padding: 8px 16px; text-decoration: none; border-radius: 4px; display: inline-block; }
+        .back:hover { background: #555; }
+        .success { color: green; font-weight: bold; }
+        .error { color: red; font-weight: bold; }
+        .muted { color: #999; }
+        .summary { background: #e3f2fd; padding: 12px; border-radius: 6px; border-left: 4px solid #2196F3; margin-top: 15px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <a href="/" class="back">← 返回首页</a>
+        <h1>📊 运行状态</h1>
+        <div class="summary" id="summary">加载中...</div>
+
+        <h2>采集任务</h2>
+        <table>
+            <thead>
+                <tr><th>任务</th><th>数据源</th><th>状态</th><th>模式</th><th>最近采集</th><th>点/秒</th><th>累计读取 / 发布</th><th>最近错误</th></tr>
+            </thead>
+            <tbody id="tasks"></tbody>
+        </table>
+
+        <h2>输出端</h2>
+        <table>
+            <thead>
+                <tr><th>输出端</th><th>连接</th><th>地址</th><th>重连次数</th><th>最近连接</th><th>缓冲积压</th><th>最近错误</th></tr>
+            </thead>
+            <tbody id="sinks"></tbody>
+        </table>
+    </div>
+
+    <script>
+        function esc(s) {
+            return String(s == null ? '' : s).replace(/[&<>"]/g, c => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;' }[c]));
+        }
+
+        function formatUptime(seconds) {
+            const d = Math.floor(seconds / 86400), h = Math.floor(seconds % 86400 / 3600), m = Math.floor(seconds % 3600 / 60);
+            return (d ? d + '天' : '') + h + '小时' + m + '分';
+        }
+
+        function sinkRow(name, s, buffer) {
+            if (!s) return '<tr><td>' + name + '</td><td colspan="6" class="muted">未启用</td></tr>';
+            return '<tr><td>' + name + '</td>' +
+                '<td>' + (s.connected ? '<span class="success">已连接</span>' : '<span class="error">未连接</span>') + '</td>' +
+                '<td>' + esc(s.address) + '</td>' +
+                '<td>' + s.reconnects + '</td>' +
+                '<td>' + esc(s.last_connect_time || '-') + '</td>' +
+                '<td>' + (buffer ? buffer.batches + ' 批 / ' + buffer.bytes + ' 字节' : '-') + '</td>' +
+                '<td>' + (s.last_error ? esc(s.last_error) + ' (' + esc(s.last_error_time) + ')' : '-') + '</td></tr>';
+        }
+
+        async function loadStatus() {
+            try {
+                const response = await fetch('/api/status');
+                const result = await response.json();
+                if (!result.success) {
+                    document.getElementById('summary').innerHTML = '<span class="error">' + esc(result.message) + '</span>';
+                    return;
+                }
+                const s = result.data;
+                document.getElementById('summary').innerHTML =
+                    '采集器: ' + (s.running ? '<span class="success">运行中</span>' : '<span class="error">已停止</span>') +
+                    (s.start_time ? ' | 启动时间: ' + esc(s.start_time) + ' | 已运行: ' + formatUptime(s.uptime_seconds) : '') +
+                    ' | 任务数: ' + s.tasks.length;
+
+                const tasks = s.tasks.map(t => '<tr>' +
+                    '<td>' + esc(t.name) + '</td>' +
+                    '<td>' + esc(t.http_source || '全部') + '</td>' +
+                    '<td>' + (t.running ? '<span class="success">运行中</span>' : '<span class="muted">已停止</span>') + '</td>' +
+                    '<td>' + (t.mode === 'sse' ? 'SSE推送 ' + (t.sse_connected ? '<span class="success">已连接</span>' : '<span class="error">未连接</span>') : '定时轮询') + '</td>' +
+                    '<td>' + esc(t.last_collect_time || '-') + '</td>' +
+                    '<td>' + t.points_per_second.toFixed(1) + '</td>' +
+                    '<td>' + t.points_total + ' / ' + t.published_total + '</td>' +
+                    '<td>' + (t.last_error ? esc(t.last_error) + ' (' + esc(t.last_error_time) + ')' : '-') + '</td></tr>');
+                document.getElementById('tasks').innerHTML = tasks.join('') || '<tr><td colspan="8" class="muted">没有运行中的任务</td></tr>';
+
+                const buffers = s.buffers || {};
+                document.getElementById('sinks').innerHTML = sinkRow('MQTT', s.mqtt, buffers.mqtt) + sinkRow('RTDB', s.rtdb, buffers.rtdb);
+            } catch (e) {
+                document.getElementById('summary').innerHTML = '<span class="error">获取状态失败: ' + esc(e.message) + '</span>';
+            }
+        }
+
+        loadStatus();
+        setInterval(loadStatus, 5000);
+    </script>
+</body>
+</html>
+	`
+	ws.renderHTML(w, tmpl)
+}
+
+func (ws *WebServer) handleValuesPage(w http.ResponseWriter, r *http.Request) {
+	tmpl := `
+<!DOCTYPE html>
+<html>
+<head>
+    <title>最新值 - OPC DA Collector</title>
+    <meta charset="UTF-8">
+    <style>
+        body { font-family: Arial, sans-serif; margin: 20px; background: #f5f5f5; }
+        .container { max-width: 1200px; margin: 0 auto; background: white; padding: 20px; border-radius: 8px; }
+        h1 { color: #333; }
+        .filters { display: flex; gap: 10px; flex-wrap: wrap; align-items: flex-end; margin: 15px 0; }
+        .filters label { display: block; font-size: 13px; color: #555; margin-bottom: 4px; font-weight: bold; }
+        .filters input, .filters select { padding: 6px; border: 1px solid #ddd; border-radius: 4px; }
+        button { background: #4CAF50; color: white; padding: 7px 16px; border: none; border-radius: 4px; cursor: pointer; }
+        button:hover { background: #45a049; }
+        button:disabled { background: #ccc; cursor: default; }
+        table { width: 100%; border-collapse: collapse; font-size: 14px; }
+        th, td { border: 1px solid #ddd; padding: 6px 8px; text-align: left; }
+        th { background: #f0f0f0; }
+        .back { background: #666; border: 2px solid #333; color: white; padding: 8px 16px; text-decoration: none; border-radius: 4px; display: inline-block; }
+        .back:hover { background: #555; }
+        .bad { color: red; }
+        .muted { color: #999; }
+        .pager { margin-top: 10px; display: flex; gap: 10px; align-items: center; }
+        .changed { background: #fff8c4; transition: background 1s; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <a href="/" class="back">← 返回首页</a>
+        <h1>🔍 最新值</h1>
+        <p>每个点最近一次发布到输出端的值（按变化上报时未变化的点保持上次的值）</p>
+
+        <div class="filters">
+            <div><label>任务</label><select id="task"><option value="">全部</option></select></div>
+            <div><label>数据源</label><select id="source"><option value="">全部</option></select></div>
+            <div><label>键名前缀</label><input type="text" id="prefix" placeholder="例：20251_M41"></div>
+            <div><label>关键字</label><input type="text" id="search" placeholder="匹配发布键或原始点名"></div>
+            <div><label><input type="checkbox" id="auto" checked> 自动刷新</label></div>
+            <div><label><input type="checkbox" id="live" onchange="toggleLive()"> 实时推送</label></div>
+            <button onclick="page = 0; loadValues()">查询</button>
+        </div>
+
+        <table>
+            <thead>
+                <tr><th>发布键</th><th>原始点名</th><th>值</th><th>质量</th><th>数据时间</th><th>发布时间</th><th>任务</th><th>数据源</th></tr>
+            </thead>
+            <tbody id="values"></tbody>
+        </table>
+        <div class="pager">
+            <button id="prev" onclick="page--; loadValues()">上一页</button>
+            <span id="pageInfo"></span>
+            <button id="next" onclick="page++; loadValues()">下一页</button>
+        </div>
+    </div>
+
+    <script>
+        const pageSize = 100;
+        let page = 0;
+
+        function esc(s) {
+            return String(s == null ? '' : s).replace(/[&<>"]/g, c => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;' }[c]));
+        }
+
+        async function loadFilters() {
+            const resp = await fetch('/api/config');
+            const data = await resp.json();
+            if (!data.success) return;
+            const taskSelect = document.getElementById('task');
+            (data.data.tasks || []).forEach((t, i) => {
+                const opt = document.createElement('option');
+                opt.value = 'task' + (i + 1);
+                opt.textContent = '任务' + (i + 1) + (t.http_source ? ' (' + t.http_source + ')' : '');
+                taskSelect.appendChild(opt);
+            });
+            const sourceSelect = document.getElementById('source');
+            (data.data.http_configs || []).forEach(c => {
+                const opt = document.createElement('option');
+                opt.value = c.name;
+                opt.textContent = c.name;
+                sourceSelect.appendChild(opt);
+            });
+        }
+
+        async function loadValues() {
+            const params = new URLSearchParams({
+                task: document.getElementById('task').value,
+                source: document.getElementById('source').value,
+                prefix: document.getElementById('prefix').value,
+                q: document.getElementById('search').value,
+                offset: page * pageSize,
+                limit: pageSize
+            });
+            const resp = await fetch('/api/values?' + params);
+            const result = await resp.json();
+            const tbody = document.getElementById('values');
+            if (!result.success) {
+                tbody.innerHTML = '<tr><td colspan="8" class="muted">' + esc(result.message) + '</td></tr>';
+                return;
+            }
+            const p = result.data;
+            tbody.innerHTML = p.items.map(v => '<tr data-id="' + esc(v.task + '|' + v.key) + '">' +
+                '<td>' + esc(v.key) + '</td>' +
+                '<td>' + esc(v.orig_key) + '</td>' +
+                '<td class="val">' + esc(JSON.stringify(v.value)) + (v.unit ? ' ' + esc(v.unit) : '') + '</td>' +
+                '<td class="q' + (v.quality === 192 ? '' : ' bad') + '">' + v.quality + '</td>' +
+                '<td class="ts">' + (v.timestamp ? new Date(v.timestamp).toLocaleString() : '-') + '</td>' +
+                '<td class="pt">' + esc(v.publish_time) + '</td>' +
+                '<td>' + esc(v.task) + '</td>' +
+                '<td>' + esc(v.source) + '</td></tr>').join('') || '<tr><td colspan="8" class="muted">暂无数据</td></tr>';
+            const pages = Math.max(1, Math.ceil(p.total / pageSize));
+            document.getElementById('pageInfo').textContent = '第 ' + (page + 1) + ' / ' + pages + ' 页，共 ' + p.total + ' 个点';
+            document.getElementById('prev').disabled = page <= 0;
+            document.getElementById('next').disabled = page + 1 >= pages;
+        }
+
+        // 实时推送：订阅 /api/live，只更新当前页中已显示的点
+        let liveSource = null;
+        function toggleLive() {
+            if (liveSource) {
+                liveSource.close();
+                liveSource = null;
+            }
+            if (!document.getElementById('live').checked) return;
+            document.getElementById('auto').checked = false;
+            const params = new URLSearchParams({
+                task: document.getElementById('task').value,
+                source: document.getElementById('source').value,
+                prefix: document.getElementById('prefix').value
+            });
+            liveSource = new EventSource('/api/live?' + params);
+            liveSource.onmessage = e => {
+                const batch = JSON.parse(e.data);
+                Object.keys(batch.values).forEach(key => {
+                    const row = document.querySelector('tr[data-id="' + CSS.escape(batch.task + '|' + key) + '"]');
+                    if (!row) return;
+                    const meta = (batch.metadata || {})[key] || {};
+                    row.querySelector('.val').textContent = JSON.stringify(batch.values[key]) + (meta.unit ? ' ' + meta.unit : '');
+                    row.querySelector('.q').textContent = meta.quality;
+                    row.querySelector('.q').className = 'q' + (meta.quality === 192 ? '' : ' bad');
+                    row.querySelector('.ts').textContent = meta.timestamp ? new Date(meta.timestamp).toLocaleString() : '-';
+                    row.querySelector('.pt').textContent = batch.timestamp;
+                    row.classList.add('changed');
+                    setTimeout(() => row.classList.remove('changed'), 1000);
+                });
+            };
+        }
+
+        loadFilters().then(loadValues);
+        setInterval(() => { if (document.getElementById('auto').checked) loadValues(); }, 5000);
+    </script>
+</body>
+</html>
+	`
+	ws.renderHTML(w, tmpl)
+}
+
+func (ws *WebServer) handleAlarmsPage(w http.ResponseWriter, r *http.Request) {
+	tmpl := `
+<!DOCTYPE html>
+<html>
+<head>
+    <title>报警 - OPC DA Collector</title>
+    <meta charset="UTF-8">
+    <style>
+        body { font-family: Arial, sans-serif; margin: 20px; background: #f5f5f5; }
+        .container { max-width: 1200px; margin: 0 auto; background: white; padding: 20px; border-radius: 8px; }
+        h1 { color: #333; }
+        button { background: #4CAF50; color: white; padding: 5px 12px; border: none; border-radius: 4px; cursor: pointer; }
+        button:hover { background: #45a049; }
+        table { width: 100%; border-collapse: collapse; font-size: 14px; margin-top: 10px; }
+        th, td { border: 1px solid #ddd; padding: 6px 8px; text-align: left; }
+        th { background: #f0f0f0; }
+        .back { background: #666; border: 2px solid #333; color: white; padding: 8px 16px; text-decoration: none; border-radius: 4px; display: inline-block; }
+        .back:hover { background: #555; }
+        .summary { display: flex; gap: 20px; align-items: center; margin: 10px 0; }
+        .active td { background: #ffebee; }
+        .active.acked td { background: #fff8e1; }
+        .muted { color: #999; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <a href="/" class="back">← 返回首页</a>
+        <h1>🚨 报警</h1>
+        <p>显示激活中和已解除但未确认的报警；报警规则在任务的点配置中设置（tag_alarm_*）</p>
+
+        <div class="summary">
+            <span id="summary"></span>
+            <button onclick="ack('')">全部确认</button>
+        </div>
+
+        <table>
+            <thead>
+                <tr><th>状态</th><th>发布键</th><th>条件</th><th>说明</th><th>触发时间</th><th>解除时间</th><th>确认时间</th><th>任务</th><th></th></tr>
+            </thead>
+            <tbody id="alarms"></tbody>
+        </table>
+    </div>
+
+    <script>
+        const conditionNames = { hihi: '高高限', hi: '高限', lo: '低限', lolo: '低低限', roc: '变化率', bad_quality: '坏质量', stale: '僵值' };
+
+        function esc(s) {
+            return String(s == null ? '' : s).replace(/[&<>"]/g, c => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;' }[c]));
+        }
+
+        async function loadAlarms() {
+            const resp = await fetch('/api/alarms');
+            const result = await resp.json();
+            const tbody = document.getElementById('alarms');
+            if (!result.success) {
+                tbody.innerHTML = '<tr><td colspan="9" class="muted">' + esc(result.message) + '</td></tr>';
+                return;
+            }
+            const list = result.data;
+            document.getElementById('summary').textContent = '激活 ' + list.active + ' 条，未确认 ' + list.unacknowledged + ' 条';
+            tbody.innerHTML = list.items.map(a => '<tr class="' + (a.active ? 'active' : '') + (a.acknowledged ? ' acked' : '') + '">' +
+                '<td>' + (a.active ? '激活' : '已解除') + ' / ' + (a.acknowledged ? '已确认' : '未确认') + '</td>' +
+                '<td>' + esc(a.key) + '</td>' +
+                '<td>' + esc(conditionNames[a.condition] || a.condition) + '</td>' +
+                '<td>' + esc(a.message) + '</td>' +
+                '<td>' + esc(a.active_time) + '</td>' +
+                '<td>' + esc(a.clear_time || '-') + '</td>' +
+                '<td>' + esc(a.ack_time || '-') + '</td>' +
+                '<td>' + esc(a.task) + '</td>' +
+                '<td>' + (a.acknowledged ? '' : '<button data-id="' + esc(a.id) + '" onclick="ack(this.dataset.id)">确认</button>') + '</td></tr>').join('') ||
+                '<tr><td colspan="9" class="muted">暂无报警</td></tr>';
+        }
+
+        async function ack(id) {
+            const resp = await fetch('/api/alarms/ack', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify(id ? { id } : { all: true })
+            });
+            const result = await resp.json();
+            if (!result.success) alert(result.message);
+            loadAlarms();
+        }
+
+        loadAlarms();
+        setInterval(loadAlarms, 5000);
+    </script>
+</body>
+</html>
+	`
+	ws.renderHTML(w, tmpl)
+}
+
 func (ws *WebServer) handleHttpPage(w http.ResponseWriter, r *http.Request) {
 	tmpl := `
 <!DOCTYPE html>
@@ -193,9 +580,20 @@ func (ws *WebServer) handleHttpPage(w http.ResponseWriter, r *http.Request) {
                     </select>
                 </div>
                 <div class="form-group">
+                    <label>类型</label>
+                    <select id="httpType" onchange="toggleHttpType()">
+                        <option value="http">HTTP（OPC代理）</option>
+                        <option value="simulate">模拟数据（无需OPC代理）</option>
+                    </select>
+                </div>
+                <div class="form-group" id="httpUrlGroup">
                     <label>URL地址</label>
                     <input type="text" id="httpUrl" placeholder="例：http://192.168.1.100:8080/api/data">
                 </div>
+                <div class="form-group" id="httpSimGroup" style="display:none;">
+                    <label>模拟点定义文件</label>
+                    <input type="text" id="httpSimFile" placeholder="例：simulate.json，留空使用内置示例点">
+                </div>
                 <div class="form-group">
                     <label>请求方法</label>
                     <select id="httpMethod">
@@ -246,7 +644,7 @@ func (ws *WebServer) handleHttpPage(w http.ResponseWriter, r *http.Request) {
                 card.innerHTML =
                     '<div class="http-name">' + (config.name || '数据源' + (index+1)) + ' <span class="badge ' + (config.enabled ? 'badge-on' : 'badge-off') + '">' + (config.enabled ? '启用' : '禁用') + '</span></div>' +
                     '<div class="http-info">' +
-                    'URL: ' + (config.url || '未配置') + '<br>' +
+                    (config.type === 'simulate' ? '模拟数据: ' + (config.sim_file || '内置示例点') : 'URL: ' + (config.url || '未配置')) + '<br>' +
                     '方法: ' + (config.method || 'GET') + '<br>' +
                     '超时: ' + (config.timeout || 5000) + 'ms' +
                     '</div>' +
@@ -266,20 +664,31 @@ func (ws *WebServer) handleHttpPage(w http.ResponseWriter, r *http.Request) {
                 const config = httpConfigs[index];
                 document.getElementById('httpName').value = config.name || '';
                 document.getElementById('httpEnabled').value = config.enabled ? 'true' : 'false';
+                document.getElementById('httpType').value = config.type || 'http';
                 document.getElementById('httpUrl').value = config.url || '';
+                document.getElementById('httpSimFile').value = config.sim_file || '';
                 document.getElementById('httpMethod').value = config.method || 'GET';
                 document.getElementById('httpTimeout').value = config.timeout || 5000;
             } else {
                 document.getElementById('httpName').value = '';
                 document.getElementById('httpEnabled').value = 'true';
+                document.getElementById('httpType').value = 'http';
                 document.getElementById('httpUrl').value = '';
+                document.getElementById('httpSimFile').value = '';
                 document.getElementById('httpMethod').value = 'GET';
                 document.getElementById('httpTimeout').value = 5000;
             }
 
+            toggleHttpType();
             document.getElementById('httpModal').style.display = 'block';
         }
 
+        function toggleHttpType() {
+            const simulate = document.getElementById('httpType').value === 'simulate';
+            document.getElementById('httpUrlGroup').style.display = simulate ? 'none' : 'block';
+            document.getElementById('httpSimGroup').style.display = simulate ? 'block' : 'none';
+        }
+
         function closeModal() {
             document.getElementById('httpModal').style.display = 'none';
             editingIndex = -1;
@@ -288,7 +697,8 @@ func (ws *WebServer) handleHttpPage(w http.ResponseWriter, r *http.Request) {
         async function saveHttp() {
             const name = document.getElementById('httpName').value.trim();
             const url = document.getElementById('httpUrl').value.trim();
-            if (!name || !url) {
+            const type = document.getElementById('httpType').value;
+            if (!name || (!url && type !== 'simulate')) {
                 showResult(false, '名称和URL不能为空');
                 return;
             }
@@ -297,6 +707,8 @@ func (ws *WebServer) handleHttpPage(w http.ResponseWriter, r *http.Request) {
                 name: name,
                 enabled: document.getElementById('httpEnabled').value === 'true',
                 url: url,
+                type: type === 'simulate' ? 'simulate' : '',
+                sim_file: type === 'simulate' ? document.getElementById('httpSimFile').value.trim() : '',
                 method: document.getElementById('httpMethod').value,
                 timeout: parseInt(document.getElementById('httpTimeout').value) || 5000
             };
@@ -397,6 +809,7 @@ func (ws *WebServer) handleRtdbPage(w http.ResponseWriter, r *http.Request) {
     <div class="container">
         <h1>💾 RTDB输出配置</h1>
         <a href="/" class="back">← 返回首页</a>
+        <div id="status" style="margin-top: 15px; color: #666;"></div>
 
         <form id="rtdbForm">
             <div class="form-group">
@@ -510,7 +923,25 @@ func (ws *WebServer) handleRtdbPage(w http.ResponseWriter, r *http.Request) {
             }
         }
 
+        async function loadRtdbStatus() {
+            const response = await fetch('/api/rtdb/status');
+            const result = await response.json();
+            const div = document.getElementById('status');
+            if (!result.success) {
+                div.innerHTML = '运行状态: ' + (result.message || '未知');
+                return;
+            }
+            const s = result.data;
+            let html = '运行状态: ' + (s.connected ? '<span class="success">已连接</span>' : '<span class="error">未连接</span>') + ' ' + s.address;
+            html += ' | 重连次数: ' + s.reconnects;
+            if (s.last_connect_time) html += ' | 最近连接: ' + s.last_connect_time;
+            if (s.last_error) html += '<br>最近错误: ' + s.last_error + ' (' + s.last_error_time + ')';
+            div.innerHTML = html;
+        }
+
         loadRtdb();
+        loadRtdbStatus();
+        setInterval(loadRtdbStatus, 5000);
     </script>
 </body>
 </html>
@@ -545,6 +976,7 @@ func (ws *WebServer) handleMqttPage(w http.ResponseWriter, r *http.Request) {
     <div class="container">
         <h1>📡 MQTT配置</h1>
         <a href="/" class="back">← 返回首页</a>
+        <div id="status" style="margin-top: 15px; color: #666;"></div>
 
         <form id="mqttForm">
             <div class="form-group">
@@ -554,17 +986,55 @@ func (ws *WebServer) handleMqttPage(w http.ResponseWriter, r *http.Request) {
                     <option value="true">是</option>
                 </select>
             </div>
+            <div class="form-group">
+                <label>连接协议</label>
+                <select id="protocol" name="protocol" onchange="onMqttProtocolChange()">
+                    <option value="tcp">tcp:// - 明文 (1883)</option>
+                    <option value="ssl">ssl:// - TLS加密 (8883)</option>
+                    <option value="ws">ws:// - WebSocket</option>
+                    <option value="wss">wss:// - WebSocket + TLS</option>
+                </select>
+            </div>
             <div class="form-group">
                 <label>Broker地址</label>
-                <input type="text" id="broker" name="broker" placeholder="例如: 172.16.32.98">
+                <input type="text" id="broker" name="broker" placeholder="例如: 172.16.32.98 或完整URL wss://host:443/mqtt">
             </div>
             <div class="form-group">
                 <label>端口</label>
                 <input type="number" id="port" name="port" value="1883">
             </div>
+            <div class="form-group" id="wsGroup" style="display:none;">
+                <label>WebSocket路径</label>
+                <input type="text" id="ws_path" name="ws_path" placeholder="默认: /mqtt">
+            </div>
+            <div id="tlsGroup" style="display:none;">
+                <div class="form-group">
+                    <label>CA证书文件(tls_ca_file)</label>
+                    <input type="text" id="tls_ca_file" name="tls_ca_file" placeholder="私有CA的PEM文件路径，留空使用系统根证书">
+                </div>
+                <div class="form-group">
+                    <label>客户端证书(tls_cert_file)</label>
+                    <input type="text" id="tls_cert_file" name="tls_cert_file" placeholder="双向认证时填写，PEM格式">
+                </div>
+                <div class="form-group">
+                    <label>客户端私钥(tls_key_file)</label>
+                    <input type="text" id="tls_key_file" name="tls_key_file" placeholder="双向认证时填写，PEM格式">
+                </div>
+                <div class="form-group">
+                    <label>SNI服务器名(tls_server_name)</label>
+                    <input type="text" id="tls_server_name" name="tls_server_name" placeholder="证书中的域名，留空使用Broker地址">
+                </div>
+                <div class="form-group">
+                    <label>跳过证书校验(仅测试用)</label>
+                    <select id="tls_insecure_skip_verify" name="tls_insecure_skip_verify">
+                        <option value="false">否</option>
+                        <option value="true">是</option>
+                    </select>
+                </div>
+            </div>
             <div class="form-group">
                 <label>主题(Topic)</label>
-                <input type="text" id="topic" name="topic" placeholder="例如: opc/data">
+                <input type="text" id="topic" name="topic" placeholder="例如: opc/data，支持占位符 plant/{source}/{key}">
             </div>
             <div class="form-group">
                 <label>客户端ID</label>
@@ -590,9 +1060,20 @@ func (ws *WebServer) handleMqttPage(w http.ResponseWriter, r *http.Request) {
                 <select id="format" name="format" onchange="onMqttFormatChange()">
                     <option value="full">完整格式(full)</option>
                     <option value="flat">扁平格式(flat)</option>
+                    <option value="sparkplug_b">Sparkplug B(sparkplug_b)</option>
                     <option value="custom">自定义模板</option>
                 </select>
             </div>
+            <div id="sparkplugGroup" style="display:none;">
+                <div class="form-group">
+                    <label>Sparkplug Group ID</label>
+                    <input type="text" id="sparkplug_group_id" name="sparkplug_group_id" placeholder="默认: opc">
+                </div>
+                <div class="form-group">
+                    <label>Sparkplug Edge Node ID</label>
+                    <input type="text" id="sparkplug_edge_node_id" name="sparkplug_edge_node_id" placeholder="默认使用客户端ID">
+                </div>
+            </div>
             <div class="form-group" id="mqttCustomFormatGroup" style="display:none;">
                 <label>自定义格式模板</label>
                 <textarea id="mqtt_custom_format" name="mqtt_custom_format" rows="3" placeholder="例如: {key},{value},{quality},{timestamp}"></textarea>
@@ -608,6 +1089,23 @@ func (ws *WebServer) handleMqttPage(w http.ResponseWriter, r *http.Request) {
                 <label>JS转换(js_transform, 可选)</label>
                 <textarea id="js_transform" name="js_transform" rows="3" placeholder="返回电文的JS表达式, 变量 point={key,value,quality,timestamp}"></textarea>
             </div>
+            <div class="form-group">
+                <label>报警主题(alarm_topic, 可选)</label>
+                <input type="text" id="alarm_topic" name="alarm_topic" placeholder="报警触发/解除/确认时发布，支持 {source}、{key}，例如: opc/alarm/{key}">
+            </div>
+            <div class="form-group">
+                <label>写入命令主题(command_topic, 可选)</label>
+                <input type="text" id="command_topic" name="command_topic" placeholder="订阅后把写入命令回写到OPC，仅限标记为可写的点，例如: cmd/{key}">
+            </div>
+            <div class="form-group">
+                <label>写入回执主题(command_ack_topic, 可选)</label>
+                <input type="text" id="command_ack_topic" name="command_ack_topic" placeholder="留空为命令主题加 /ack，例如: cmd/{key}/ack">
+            </div>
+
+            <div class="form-group">
+                <label>测试主题(可选)</label>
+                <input type="text" id="test_topic" name="test_topic" placeholder="填写后测试连接时会发布一条探测报文，例如: opc/test">
+            </div>
 
             <button type="button" onclick="saveMqtt()">💾 保存配置</button>
             <button type="button" class="test" onclick="testMqtt()">🧪 测试连接</button>
@@ -617,9 +1115,32 @@ func (ws *WebServer) handleMqttPage(w http.ResponseWriter, r *http.Request) {
     </div>
 
     <script>
+        function onMqttProtocolChange() {
+            const protocol = document.getElementById('protocol').value;
+            document.getElementById('wsGroup').style.display = (protocol === 'ws' || protocol === 'wss') ? 'block' : 'none';
+            document.getElementById('tlsGroup').style.display = (protocol === 'ssl' || protocol === 'wss') ? 'block' : 'none';
+        }
+
+        function readTlsFields(mqtt) {
+            mqtt.protocol = document.getElementById('protocol').value;
+            mqtt.ws_path = document.getElementById('ws_path').value;
+            mqtt.tls_ca_file = document.getElementById('tls_ca_file').value;
+            mqtt.tls_cert_file = document.getElementById('tls_cert_file').value;
+            mqtt.tls_key_file = document.getElementById('tls_key_file').value;
+            mqtt.tls_server_name = document.getElementById('tls_server_name').value;
+            mqtt.tls_insecure_skip_verify = document.getElementById('tls_insecure_skip_verify').value === 'true';
+            mqtt.sparkplug_group_id = document.getElementById('sparkplug_group_id').value;
+            mqtt.sparkplug_edge_node_id = document.getElementById('sparkplug_edge_node_id').value;
+            mqtt.alarm_topic = document.getElementById('alarm_topic').value;
+            mqtt.command_topic = document.getElementById('command_topic').value;
+            mqtt.command_ack_topic = document.getElementById('command_ack_topic').value;
+            return mqtt;
+        }
+
         function onMqttFormatChange() {
             const fmt = document.getElementById('format').value;
             document.getElementById('mqttCustomFormatGroup').style.display = (fmt === 'custom') ? 'block' : 'none';
+            document.getElementById('sparkplugGroup').style.display = (fmt === 'sparkplug_b') ? 'block' : 'none';
         }
 
         async function loadMqtt() {
@@ -635,16 +1156,28 @@ func (ws *WebServer) handleMqttPage(w http.ResponseWriter, r *http.Request) {
                 document.getElementById('qos').value = mqtt.qos?.toString() || '1';
                 document.getElementById('retain').value = mqtt.retain?.toString() || 'false';
                 const format = mqtt.format || 'full';
-                if (format === 'full' || format === 'flat') {
+                if (format === 'full' || format === 'flat' || format === 'sparkplug_b') {
                     document.getElementById('format').value = format;
-                    document.getElementById('mqttCustomFormatGroup').style.display = 'none';
                 } else {
                     document.getElementById('format').value = 'custom';
                     document.getElementById('mqtt_custom_format').value = format;
-                    document.getElementById('mqttCustomFormatGroup').style.display = 'block';
                 }
+                onMqttFormatChange();
+                document.getElementById('sparkplug_group_id').value = mqtt.sparkplug_group_id || '';
+                document.getElementById('sparkplug_edge_node_id').value = mqtt.sparkplug_edge_node_id || '';
                 document.getElementById('split').value = (mqtt.split === true).toString();
                 document.getElementById('js_transform').value = mqtt.js_transform || '';
+                document.getElementById('alarm_topic').value = mqtt.alarm_topic || '';
+                document.getElementById('command_topic').value = mqtt.command_topic || '';
+                document.getElementById('command_ack_topic').value = mqtt.command_ack_topic || '';
+                document.getElementById('protocol').value = mqtt.protocol || 'tcp';
+                document.getElementById('ws_path').value = mqtt.ws_path || '';
+                document.getElementById('tls_ca_file').value = mqtt.tls_ca_file || '';
+                document.getElementById('tls_cert_file').value = mqtt.tls_cert_file || '';
+                document.getElementById('tls_key_file').value = mqtt.tls_key_file || '';
+                document.getElementById('tls_server_name').value = mqtt.tls_server_name || '';
+                document.getElementById('tls_insecure_skip_verify').value = (mqtt.tls_insecure_skip_verify === true).toString();
+                onMqttProtocolChange();
             }
         }
 
@@ -665,6 +1198,7 @@ func (ws *WebServer) handleMqttPage(w http.ResponseWriter, r *http.Request) {
                 split: document.getElementById('split').value === 'true',
                 js_transform: document.getElementById('js_transform').value
             };
+            readTlsFields(mqtt);
 
             const response = await fetch('/api/config', {
                 method: 'POST',
@@ -685,11 +1219,15 @@ func (ws *WebServer) handleMqttPage(w http.ResponseWriter, r *http.Request) {
                 broker: document.getElementById('broker').value,
                 port: parseInt(document.getElementById('port').value),
                 client_id: document.getElementById('client_id').value,
+                qos: parseInt(document.getElementById('qos').value),
+                test_topic: document.getElementById('test_topic').value,
                 format: format,
                 split: document.getElementById('split').value === 'true',
                 js_transform: document.getElementById('js_transform').value
             };
+            readTlsFields(mqtt);
 
+            document.getElementById('result').innerHTML = '正在连接...';
             const response = await fetch('/api/mqtt/test', {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
@@ -698,6 +1236,14 @@ func (ws *WebServer) handleMqttPage(w http.ResponseWriter, r *http.Request) {
 
             const result = await response.json();
             showResult(result);
+            const d = result.data;
+            if (d) {
+                let html = '<div style="color:#666; margin-top:8px;">Broker: ' + d.broker + ' | 客户端ID: ' + d.client_id;
+                html += '<br>CONNACK: ' + d.return_code + ' ' + (d.return_message || '') + ' | 握手耗时: ' + d.connect_ms + 'ms';
+                if (d.test_topic) html += '<br>探测主题: ' + d.test_topic + ' | 发布耗时: ' + (d.publish_ms || 0) + 'ms';
+                html += '</div>';
+                document.getElementById('result').innerHTML += html;
+            }
         }
 
         function showResult(result) {
@@ -709,7 +1255,25 @@ func (ws *WebServer) handleMqttPage(w http.ResponseWriter, r *http.Request) {
             }
         }
 
+        async function loadMqttStatus() {
+            const response = await fetch('/api/mqtt/status');
+            const result = await response.json();
+            const div = document.getElementById('status');
+            if (!result.success) {
+                div.innerHTML = '运行状态: ' + (result.message || '未知');
+                return;
+            }
+            const s = result.data;
+            let html = '运行状态: ' + (s.connected ? '<span class="success">已连接</span>' : '<span class="error">未连接（后台重连中）</span>') + ' ' + s.address;
+            html += ' | 重连次数: ' + s.reconnects;
+            if (s.last_connect_time) html += ' | 最近连接: ' + s.last_connect_time;
+            if (s.last_error) html += '<br>最近断开: ' + s.last_error + ' (' + s.last_error_time + ')';
+            div.innerHTML = html;
+        }
+
         loadMqtt();
+        loadMqttStatus();
+        setInterval(loadMqttStatus, 5000);
     </script>
 </body>
 </html>
@@ -952,26 +1516,38 @@ func (ws *WebServer) handleTransformPage(w http.ResponseWriter, r *http.Request)
         }
 
         async function previewTransform() {
-            const testKeys = prompt("请输入测试键名（多个用逗号分隔）:\\n例如: lt.sc.20251_M4102_ZZT,lt.sc.20251_M4102_CYBJ");
-            if (!testKeys) return;
+            const testKeys = prompt("请输入测试键名（多个用逗号分隔，留空使用运行中任务的实际键名）:\\n例如: lt.sc.20251_M4102_ZZT,lt.sc.20251_M4102_CYBJ");
+            if (testKeys === null) return;
 
-            const keys = testKeys.split(',').map(k => k.trim());
+            const keys = testKeys.split(',').map(k => k.trim()).filter(k => k);
 
             const response = await fetch('/api/transform/preview', {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify({
+                    source: currentSource,
                     rules: rules,
-                    test_keys: keys
+                    test_keys: keys,
+                    live_keys: keys.length === 0
                 })
             });
 
             const result = await response.json();
             if (result.success) {
-                let html = '<h4>转换预览:</h4><table style="width: 100%; border-collapse: collapse;">';
+                let html = '';
+                if (result.data.collisions.length > 0) {
+                    html += '<h4 style="color: #c0392b;">⚠️ 发布键冲突 (' + result.data.collisions.length + '):</h4><table style="width: 100%; border-collapse: collapse;">';
+                    html += '<tr style="background: #fdecea;"><th style="padding: 8px; text-align: left;">发布键</th><th style="padding: 8px; text-align: left;">原始键名 → 处理结果 (' + result.data.collisions[0].policy + ')</th></tr>';
+                    for (const c of result.data.collisions) {
+                        const fates = c.origins.map(o => o + ' → ' + (c.result[o] || '丢弃')).join('<br>');
+                        html += '<tr><td style="padding: 8px; border-bottom: 1px solid #ddd;">' + c.key + '</td><td style="padding: 8px; border-bottom: 1px solid #ddd;">' + fates + '</td></tr>';
+                    }
+                    html += '</table>';
+                }
+                html += '<h4>转换预览:</h4><table style="width: 100%; border-collapse: collapse;">';
                 html += '<tr style="background: #f0f0f0;"><th style="padding: 8px; text-align: left;">原始键名</th><th style="padding: 8px; text-align: left;">转换后</th></tr>';
 
-                for (const [original, transformed] of Object.entries(result.data)) {
+                for (const [original, transformed] of Object.entries(result.data.results)) {
                     html += '<tr><td style="padding: 8px; border-bottom: 1px solid #ddd;">' + original + '</td><td style="padding: 8px; border-bottom: 1px solid #ddd;">' + transformed + '</td></tr>';
                 }
                 html += '</table>';
@@ -1061,12 +1637,82 @@ func (ws *WebServer) handleMonitorPage(w http.ResponseWriter, r *http.Request) {
             <div class="form-group">
                 <label>触发事件（逗号分隔）</label>
                 <textarea id="events" name="events" rows="3" placeholder="mqtt_error,http_error,collect_error"></textarea>
+                <small>可选事件：mqtt_error（MQTT断线/发送失败）、rtdb_error（RTDB断线/发送失败）、http_error（HTTP轮询失败）、sse_error（SSE断线）、collect_error（数据处理失败）、transform_collision（发布键冲突）、transform_error（转换规则无效）、transform_reloaded（转换规则已重新加载）、alarm（点位报警）。
+                订阅 xxx_error / alarm 时会同时收到对应的恢复事件 xxx_recovered / alarm_recovered；留空表示接收全部事件。</small>
+            </div>
+            <div class="form-group">
+                <label>重复提醒间隔（分钟）</label>
+                <input type="number" id="repeatMinutes" min="0" placeholder="10">
+                <small>同一故障持续存在时，每隔该时间最多再提醒一次</small>
+            </div>
+            <div class="form-group">
+                <label>失败重试次数</label>
+                <input type="number" id="retries" min="0" placeholder="3">
+                <small>留空使用默认 3 次，0 表示不重试</small>
             </div>
 
             <button type="button" onclick="saveWebhook()">💾 保存配置</button>
             <button type="button" class="test" onclick="testWebhook()">🧪 测试发送</button>
         </form>
 
+        <h2>📧 邮件告警</h2>
+        <form id="emailForm">
+            <div class="form-group">
+                <label>启用邮件告警</label>
+                <select id="emailEnabled">
+                    <option value="false">否</option>
+                    <option value="true">是</option>
+                </select>
+            </div>
+            <div class="form-group">
+                <label>收件人（逗号分隔）</label>
+                <input type="text" id="email" placeholder="例如: ops@example.com,admin@example.com">
+            </div>
+            <div class="form-group">
+                <label>SMTP服务器</label>
+                <input type="text" id="smtpHost" placeholder="例如: smtp.example.com">
+            </div>
+            <div class="form-group">
+                <label>端口</label>
+                <input type="number" id="smtpPort" placeholder="25 / 465 / 587">
+            </div>
+            <div class="form-group">
+                <label>加密方式</label>
+                <select id="smtpSecurity">
+                    <option value="">自动（465=SSL，其余服务器支持时STARTTLS）</option>
+                    <option value="starttls">STARTTLS</option>
+                    <option value="ssl">SSL/TLS</option>
+                    <option value="none">不加密</option>
+                </select>
+            </div>
+            <div class="form-group">
+                <label>用户名</label>
+                <input type="text" id="smtpUsername">
+            </div>
+            <div class="form-group">
+                <label>密码/授权码</label>
+                <input type="password" id="smtpPassword">
+                <small>已保存的密码不会回显，不修改即沿用原密码</small>
+                <label><input type="checkbox" id="smtpPasswordClear"> 清除已保存的密码</label>
+            </div>
+            <div class="form-group">
+                <label>发件人（留空使用用户名）</label>
+                <input type="text" id="smtpFrom">
+            </div>
+            <div class="form-group">
+                <label>标题模板</label>
+                <input type="text" id="emailSubject" placeholder="[{title}] {event} {subject}">
+                <small>可用占位符：{title}、{event}、{subject}、{severity}、{message}、{time}</small>
+            </div>
+            <div class="form-group">
+                <label>触发事件（逗号分隔，规则同Webhook）</label>
+                <input type="text" id="emailEvents" placeholder="留空接收全部事件">
+            </div>
+
+            <button type="button" onclick="saveEmail()">💾 保存配置</button>
+            <button type="button" class="test" onclick="testEmail()">🧪 发送测试邮件</button>
+        </form>
+
         <div id="result" style="margin-top: 20px;"></div>
     </div>
 
@@ -1079,9 +1725,61 @@ func (ws *WebServer) handleMonitorPage(w http.ResponseWriter, r *http.Request) {
                 document.getElementById('enabled').value = webhook.enabled?.toString() || 'false';
                 document.getElementById('url').value = webhook.url || '';
                 document.getElementById('events').value = (webhook.events || []).join(',');
+                document.getElementById('repeatMinutes').value = webhook.repeat_minutes || '';
+                document.getElementById('retries').value = webhook.retries != null ? webhook.retries : '';
+            }
+            if (data.success && data.data.monitor) {
+                const monitor = data.data.monitor;
+                document.getElementById('emailEnabled').value = (monitor.monitor === true && monitor.mode === 'email').toString();
+                document.getElementById('email').value = monitor.email || '';
+                document.getElementById('smtpHost').value = monitor.smtp_host || '';
+                document.getElementById('smtpPort').value = monitor.smtp_port || '';
+                document.getElementById('smtpSecurity').value = monitor.smtp_security || '';
+                document.getElementById('smtpUsername').value = monitor.smtp_username || '';
+                document.getElementById('smtpPassword').value = monitor.smtp_password || '';
+                document.getElementById('smtpPasswordClear').checked = false;
+                document.getElementById('smtpFrom').value = monitor.smtp_from || '';
+                document.getElementById('emailSubject').value = monitor.subject || '';
+                document.getElementById('emailEvents').value = (monitor.events || []).join(',');
             }
         }
 
+        function readEmail() {
+            const eventsStr = document.getElementById('emailEvents').value;
+            return {
+                monitor: document.getElementById('emailEnabled').value === 'true',
+                mode: 'email',
+                email: document.getElementById('email').value,
+                smtp_host: document.getElementById('smtpHost').value,
+                smtp_port: parseInt(document.getElementById('smtpPort').value) || 0,
+                smtp_security: document.getElementById('smtpSecurity').value,
+                smtp_username: document.getElementById('smtpUsername').value,
+                smtp_password: document.getElementById('smtpPassword').value,
+                smtp_password_clear: document.getElementById('smtpPasswordClear').checked,
+                smtp_from: document.getElementById('smtpFrom').value,
+                subject: document.getElementById('emailSubject').value,
+                events: eventsStr ? eventsStr.split(',').map(e => e.trim()) : []
+            };
+        }
+
+        async function saveEmail() {
+            const response = await fetch('/api/config', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ monitor: readEmail() })
+            });
+            showResult(await response.json());
+        }
+
+        async function testEmail() {
+            const response = await fetch('/api/email/test', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify(readEmail())
+            });
+            showResult(await response.json());
+        }
+
         async function saveWebhook() {
             const eventsStr = document.getElementById('events').value;
             const events = eventsStr ? eventsStr.split(',').map(e => e.trim()) : [];
@@ -1089,7 +1787,9 @@ func (ws *WebServer) handleMonitorPage(w http.ResponseWriter, r *http.Request) {
             const webhook = {
                 enabled: document.getElementById('enabled').value === 'true',
                 url: document.getElementById('url').value,
-                events: events
+                events: events,
+                repeat_minutes: parseInt(document.getElementById('repeatMinutes').value) || 0,
+                retries: document.getElementById('retries').value === '' ? null : parseInt(document.getElementById('retries').value)
             };
 
             const response = await fetch('/api/config', {
@@ -1145,9 +1845,26 @@ func (ws *WebServer) handleGetConfig(w http.ResponseWriter, r *http.Request) {
 		ws.writeJSON(w, false, "无法加载配置", nil) // 返回错误信息
 		return
 	}
+	if config.MonitorConfig != nil && config.MonitorConfig.SmtpPassword != "" {
+		config.MonitorConfig.SmtpPassword = maskedPassword
+	}
 	ws.writeJSON(w, true, "配置加载成功", config)
 }
 
+// maskedPassword 是配置接口返回的密码占位符
+const maskedPassword = "********"
+
+// submittedPassword 页面提交空值或占位符时沿用已保存的密码；clear 为 true 时清除密码
+func submittedPassword(submitted, stored string, clear bool) string {
+	if clear {
+		return ""
+	}
+	if submitted == "" || submitted == maskedPassword {
+		return stored
+	}
+	return submitted
+}
+
 func (ws *WebServer) handleUpdateConfig(w http.ResponseWriter, r *http.Request) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -1201,16 +1918,30 @@ func (ws *WebServer) handleValidateConfig(w http.ResponseWriter, r *http.Request
 		if config.MqttConfig.Broker == "" {
 			errors = append(errors, "MQTT服务器地址不能为空")
 		}
-		if config.MqttConfig.Port <= 0 || config.MqttConfig.Port > 65535 {
+		if !strings.Contains(config.MqttConfig.Broker, "://") && (config.MqttConfig.Port <= 0 || config.MqttConfig.Port > 65535) {
 			errors = append(errors, "MQTT端口无效")
 		}
 		if config.MqttConfig.Topic == "" {
 			errors = append(errors, "MQTT主题不能为空")
 		}
+		if _, err := mqttTlsConfig(config.MqttConfig); err != nil {
+			errors = append(errors, fmt.Sprintf("MQTT TLS配置错误: %v", err))
+		}
+		if config.MqttConfig.CommandTopic != "" {
+			if err := validateCommandTopic(config.MqttConfig); err != nil {
+				errors = append(errors, fmt.Sprintf("MQTT写入命令主题错误: %v", err))
+			} else if !hasWritableTag(config) {
+				warnings = append(warnings, "已配置写入命令主题，但没有标记为可写(writable)的点，所有写入命令都会被拒绝")
+			}
+		}
 	}
 
 	for _, httpConfig := range config.HttpConfigs {
-		if httpConfig.Enabled {
+		if httpConfig.Enabled && httpConfig.Type == HttpTypeSimulate {
+			if _, err := LoadSimulator(httpConfig.SimFile); err != nil {
+				errors = append(errors, fmt.Sprintf("模拟数据源[%s]点定义无效: %v", httpConfig.Name, err))
+			}
+		} else if httpConfig.Enabled {
 			if httpConfig.Url == "" {
 				errors = append(errors, fmt.Sprintf("HTTP[%s] URL不能为空", httpConfig.Name))
 			}
@@ -1223,6 +1954,11 @@ func (ws *WebServer) handleValidateConfig(w http.ResponseWriter, r *http.Request
 	if len(config.Tasks) == 0 {
 		warnings = append(warnings, "未配置任何任务")
 	}
+	for i, task := range config.Tasks {
+		if !validCollisionPolicy(task.CollisionPolicy) {
+			errors = append(errors, fmt.Sprintf("任务%d collision_policy 无效: %s", i+1, task.CollisionPolicy))
+		}
+	}
 
 	result := map[string]interface{}{
 		"errors":   errors,
@@ -1246,20 +1982,40 @@ func (ws *WebServer) handleMqttTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var mqttConfig MqttConfig
-	if err := json.Unmarshal(body, &mqttConfig); err != nil {
+	var request struct {
+		MqttConfig
+		TestTopic   string `json:"test_topic"`
+		TestPayload string `json:"test_payload"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
 		ws.writeJSON(w, false, "JSON解析失败", nil)
 		return
 	}
 
-	// 测试MQTT连接
-	err = testMqttConnection(&mqttConfig)
+	// 测试MQTT连接：真实握手，可选发布一条探测报文
+	result, err := testMqttConnection(&request.MqttConfig, request.TestTopic, request.TestPayload)
 	if err != nil {
-		ws.writeJSON(w, false, fmt.Sprintf("MQTT连接失败: %v", err), nil)
+		ws.writeJSON(w, false, fmt.Sprintf("MQTT连接失败: %v", err), result)
+		return
+	}
+
+	if result.TestTopic != "" {
+		ws.writeJSON(w, true, fmt.Sprintf("MQTT连接成功，探测报文已发布到 %s", result.TestTopic), result)
 		return
 	}
+	ws.writeJSON(w, true, "MQTT连接成功", result)
+}
 
-	ws.writeJSON(w, true, "MQTT连接成功", nil)
+func (ws *WebServer) handleMqttStatus(w http.ResponseWriter, r *http.Request) {
+	var client *MqttClient
+	if ws.collector != nil {
+		client = ws.collector.snapshot().mqttClient
+	}
+	if client == nil {
+		ws.writeJSON(w, false, "MQTT未启用", nil)
+		return
+	}
+	ws.writeJSON(w, true, "MQTT连接状态", client.Status())
 }
 
 func (ws *WebServer) handleRtdbTest(w http.ResponseWriter, r *http.Request) {
@@ -1290,6 +2046,7 @@ func (ws *WebServer) handleRtdbTest(w http.ResponseWriter, r *http.Request) {
 		ws.writeJSON(w, false, fmt.Sprintf("RTDB初始化失败: %v", err), nil)
 		return
 	}
+	defer client.Disconnect()
 
 	if err := client.Send(testMessage, "测试"); err != nil {
 		ws.writeJSON(w, false, fmt.Sprintf("RTDB发送失败: %v", err), nil)
@@ -1299,6 +2056,45 @@ func (ws *WebServer) handleRtdbTest(w http.ResponseWriter, r *http.Request) {
 	ws.writeJSON(w, true, "RTDB测试数据已发送", nil)
 }
 
+func (ws *WebServer) handleRtdbStatus(w http.ResponseWriter, r *http.Request) {
+	var client *RtdbClient
+	if ws.collector != nil {
+		client = ws.collector.snapshot().rtdbClient
+	}
+	if client == nil {
+		ws.writeJSON(w, false, "RTDB未启用", nil)
+		return
+	}
+	ws.writeJSON(w, true, "RTDB连接状态", client.Status())
+}
+
+// handleStatus 返回采集器运行时状态（任务、输出端连接、缓冲积压）
+func (ws *WebServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if ws.collector == nil {
+		ws.writeJSON(w, false, "采集器未启动", nil)
+		return
+	}
+	ws.writeJSON(w, true, "运行状态", ws.collector.Status())
+}
+
+// handleValues 查询最新值缓存，参数 task / source / prefix / q / offset / limit 均可选
+func (ws *WebServer) handleValues(w http.ResponseWriter, r *http.Request) {
+	if ws.collector == nil {
+		ws.writeJSON(w, false, "采集器未启动", nil)
+		return
+	}
+	query := r.URL.Query()
+	filter := ValueFilter{
+		Task:   query.Get("task"),
+		Source: query.Get("source"),
+		Prefix: query.Get("prefix"),
+		Search: query.Get("q"),
+	}
+	filter.Offset, _ = strconv.Atoi(query.Get("offset"))
+	filter.Limit, _ = strconv.Atoi(query.Get("limit"))
+	ws.writeJSON(w, true, "最新值", ws.collector.values.Query(filter))
+}
+
 func (ws *WebServer) handleHttpTest(w http.ResponseWriter, r *http.Request) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -1322,6 +2118,8 @@ func (ws *WebServer) handleHttpTest(w http.ResponseWriter, r *http.Request) {
 	ws.writeJSON(w, true, "HTTP请求成功", nil)
 }
 
+// handleTransformPreview 预览规则转换结果并检测发布键冲突。test_keys 为空或 live_keys 为 true 时，
+// 使用运行中任务实际出现过的原始键与配置的点；任务的 db_name 映射同样参与冲突检测
 func (ws *WebServer) handleTransformPreview(w http.ResponseWriter, r *http.Request) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -1330,35 +2128,146 @@ func (ws *WebServer) handleTransformPreview(w http.ResponseWriter, r *http.Reque
 	}
 
 	var request struct {
-		Rules    []TransformRule `json:"rules"`
-		TestKeys []string        `json:"test_keys"`
+		Source          string          `json:"source"`
+		Rules           []TransformRule `json:"rules"`
+		TestKeys        []string        `json:"test_keys"`
+		LiveKeys        bool            `json:"live_keys"`
+		CollisionPolicy string          `json:"collision_policy"`
 	}
 
 	if err := json.Unmarshal(body, &request); err != nil {
 		ws.writeJSON(w, false, "JSON解析失败", nil)
 		return
 	}
+	if !validCollisionPolicy(request.CollisionPolicy) {
+		ws.writeJSON(w, false, "无效的 collision_policy: "+request.CollisionPolicy, nil)
+		return
+	}
+
+	var runner *TaskRunner
+	if ws.collector != nil {
+		if runners := ws.collector.runnersFor(request.Source); len(runners) > 0 {
+			runner = runners[0]
+		}
+	}
+
+	keys := request.TestKeys
+	if len(keys) == 0 || request.LiveKeys {
+		if runner == nil {
+			ws.writeJSON(w, false, "没有使用该数据源的运行中任务，请提供 test_keys", nil)
+			return
+		}
+		keys = uniqueKeys(append(append([]string(nil), keys...), runner.originalKeys()...))
+	}
 
 	// 创建转换器
 	transformer := NewKeyTransformer()
-	transformer.ImportRules(request.Rules)
+	if err := transformer.ImportRules(request.Rules); err != nil {
+		ws.writeJSON(w, false, err.Error(), nil)
+		return
+	}
 
 	// 预览转换
 	result := make(map[string]string)
-	for _, key := range request.TestKeys {
+	published := make([]string, 0, len(keys))
+	origins := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if _, exists := result[key]; exists {
+			continue
+		}
 		result[key] = transformer.Transform(key)
+		newKey := result[key]
+		if runner != nil {
+			if tag := runner.tagIndex[key]; tag != nil {
+				newKey = tag.DbName
+			}
+		}
+		published = append(published, newKey)
+		origins = append(origins, key)
+	}
+
+	policy := request.CollisionPolicy
+	if policy == "" && runner != nil {
+		policy = runner.task.CollisionPolicy
+	}
+	_, collisions := newCollisionResolver().resolve(policy, published, origins)
+	if collisions == nil {
+		collisions = []KeyCollision{}
 	}
 
-	ws.writeJSON(w, true, "转换预览", result)
+	ws.writeJSON(w, true, "转换预览", map[string]interface{}{
+		"results":    result,
+		"collisions": collisions,
+	})
 }
 
-func (ws *WebServer) handleGetTransformRules(w http.ResponseWriter, r *http.Request) {
-	source := r.URL.Query().Get("source")
-	fileName := "transform.json"
-	if source != "" {
-		fileName = "transform_" + source + ".json"
+// handleTransformReverse 由发布键反查原始键。未提供 rules 时使用运行中任务的转换器（含运行期观测到的键），
+// 没有运行中的任务时读取规则文件；known_keys 为补充的原始键，用于不可逆规则的反查
+func (ws *WebServer) handleTransformReverse(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		ws.writeJSON(w, false, "读取请求失败", nil)
+		return
 	}
 
+	var request struct {
+		Source    string          `json:"source"`
+		Keys      []string        `json:"keys"`
+		Rules     []TransformRule `json:"rules"`
+		KnownKeys []string        `json:"known_keys"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		ws.writeJSON(w, false, "JSON解析失败", nil)
+		return
+	}
+	if len(request.Keys) == 0 {
+		ws.writeJSON(w, false, "keys 不能为空", nil)
+		return
+	}
+
+	var transformer *KeyTransformer
+	if request.Rules == nil && ws.collector != nil {
+		if runners := ws.collector.runnersFor(request.Source); len(runners) > 0 {
+			transformer = runners[0].transformer
+		}
+	}
+	if transformer == nil {
+		transformer = NewKeyTransformer()
+		if request.Rules != nil {
+			if err := transformer.ImportRules(request.Rules); err != nil {
+				ws.writeJSON(w, false, err.Error(), nil)
+				return
+			}
+		} else {
+			fileName := transformFileFor(request.Source)
+			if err := transformer.LoadFromFile(fileName); err != nil && !os.IsNotExist(err) {
+				ws.writeJSON(w, false, "读取规则文件失败: "+err.Error(), nil)
+				return
+			}
+		}
+	}
+	if len(request.KnownKeys) > 0 {
+		// 补充的键只用于本次反查，不写入运行中转换器的观测索引
+		transformer = transformer.clone()
+		for _, key := range request.KnownKeys {
+			transformer.Transform(key)
+		}
+	}
+
+	results := make([]ReverseResult, 0, len(request.Keys))
+	for _, key := range request.Keys {
+		results = append(results, transformer.Reverse(key))
+	}
+	ws.writeJSON(w, true, "反向转换", map[string]interface{}{
+		"reversible": rulesReversible(transformer.ExportRules()) || !transformer.IsEnabled(),
+		"results":    results,
+		"collisions": transformer.Collisions(),
+	})
+}
+
+func (ws *WebServer) handleGetTransformRules(w http.ResponseWriter, r *http.Request) {
+	fileName := transformFileFor(r.URL.Query().Get("source"))
+
 	data, err := os.ReadFile(fileName)
 	if err != nil {
 		ws.writeJSON(w, false, "读取规则文件失败: "+err.Error(), nil)
@@ -1388,25 +2297,39 @@ func (ws *WebServer) handleUpdateTransformRules(w http.ResponseWriter, r *http.R
 	}
 
 	source, _ := requestData["source"].(string)
-	fileName := "transform.json"
-	if source != "" {
-		fileName = "transform_" + source + ".json"
-	}
+	fileName := transformFileFor(source)
 
 	delete(requestData, "source")
 
+	// 规则无效时不写入文件，避免运行中的任务加载失败
+	var config TransformConfig
+	if err := json.Unmarshal(body, &config); err != nil {
+		ws.writeJSON(w, false, "规则格式错误: "+err.Error(), nil)
+		return
+	}
+	if _, err := compileRules(config.Rules); err != nil {
+		ws.writeJSON(w, false, err.Error(), nil)
+		return
+	}
+
 	data, err := json.MarshalIndent(requestData, "", "  ")
 	if err != nil {
 		ws.writeJSON(w, false, "序列化失败", nil)
 		return
 	}
 
-	if err := os.WriteFile(fileName, data, 0644); err != nil {
+	// 先写临时文件再改名，避免规则监视器读到写了一半的文件
+	if err := os.WriteFile(fileName+".tmp", data, 0644); err != nil {
+		ws.writeJSON(w, false, "保存规则文件失败: "+err.Error(), nil)
+		return
+	}
+	if err := os.Rename(fileName+".tmp", fileName); err != nil {
+		os.Remove(fileName + ".tmp")
 		ws.writeJSON(w, false, "保存规则文件失败: "+err.Error(), nil)
 		return
 	}
 
-	ws.writeJSON(w, true, "规则已保存到 transform.json", nil)
+	ws.writeJSON(w, true, "规则已保存到 "+fileName+"，运行中的任务将自动重新加载", nil)
 }
 
 func (ws *WebServer) handleTransformDebug(w http.ResponseWriter, r *http.Request) {
@@ -1503,6 +2426,12 @@ func (ws *WebServer) updateConfigFromMap(config *AppConfig, updates map[string]i
 				if timeout, ok := httpData["timeout"].(float64); ok {
 					httpConfig.Timeout = int(timeout)
 				}
+				if httpType, ok := httpData["type"].(string); ok {
+					httpConfig.Type = httpType
+				}
+				if simFile, ok := httpData["sim_file"].(string); ok {
+					httpConfig.SimFile = simFile
+				}
 				config.HttpConfigs = append(config.HttpConfigs, httpConfig)
 			}
 		}
@@ -1542,6 +2471,42 @@ func (ws *WebServer) updateConfigFromMap(config *AppConfig, updates map[string]i
 		if split, ok := mqttData["split"].(bool); ok {
 			config.MqttConfig.Split = split
 		}
+		if protocol, ok := mqttData["protocol"].(string); ok {
+			config.MqttConfig.Protocol = protocol
+		}
+		if wsPath, ok := mqttData["ws_path"].(string); ok {
+			config.MqttConfig.WsPath = wsPath
+		}
+		if caFile, ok := mqttData["tls_ca_file"].(string); ok {
+			config.MqttConfig.TlsCaFile = caFile
+		}
+		if certFile, ok := mqttData["tls_cert_file"].(string); ok {
+			config.MqttConfig.TlsCertFile = certFile
+		}
+		if keyFile, ok := mqttData["tls_key_file"].(string); ok {
+			config.MqttConfig.TlsKeyFile = keyFile
+		}
+		if insecure, ok := mqttData["tls_insecure_skip_verify"].(bool); ok {
+			config.MqttConfig.TlsInsecureSkipVerify = insecure
+		}
+		if serverName, ok := mqttData["tls_server_name"].(string); ok {
+			config.MqttConfig.TlsServerName = serverName
+		}
+		if groupId, ok := mqttData["sparkplug_group_id"].(string); ok {
+			config.MqttConfig.SparkplugGroupId = groupId
+		}
+		if edgeNodeId, ok := mqttData["sparkplug_edge_node_id"].(string); ok {
+			config.MqttConfig.SparkplugEdgeNodeId = edgeNodeId
+		}
+		if commandTopic, ok := mqttData["command_topic"].(string); ok {
+			config.MqttConfig.CommandTopic = commandTopic
+		}
+		if commandAckTopic, ok := mqttData["command_ack_topic"].(string); ok {
+			config.MqttConfig.CommandAckTopic = commandAckTopic
+		}
+		if alarmTopic, ok := mqttData["alarm_topic"].(string); ok {
+			config.MqttConfig.AlarmTopic = alarmTopic
+		}
 	}
 
 	if rtdbData, ok := updates["rtdb"].(map[string]interface{}); ok {
@@ -1578,6 +2543,86 @@ func (ws *WebServer) updateConfigFromMap(config *AppConfig, updates map[string]i
 				config.WebhookConfig.Events[i] = e.(string)
 			}
 		}
+		if repeat, ok := webhookData["repeat_minutes"].(float64); ok {
+			config.WebhookConfig.RepeatMinutes = int(repeat)
+		}
+		if retries, ok := webhookData["retries"]; ok {
+			// 留空（null）表示使用默认次数，0 表示不重试
+			config.WebhookConfig.Retries = nil
+			if n, ok := retries.(float64); ok {
+				count := int(n)
+				config.WebhookConfig.Retries = &count
+			}
+		}
+	}
+
+	if monitorData, ok := updates["monitor"].(map[string]interface{}); ok {
+		if config.MonitorConfig == nil {
+			config.MonitorConfig = &MonitorConfig{}
+		}
+		if monitor, ok := monitorData["monitor"].(bool); ok {
+			config.MonitorConfig.Monitor = monitor
+		}
+		if mode, ok := monitorData["mode"].(string); ok {
+			config.MonitorConfig.Mode = mode
+		}
+		if email, ok := monitorData["email"].(string); ok {
+			config.MonitorConfig.Email = email
+		}
+		if host, ok := monitorData["smtp_host"].(string); ok {
+			config.MonitorConfig.SmtpHost = host
+		}
+		if port, ok := monitorData["smtp_port"].(float64); ok {
+			config.MonitorConfig.SmtpPort = int(port)
+		}
+		if security, ok := monitorData["smtp_security"].(string); ok {
+			config.MonitorConfig.SmtpSecurity = security
+		}
+		if username, ok := monitorData["smtp_username"].(string); ok {
+			config.MonitorConfig.SmtpUsername = username
+		}
+		clearPassword, _ := monitorData["smtp_password_clear"].(bool)
+		if password, ok := monitorData["smtp_password"].(string); ok || clearPassword {
+			config.MonitorConfig.SmtpPassword = submittedPassword(password, config.MonitorConfig.SmtpPassword, clearPassword)
+		}
+		if from, ok := monitorData["smtp_from"].(string); ok {
+			config.MonitorConfig.SmtpFrom = from
+		}
+		if subject, ok := monitorData["subject"].(string); ok {
+			config.MonitorConfig.Subject = subject
+		}
+		if events, ok := monitorData["events"].([]interface{}); ok {
+			config.MonitorConfig.Events = make([]string, 0, len(events))
+			for _, e := range events {
+				if name, ok := e.(string); ok {
+					config.MonitorConfig.Events = append(config.MonitorConfig.Events, name)
+				}
+			}
+		}
+	}
+
+	if bufferData, ok := updates["buffer"].(map[string]interface{}); ok {
+		if config.BufferConfig == nil {
+			config.BufferConfig = &BufferConfig{}
+		}
+		if enabled, ok := bufferData["enabled"].(bool); ok {
+			config.BufferConfig.Enabled = enabled
+		}
+		if dir, ok := bufferData["dir"].(string); ok {
+			config.BufferConfig.Dir = dir
+		}
+		if maxSize, ok := bufferData["max_size_mb"].(float64); ok {
+			config.BufferConfig.MaxSizeMB = int(maxSize)
+		}
+		if maxAge, ok := bufferData["max_age_hours"].(float64); ok {
+			config.BufferConfig.MaxAgeHours = int(maxAge)
+		}
+		if overflow, ok := bufferData["overflow"].(string); ok {
+			if !validOverflow(overflow) {
+				return fmt.Errorf("缓冲溢出策略无效: %s", overflow)
+			}
+			config.BufferConfig.Overflow = overflow
+		}
 	}
 
 	if tasksData, ok := updates["tasks"].([]interface{}); ok {
@@ -1594,6 +2639,31 @@ func (ws *WebServer) updateConfigFromMap(config *AppConfig, updates map[string]i
 				if interval, ok := taskData["job_interval_second"].(float64); ok {
 					task.JobIntervalSecond = int(interval)
 				}
+				if strict, ok := taskData["strict"].(bool); ok {
+					task.Strict = strict
+				}
+				if rbe, ok := taskData["report_by_exception"].(bool); ok {
+					task.ReportByException = rbe
+				}
+				if deadband, ok := taskData["deadband"].(float64); ok {
+					task.Deadband = deadband
+				}
+				if percent, ok := taskData["deadband_percent"].(float64); ok {
+					task.DeadbandPercent = percent
+				}
+				if silence, ok := taskData["max_silence_second"].(float64); ok {
+					task.MaxSilenceSecond = int(silence)
+				}
+				if tsSource, ok := taskData["timestamp_source"].(string); ok {
+					task.TimestampSource = tsSource
+				}
+				if policy, ok := taskData["collision_policy"].(string); ok {
+					task.CollisionPolicy = policy
+				}
+				if precision, ok := taskData["tag_precision"].(float64); ok {
+					digits := int(precision)
+					task.TagPrecision = &digits
+				}
 				if tagsData, ok := taskData["tags"].([]interface{}); ok {
 					for _, tagItem := range tagsData {
 						if tagData, ok := tagItem.(map[string]interface{}); ok {
@@ -1604,6 +2674,35 @@ func (ws *WebServer) updateConfigFromMap(config *AppConfig, updates map[string]i
 							if dbName, ok := tagData["db_name"].(string); ok {
 								tag.DbName = dbName
 							}
+							if deadband, ok := tagData["deadband"].(float64); ok {
+								tag.Deadband = &deadband
+							}
+							if percent, ok := tagData["deadband_percent"].(float64); ok {
+								tag.DeadbandPercent = &percent
+							}
+							if silence, ok := tagData["max_silence_second"].(float64); ok {
+								seconds := int(silence)
+								tag.MaxSilenceSecond = &seconds
+							}
+							tag.Scale = floatList(tagData["scale"], 4)
+							if gain, ok := tagData["gain"].(float64); ok {
+								tag.Gain = &gain
+							}
+							if offset, ok := tagData["offset"].(float64); ok {
+								tag.Offset = offset
+							}
+							tag.Clamp = floatList(tagData["clamp"], 2)
+							if precision, ok := tagData["precision"].(float64); ok {
+								digits := int(precision)
+								tag.Precision = &digits
+							}
+							if unit, ok := tagData["unit"].(string); ok {
+								tag.Unit = unit
+							}
+							tag.Alarm = parseTagAlarm(tagData["alarm"])
+							if writable, ok := tagData["writable"].(bool); ok {
+								tag.Writable = writable
+							}
 							task.Tags = append(task.Tags, tag)
 						}
 					}
@@ -1616,17 +2715,153 @@ func (ws *WebServer) updateConfigFromMap(config *AppConfig, updates map[string]i
 	return nil
 }
 
-func testMqttConnection(config *MqttConfig) error {
+// floatList 解析 JSON 数组形式的 n 个数值，个数不符或含非数值时返回 nil
+func floatList(raw interface{}, n int) []float64 {
+	items, ok := raw.([]interface{})
+	if !ok || len(items) != n {
+		return nil
+	}
+	values := make([]float64, n)
+	for i, item := range items {
+		v, ok := item.(float64)
+		if !ok {
+			return nil
+		}
+		values[i] = v
+	}
+	return values
+}
+
+// parseTagAlarm 解析点级报警规则，未配置或一项都没有时返回 nil
+func parseTagAlarm(raw interface{}) *TagAlarm {
+	data, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	optional := func(name string) *float64 {
+		if v, ok := data[name].(float64); ok {
+			return &v
+		}
+		return nil
+	}
+	alarm := &TagAlarm{
+		HiHi:         optional("hihi"),
+		Hi:           optional("hi"),
+		Lo:           optional("lo"),
+		LoLo:         optional("lolo"),
+		RateOfChange: optional("rate_of_change"),
+	}
+	alarm.BadQuality, _ = data["bad_quality"].(bool)
+	if stale, ok := data["stale_second"].(float64); ok {
+		alarm.StaleSecond = int(stale)
+	}
+	if deadband, ok := data["deadband"].(float64); ok {
+		alarm.Deadband = deadband
+	}
+	if delay, ok := data["on_delay_second"].(float64); ok {
+		alarm.OnDelaySecond = int(delay)
+	}
+	if *alarm == (TagAlarm{}) {
+		return nil
+	}
+	return alarm
+}
+
+// MqttTestResult 是 /api/mqtt/test 返回的握手详情
+type MqttTestResult struct {
+	Broker         string `json:"broker"`
+	ClientId       string `json:"client_id"`
+	ConnectMs      int64  `json:"connect_ms"`
+	ReturnCode     byte   `json:"return_code"`
+	ReturnMessage  string `json:"return_message"`
+	SessionPresent bool   `json:"session_present"`
+	TestTopic      string `json:"test_topic,omitempty"`
+	PublishMs      int64  `json:"publish_ms,omitempty"`
+}
+
+// testMqttConnection 使用提交的配置真实连接 Broker（不重试），返回 CONNACK 结果与耗时；
+// testTopic 非空时再以配置的 QoS 发布一条探测报文。
+func testMqttConnection(config *MqttConfig, testTopic, testPayload string) (*MqttTestResult, error) {
 	if config.Broker == "" {
-		return fmt.Errorf("MQTT服务器地址不能为空")
+		return nil, fmt.Errorf("MQTT服务器地址不能为空")
 	}
-	if config.Port <= 0 || config.Port > 65535 {
-		return fmt.Errorf("MQTT端口无效")
+	if !strings.Contains(config.Broker, "://") && (config.Port <= 0 || config.Port > 65535) {
+		return nil, fmt.Errorf("MQTT端口无效")
 	}
-	return nil
+	tlsConfig, err := mqttTlsConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// 使用独立的客户端ID，避免把正在运行的采集连接踢下线
+	clientId := config.ClientId + "_test"
+	if config.ClientId == "" {
+		clientId = fmt.Sprintf("opc_collector_test_%d", time.Now().Unix())
+	}
+
+	result := &MqttTestResult{
+		Broker:   mqttBrokerURL(config),
+		ClientId: clientId,
+	}
+
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(result.Broker)
+	opts.SetClientID(clientId)
+	opts.SetUsername(config.Username)
+	opts.SetPassword(config.Password)
+	opts.SetCleanSession(true)
+	opts.SetAutoReconnect(false)
+	opts.SetConnectTimeout(5 * time.Second)
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	client := mqtt.NewClient(opts)
+	start := time.Now()
+	token := client.Connect()
+	if !token.WaitTimeout(10 * time.Second) {
+		// 停止仍在进行的连接尝试，避免探测客户端在后台残留
+		client.Disconnect(0)
+		result.ConnectMs = time.Since(start).Milliseconds()
+		return result, fmt.Errorf("连接超时")
+	}
+	result.ConnectMs = time.Since(start).Milliseconds()
+	if connectToken, ok := token.(*mqtt.ConnectToken); ok {
+		result.ReturnCode = connectToken.ReturnCode()
+		result.SessionPresent = connectToken.SessionPresent()
+		result.ReturnMessage = packets.ConnackReturnCodes[result.ReturnCode]
+	}
+	if token.Error() != nil {
+		client.Disconnect(0)
+		return result, token.Error()
+	}
+	defer client.Disconnect(250)
+
+	if testTopic != "" {
+		if testPayload == "" {
+			testPayload = fmt.Sprintf(`{"source":"opc_collector","probe":true,"timestamp":"%s"}`, time.Now().Format(time.RFC3339))
+		}
+		result.TestTopic = testTopic
+		start = time.Now()
+		pubToken := client.Publish(testTopic, byte(config.Qos), false, testPayload)
+		if !pubToken.WaitTimeout(10 * time.Second) {
+			result.PublishMs = time.Since(start).Milliseconds()
+			return result, fmt.Errorf("探测报文发布超时")
+		}
+		result.PublishMs = time.Since(start).Milliseconds()
+		if pubToken.Error() != nil {
+			return result, fmt.Errorf("探测报文发布失败: %v", pubToken.Error())
+		}
+	}
+
+	return result, nil
 }
 
 func testHttpConnection(config *HttpConfig) error {
+	if config.Type == HttpTypeSimulate {
+		_, err := LoadSimulator(config.SimFile)
+		return err
+	}
 	if config.Url == "" {
 		return fmt.Errorf("HTTP URL不能为空")
 	}
@@ -1673,25 +2908,78 @@ func (ws *WebServer) handleWebhookTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	payload := map[string]interface{}{
-		"event":   request.Event,
-		"message": request.Message,
-		"source":  "opc_collector",
+	// 与实际告警使用相同的报文格式
+	event := Event{
+		Type:     request.Event,
+		Subject:  "test",
+		Severity: SeverityError,
+		Message:  request.Message,
+		Time:     time.Now().Format(time.RFC3339),
+	}
+	if err := NewWebhookChannel(&WebhookConfig{Url: request.Url}).Send(event); err != nil {
+		ws.writeJSON(w, false, fmt.Sprintf("发送失败: %v", err), nil)
+		return
 	}
+	ws.writeJSON(w, true, "Webhook测试成功", nil)
+}
 
-	jsonData, _ := json.Marshal(payload)
-	resp, err := http.Post(request.Url, "application/json", strings.NewReader(string(jsonData)))
+// handleEmailTest 使用提交的 [monitor] 配置发送一封测试邮件（不要求 monitor=true）
+func (ws *WebServer) handleEmailTest(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		ws.writeJSON(w, false, fmt.Sprintf("发送失败: %v", err), nil)
+		ws.writeJSON(w, false, "读取请求失败", nil)
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		ws.writeJSON(w, true, "Webhook测试成功", nil)
-	} else {
-		ws.writeJSON(w, false, fmt.Sprintf("Webhook返回状态码: %d", resp.StatusCode), nil)
+	var request struct {
+		MonitorConfig
+		ClearPassword bool `json:"smtp_password_clear"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		ws.writeJSON(w, false, "JSON解析失败", nil)
+		return
+	}
+	monitor := request.MonitorConfig
+
+	// 已保存的密码只用于同一服务器与账号，防止借测试接口把密码发往其他主机
+	keep := monitor.SmtpPassword == "" || monitor.SmtpPassword == maskedPassword
+	if stored := ws.configManager.Load(ws.configPath); keep && !request.ClearPassword && stored != nil &&
+		stored.MonitorConfig != nil && stored.MonitorConfig.SmtpPassword != "" {
+		saved := stored.MonitorConfig
+		if monitor.SmtpHost != saved.SmtpHost || monitor.SmtpPort != saved.SmtpPort || monitor.SmtpUsername != saved.SmtpUsername {
+			if monitor.SmtpPassword == maskedPassword {
+				ws.writeJSON(w, false, "SMTP服务器或用户名已修改，请重新输入密码", nil)
+				return
+			}
+		} else {
+			monitor.SmtpPassword = saved.SmtpPassword
+		}
 	}
+	if monitor.SmtpPassword == maskedPassword {
+		monitor.SmtpPassword = ""
+	}
+
+	title := ""
+	if ws.collector != nil {
+		title = ws.collector.snapshot().config.Title
+	}
+	channel, err := NewEmailChannel(&monitor, title)
+	if err != nil {
+		ws.writeJSON(w, false, fmt.Sprintf("配置无效: %v", err), nil)
+		return
+	}
+	event := Event{
+		Type:     "test",
+		Subject:  "test",
+		Severity: SeverityError,
+		Message:  "这是一条测试邮件",
+		Time:     time.Now().Format(time.RFC3339),
+	}
+	if err := channel.Send(event); err != nil {
+		ws.writeJSON(w, false, fmt.Sprintf("发送失败: %v", err), nil)
+		return
+	}
+	ws.writeJSON(w, true, "测试邮件已发送", nil)
 }
 
 func (ws *WebServer) handleTasksPage(w http.ResponseWriter, r *http.Request) {
@@ -1760,6 +3048,48 @@ func (ws *WebServer) handleTasksPage(w http.ResponseWriter, r *http.Request) {
                     <label>绑定数据源</label>
                     <select id="taskSource"></select>
                 </div>
+                <div class="form-group">
+                    <label>时间戳来源</label>
+                    <select id="taskTsSource">
+                        <option value="source">数据源（OPC 时间戳）</option>
+                        <option value="collector">采集时间</option>
+                    </select>
+                </div>
+                <div class="form-group">
+                    <label>发布键冲突处理（多个点转换为同一键名）</label>
+                    <select id="taskCollision">
+                        <option value="keep_last">保留后出现的点（默认）</option>
+                        <option value="keep_first">保留最先出现的点</option>
+                        <option value="suffix">追加序号（键名_2、键名_3…）</option>
+                        <option value="reject">冲突的点都不发布</option>
+                    </select>
+                </div>
+                <div class="form-group">
+                    <label>只发布已配置标签（白名单）</label>
+                    <select id="taskStrict">
+                        <option value="false">关闭（发布数据源全部点）</option>
+                        <option value="true">开启（缺失的点以坏质量上报）</option>
+                    </select>
+                </div>
+                <div class="form-group">
+                    <label>按变化上报</label>
+                    <select id="taskRbe">
+                        <option value="false">关闭（每次全部上报）</option>
+                        <option value="true">开启</option>
+                    </select>
+                </div>
+                <div class="form-group">
+                    <label>绝对死区</label>
+                    <input type="number" id="taskDeadband" value="0" min="0" step="any">
+                </div>
+                <div class="form-group">
+                    <label>百分比死区(%)</label>
+                    <input type="number" id="taskDeadbandPercent" value="0" min="0" step="any">
+                </div>
+                <div class="form-group">
+                    <label>心跳上报间隔(秒，0为不强制)</label>
+                    <input type="number" id="taskMaxSilence" value="0" min="0">
+                </div>
                 <div class="modal-actions">
                     <button class="btn" onclick="closeModal()" style="background:#666;color:white;">取消</button>
                     <button class="btn btn-primary" onclick="saveTask()">保存</button>
@@ -1806,7 +3136,8 @@ func (ws *WebServer) handleTasksPage(w http.ResponseWriter, r *http.Request) {
                     '<div class="task-info">' +
                     '数据源: ' + source + '<br>' +
                     '采集间隔: ' + interval + '秒<br>' +
-                    '标签数: ' + (task.tags ? task.tags.length : 0) + '<br>' +
+                    (task.report_by_exception ? '按变化上报: 死区 ' + (task.deadband || 0) + ' / ' + (task.deadband_percent || 0) + '%<br>' : '') +
+                    '标签数: ' + (task.tags ? task.tags.length : 0) + (task.strict ? '（白名单）' : '') + '<br>' +
                     '</div>' +
                     '<div class="task-actions">' +
                     '<button class="btn btn-edit" onclick="editTask(' + index + ')">编辑</button>' +
@@ -1835,9 +3166,23 @@ func (ws *WebServer) handleTasksPage(w http.ResponseWriter, r *http.Request) {
                 document.getElementById('taskEnabled').value = task.enabled ? 'true' : 'false';
                 document.getElementById('taskInterval').value = task.job_interval_second || 1;
                 select.value = task.http_source || (httpConfigs[0] ? (httpConfigs[0].name || httpConfigs[0].url) : '');
+                document.getElementById('taskTsSource').value = task.timestamp_source || 'source';
+                document.getElementById('taskCollision').value = task.collision_policy || 'keep_last';
+                document.getElementById('taskStrict').value = task.strict ? 'true' : 'false';
+                document.getElementById('taskRbe').value = task.report_by_exception ? 'true' : 'false';
+                document.getElementById('taskDeadband').value = task.deadband || 0;
+                document.getElementById('taskDeadbandPercent').value = task.deadband_percent || 0;
+                document.getElementById('taskMaxSilence').value = task.max_silence_second || 0;
             } else {
                 document.getElementById('taskEnabled').value = 'true';
                 document.getElementById('taskInterval').value = 1;
+                document.getElementById('taskTsSource').value = 'source';
+                document.getElementById('taskCollision').value = 'keep_last';
+                document.getElementById('taskStrict').value = 'false';
+                document.getElementById('taskRbe').value = 'false';
+                document.getElementById('taskDeadband').value = 0;
+                document.getElementById('taskDeadbandPercent').value = 0;
+                document.getElementById('taskMaxSilence').value = 0;
             }
 
             document.getElementById('taskModal').style.display = 'block';
@@ -1857,12 +3202,19 @@ func (ws *WebServer) handleTasksPage(w http.ResponseWriter, r *http.Request) {
                 enabled: enabled,
                 http_source: source,
                 job_interval_second: interval,
+                timestamp_source: document.getElementById('taskTsSource').value,
+                collision_policy: document.getElementById('taskCollision').value,
+                strict: document.getElementById('taskStrict').value === 'true',
+                report_by_exception: document.getElementById('taskRbe').value === 'true',
+                deadband: parseFloat(document.getElementById('taskDeadband').value) || 0,
+                deadband_percent: parseFloat(document.getElementById('taskDeadbandPercent').value) || 0,
+                max_silence_second: parseInt(document.getElementById('taskMaxSilence').value) || 0,
                 tags: []
             };
 
             if (editingTask >= 0) {
-                task.tags = tasks[editingTask].tags || [];
-                tasks[editingTask] = task;
+                // 保留弹窗中未展示的字段（如点级配置）
+                tasks[editingTask] = Object.assign({}, tasks[editingTask], task, { tags: tasks[editingTask].tags || [] });
             } else {
                 tasks.push(task);
             }